@@ -0,0 +1,328 @@
+package GeeRPC
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 认证使用的元数据键
+const (
+	// AuthorizationKey Bearer Token, 值为 "Bearer <token>"
+	AuthorizationKey = "authorization"
+	// HMACKeyIDKey HMAC签名使用的密钥编号
+	HMACKeyIDKey = "x-geerpc-key-id"
+	// HMACTimestampKey HMAC签名的Unix时间戳(秒)
+	HMACTimestampKey = "x-geerpc-timestamp"
+	// HMACNonceKey HMAC签名的随机数, 每次调用不同, 服务端拒绝重复的随机数
+	HMACNonceKey = "x-geerpc-nonce"
+	// HMACSignatureKey HMAC签名, 十六进制编码
+	HMACSignatureKey = "x-geerpc-signature"
+)
+
+// Principal 经过认证的调用方
+type Principal struct {
+	// Name 调用方名称
+	Name string
+	// Roles 调用方拥有的角色
+	Roles []string
+}
+
+type principalKey struct{}
+
+// PrincipalFromContext 返回服务方法和拦截器的ctx中经过认证的调用方
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// Authenticator 服务端认证器
+//
+// 请求没有携带该认证方式的凭证时返回 (nil, nil), 交给下一个认证器;
+// 携带了凭证但无效时返回错误。
+type Authenticator interface {
+	Authenticate(ctx context.Context, serviceMethod string) (*Principal, error)
+}
+
+// AuthenticatorFunc 函数形式的Authenticator
+type AuthenticatorFunc func(ctx context.Context, serviceMethod string) (*Principal, error)
+
+// Authenticate implements Authenticator
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, serviceMethod string) (*Principal, error) {
+	return f(ctx, serviceMethod)
+}
+
+// BearerTokenAuthenticator 按 "authorization: Bearer <token>" 认证, tokens为token到调用方的映射
+func BearerTokenAuthenticator(tokens map[string]*Principal) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context, serviceMethod string) (*Principal, error) {
+		auth, ok := IncomingMetadata(ctx)[AuthorizationKey]
+		if !ok {
+			return nil, nil
+		}
+		token := strings.TrimPrefix(auth, "Bearer ")
+		for t, p := range tokens { // 逐个比较, 避免按时间差猜测token
+			if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+				return p, nil
+			}
+		}
+		return nil, Errorf(Unauthenticated, "rpc server: invalid bearer token")
+	})
+}
+
+// HMACAuthenticator 按HMAC-SHA256签名认证
+//
+// 客户端对 "ServiceMethod\n时间戳\n随机数" 签名, 见 HMACCredentials。服务端记住MaxSkew内见过的随机数,
+// 截获的签名不能再次使用。签名不覆盖调用的参数: 能够篡改传输中数据的攻击者可以替换参数,
+// 需要保护参数时应使用TLS(见 WithTLS)。
+type HMACAuthenticator struct {
+	// Keys 密钥编号到密钥的映射
+	Keys map[string][]byte
+	// Principals 密钥编号到调用方的映射, 缺省时以密钥编号为调用方名称
+	Principals map[string]*Principal
+	// MaxSkew 允许的时间戳偏差, 用于限制重放, 默认5分钟
+	MaxSkew time.Duration
+
+	mu sync.Mutex
+	// seen MaxSkew内见过的 密钥编号+随机数, 值为过期时间
+	seen map[string]time.Time
+	// sweepAt seen的大小超过该值时清理过期的项
+	sweepAt int
+}
+
+// Authenticate implements Authenticator
+func (a *HMACAuthenticator) Authenticate(ctx context.Context, serviceMethod string) (*Principal, error) {
+	md := IncomingMetadata(ctx)
+	keyID, ok := md[HMACKeyIDKey]
+	if !ok {
+		return nil, nil
+	}
+	key, ok := a.Keys[keyID]
+	if !ok {
+		return nil, Errorf(Unauthenticated, "rpc server: unknown hmac key %q", keyID)
+	}
+	ts, err := strconv.ParseInt(md[HMACTimestampKey], 10, 64)
+	if err != nil {
+		return nil, Errorf(Unauthenticated, "rpc server: invalid hmac timestamp")
+	}
+	maxSkew := a.MaxSkew
+	if maxSkew <= 0 {
+		maxSkew = 5 * time.Minute
+	}
+	if skew := time.Since(time.Unix(ts, 0)); skew > maxSkew || skew < -maxSkew {
+		return nil, Errorf(Unauthenticated, "rpc server: hmac timestamp out of range")
+	}
+	nonce := md[HMACNonceKey]
+	if nonce == "" {
+		return nil, Errorf(Unauthenticated, "rpc server: missing hmac nonce")
+	}
+	want := hmacSignature(key, serviceMethod, md[HMACTimestampKey], nonce)
+	if !hmac.Equal([]byte(want), []byte(md[HMACSignatureKey])) {
+		return nil, Errorf(Unauthenticated, "rpc server: invalid hmac signature")
+	}
+	if !a.remember(keyID+"\n"+nonce, time.Unix(ts, 0).Add(maxSkew)) {
+		return nil, Errorf(Unauthenticated, "rpc server: replayed hmac signature")
+	}
+	if p, ok := a.Principals[keyID]; ok {
+		return p, nil
+	}
+	return &Principal{Name: keyID}, nil
+}
+
+// remember 记录签名的随机数直到expire, 已经见过时返回false
+func (a *HMACAuthenticator) remember(nonce string, expire time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	if a.seen == nil {
+		a.seen = make(map[string]time.Time)
+	}
+	if len(a.seen) >= a.sweepAt {
+		for k, t := range a.seen {
+			if now.After(t) {
+				delete(a.seen, k)
+			}
+		}
+		a.sweepAt = 2 * len(a.seen)
+		if a.sweepAt < 1024 {
+			a.sweepAt = 1024
+		}
+	}
+	if t, ok := a.seen[nonce]; ok && !now.After(t) {
+		return false
+	}
+	a.seen[nonce] = expire
+	return true
+}
+
+func hmacSignature(key []byte, serviceMethod, timestamp, nonce string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(serviceMethod + "\n" + timestamp + "\n" + nonce))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// TLSAuthenticator 以双向TLS验证过的客户端证书标识作为调用方, roles返回该标识拥有的角色, 可以为nil
+func TLSAuthenticator(roles func(identity string) []string) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context, serviceMethod string) (*Principal, error) {
+		p, ok := PeerFromContext(ctx)
+		if !ok || p.Identity == "" {
+			return nil, nil
+		}
+		principal := &Principal{Name: p.Identity}
+		if roles != nil {
+			principal.Roles = roles(p.Identity)
+		}
+		return principal, nil
+	})
+}
+
+// Policy 声明式的授权策略
+//
+// 按顺序查找ServiceMethod匹配的规则, 调用方满足其中任意一条即允许访问;
+// 没有规则匹配的方法拒绝访问。
+type Policy struct {
+	Rules []Rule
+}
+
+// Rule 授权规则
+type Rule struct {
+	// Methods 规则适用的方法, 使用 path.Match 的模式匹配 "Service.Method", 如 "Foo.*"、"*"
+	Methods []string
+	// Principals 允许的调用方名称, "*" 表示任意经过认证的调用方
+	Principals []string
+	// Roles 允许的角色, 调用方拥有其中之一即可
+	Roles []string
+	// Anonymous 是否允许未经认证的调用方
+	Anonymous bool
+}
+
+// matchMethod 判断规则是否适用于serviceMethod
+func (r *Rule) matchMethod(serviceMethod string) bool {
+	for _, pattern := range r.Methods {
+		if ok, _ := path.Match(pattern, serviceMethod); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// allows 判断规则是否允许p访问
+func (r *Rule) allows(p *Principal) bool {
+	if p == nil {
+		return r.Anonymous
+	}
+	for _, name := range r.Principals {
+		if name == "*" || name == p.Name {
+			return true
+		}
+	}
+	for _, role := range r.Roles {
+		for _, have := range p.Roles {
+			if role == have {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Authorize 判断p是否可以调用serviceMethod, p为nil表示未经认证
+func (policy *Policy) Authorize(p *Principal, serviceMethod string) error {
+	matched := false
+	for i := range policy.Rules {
+		r := &policy.Rules[i]
+		if !r.matchMethod(serviceMethod) {
+			continue
+		}
+		if r.allows(p) {
+			return nil
+		}
+		matched = true
+	}
+	switch {
+	case p == nil && matched:
+		return Errorf(Unauthenticated, "rpc server: %s requires authentication", serviceMethod)
+	case p == nil:
+		return Errorf(PermissionDenied, "rpc server: no policy allows %s", serviceMethod)
+	default:
+		return Errorf(PermissionDenied, "rpc server: %s is not allowed to call %s", p.Name, serviceMethod)
+	}
+}
+
+// WithAuth 在调用服务方法之前依次执行认证器并按policy授权
+//
+// 认证失败返回Unauthenticated, 授权失败返回PermissionDenied,
+// 认证通过的调用方可以通过 PrincipalFromContext 获取。policy为nil时只要求认证通过。
+// 认证以拦截器实现, 与其他拦截器按添加顺序执行。
+func WithAuth(policy *Policy, authenticators ...Authenticator) ServerOption {
+	return WithInterceptor(func(ctx context.Context, info *ServerInfo, next Handler) error {
+		var principal *Principal
+		for _, a := range authenticators {
+			p, err := a.Authenticate(ctx, info.ServiceMethod)
+			if err != nil {
+				if CodeOf(err) == Unknown {
+					err = Errorf(Unauthenticated, "%s", err.Error())
+				}
+				return err
+			}
+			if p != nil {
+				principal = p
+				break
+			}
+		}
+		if policy != nil {
+			if err := policy.Authorize(principal, info.ServiceMethod); err != nil {
+				return err
+			}
+		} else if principal == nil {
+			return Errorf(Unauthenticated, "rpc server: %s requires authentication", info.ServiceMethod)
+		}
+		if principal != nil {
+			ctx = context.WithValue(ctx, principalKey{}, principal)
+		}
+		return next(ctx)
+	})
+}
+
+// Credentials 客户端每次调用附带的凭证, 通过 Option.Credentials 配置
+type Credentials interface {
+	// RequestMetadata 返回随调用serviceMethod发送的元数据
+	RequestMetadata(serviceMethod string) (Metadata, error)
+}
+
+// BearerToken 以 "authorization: Bearer <token>" 发送的凭证
+type BearerToken string
+
+// RequestMetadata implements Credentials
+func (t BearerToken) RequestMetadata(serviceMethod string) (Metadata, error) {
+	return Metadata{AuthorizationKey: "Bearer " + string(t)}, nil
+}
+
+// HMACCredentials 对每次调用做HMAC-SHA256签名的凭证, 签名覆盖方法名、时间戳和随机数, 不覆盖参数
+type HMACCredentials struct {
+	KeyID string
+	Key   []byte
+}
+
+// RequestMetadata implements Credentials
+func (c HMACCredentials) RequestMetadata(serviceMethod string) (Metadata, error) {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, err
+	}
+	nonce := hex.EncodeToString(b[:])
+	return Metadata{
+		HMACKeyIDKey:     c.KeyID,
+		HMACTimestampKey: ts,
+		HMACNonceKey:     nonce,
+		HMACSignatureKey: hmacSignature(c.Key, serviceMethod, ts, nonce),
+	}, nil
+}
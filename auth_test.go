@@ -0,0 +1,117 @@
+package GeeRPC
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+// Admin 只允许admin角色调用
+type Admin int
+
+func (a Admin) Whoami(ctx context.Context, arg int, reply *string) error {
+	if p, ok := PrincipalFromContext(ctx); ok {
+		*reply = p.Name
+	}
+	return nil
+}
+
+func TestAuth(t *testing.T) {
+	t.Parallel()
+	policy := &Policy{Rules: []Rule{
+		{Methods: []string{"Foo.*"}, Roles: []string{"reader", "admin"}},
+		{Methods: []string{"Admin.*"}, Roles: []string{"admin"}},
+	}}
+	server := NewServer(WithAuth(policy,
+		BearerTokenAuthenticator(map[string]*Principal{
+			"tok-alice": {Name: "alice", Roles: []string{"reader"}},
+			"tok-bob":   {Name: "bob", Roles: []string{"admin"}},
+		}),
+		&HMACAuthenticator{Keys: map[string][]byte{"svc": []byte("secret")}, Principals: map[string]*Principal{
+			"svc": {Name: "batch-job", Roles: []string{"admin"}},
+		}},
+	))
+	var foo Foo
+	var admin Admin
+	_ = server.Register(&foo)
+	_ = server.Register(&admin)
+	l, _ := net.Listen("tcp", ":0")
+	defer func() { _ = l.Close() }()
+	go server.Accept(l)
+
+	dial := func(creds Credentials) *Client {
+		client, err := Dial("tcp", l.Addr().String(), &Option{Credentials: creds})
+		_assert(err == nil, "dial failed: %v", err)
+		t.Cleanup(func() { _ = client.Close() })
+		return client
+	}
+	sum := func(client *Client) error {
+		var reply int
+		return client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	}
+	whoami := func(client *Client) (string, error) {
+		var reply string
+		err := client.Call(context.Background(), "Admin.Whoami", 0, &reply)
+		return reply, err
+	}
+
+	err := sum(dial(nil))
+	_assert(CodeOf(err) == Unauthenticated, "expect Unauthenticated without credentials, got %v", err)
+	err = sum(dial(BearerToken("bogus")))
+	_assert(CodeOf(err) == Unauthenticated, "expect Unauthenticated for a bad token, got %v", err)
+
+	alice := dial(BearerToken("tok-alice"))
+	_assert(sum(alice) == nil, "expect reader to call Foo.Sum")
+	_, err = whoami(alice)
+	_assert(CodeOf(err) == PermissionDenied, "expect PermissionDenied for reader on Admin, got %v", err)
+
+	name, err := whoami(dial(BearerToken("tok-bob")))
+	_assert(err == nil && name == "bob", "expect admin to call Admin.Whoami, got %q %v", name, err)
+
+	name, err = whoami(dial(HMACCredentials{KeyID: "svc", Key: []byte("secret")}))
+	_assert(err == nil && name == "batch-job", "expect hmac principal, got %q %v", name, err)
+	_, err = whoami(dial(HMACCredentials{KeyID: "svc", Key: []byte("wrong")}))
+	_assert(CodeOf(err) == Unauthenticated, "expect Unauthenticated for a bad signature, got %v", err)
+
+	// 元数据中的token同样有效
+	ctx := WithMetadata(context.Background(), Metadata{AuthorizationKey: "Bearer tok-alice"})
+	var reply int
+	err = dial(nil).Call(ctx, "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "expect token from metadata to work, got %v", err)
+}
+
+func TestTLSAuthenticator(t *testing.T) {
+	a := TLSAuthenticator(func(identity string) []string { return []string{"admin"} })
+	ctx := context.WithValue(context.Background(), peerKey{}, &Peer{Identity: "alice"})
+	p, err := a.Authenticate(ctx, "Admin.Whoami")
+	_assert(err == nil && p.Name == "alice" && p.Roles[0] == "admin", "expect principal from peer identity")
+	p, err = a.Authenticate(context.Background(), "Admin.Whoami")
+	_assert(err == nil && p == nil, "expect no principal without peer identity")
+}
+
+func TestPolicy_anonymous(t *testing.T) {
+	policy := &Policy{Rules: []Rule{{Methods: []string{"Public.*"}, Anonymous: true}}}
+	_assert(policy.Authorize(nil, "Public.Ping") == nil, "expect anonymous access to public methods")
+	err := policy.Authorize(nil, "Foo.Sum")
+	_assert(CodeOf(err) == PermissionDenied, "expect unmatched methods to be denied, got %v", err)
+}
+
+// TestHMACAuthenticator_replay 测试同一个签名只能使用一次
+func TestHMACAuthenticator_replay(t *testing.T) {
+	a := &HMACAuthenticator{Keys: map[string][]byte{"svc": []byte("secret")}}
+	creds := HMACCredentials{KeyID: "svc", Key: []byte("secret")}
+	md, err := creds.RequestMetadata("Foo.Sum")
+	_assert(err == nil, "sign failed: %v", err)
+	ctx := context.WithValue(context.Background(), incomingMetadataKey{}, md)
+	p, err := a.Authenticate(ctx, "Foo.Sum")
+	_assert(err == nil && p.Name == "svc", "expect the first use to pass, got %v", err)
+	_, err = a.Authenticate(ctx, "Foo.Sum")
+	_assert(CodeOf(err) == Unauthenticated, "expect a replayed signature to be refused, got %v", err)
+
+	md, _ = creds.RequestMetadata("Foo.Sum")
+	_, err = a.Authenticate(context.WithValue(context.Background(), incomingMetadataKey{}, md), "Admin.Whoami")
+	_assert(CodeOf(err) == Unauthenticated, "expect a signature for another method to be refused, got %v", err)
+	delete(md, HMACNonceKey)
+	_, err = a.Authenticate(context.WithValue(context.Background(), incomingMetadataKey{}, md), "Foo.Sum")
+	_assert(CodeOf(err) == Unauthenticated, "expect a signature without nonce to be refused, got %v", err)
+}
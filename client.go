@@ -5,17 +5,19 @@ package GeeRPC
 
 import (
 	"GeeRPC/codec"
+	"GeeRPC/mux"
 	"bufio"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -29,17 +31,37 @@ type Call struct {
 	Args interface{}
 	// Reply 传出参数-返回值
 	Reply interface{}
+	// Metadata 请求元数据
+	Metadata Metadata
 	// Error 错误信息
 	Error error
 	// Done 完成通知的channel，用于支持异步调用, 当调用结束后通知调用方
 	Done chan *Call
+	// stream 流式调用接收消息的一侧, 普通调用为nil
+	stream *ClientStream
+	// observe 调用结束时记录指标, 没有配置 Option.Metrics 时为nil
+	observe func(err error)
+	// sent, received 请求体和响应体在连接上的字节数, 用于追踪, 编解码器不统计时为0; 原子读写
+	sent, received int64
 }
 
 // done 支持异步调用, 当调用结束后通知调用方
 func (call *Call) done() {
+	call.record(call.Error)
+	if call.stream != nil {
+		call.stream.finish(call.Error)
+	}
 	call.Done <- call
 }
 
+// record 以err结束调用的指标, 只记录一次
+func (call *Call) record(err error) {
+	if call.observe != nil {
+		call.observe(err)
+		call.observe = nil
+	}
+}
+
 // Client represents an RPC Client.
 type Client struct {
 	// cc 消息的编解码器
@@ -60,6 +82,14 @@ type Client struct {
 	closing bool
 	// shutdown 错误发生连接被关闭
 	shutdown bool
+	// mux 多路复用会话, 不为nil时每个调用使用独立的流, cc不再使用
+	mux *mux.Session
+	// newCodec 多路复用时为每个流创建编解码器
+	newCodec codec.NewCodecFunc
+	// callback 处理服务端发起的调用, 为nil时这些调用返回 Unimplemented
+	callback *Server
+	// remote 服务端地址, 用于span的属性
+	remote string
 }
 
 // clientResult 存储client和error
@@ -72,6 +102,9 @@ var _ io.Closer = (*Client)(nil)
 
 var ErrShutdown = errors.New("connection is shut down")
 
+// ErrCanceled 调用被 Client.Cancel 取消
+var ErrCanceled = errors.New("rpc client: call canceled")
+
 // IsAvailable return true if the client does work
 func (client *Client) IsAvailable() bool {
 	client.mu.Lock()
@@ -108,7 +141,8 @@ func (client *Client) terminateCalls(err error) {
 	client.mu.Lock()
 	defer client.mu.Unlock()
 	client.shutdown = true
-	for _, call := range client.pending {
+	for seq, call := range client.pending {
+		delete(client.pending, seq) // 避免之后被Cancel重复通知
 		call.Error = err
 		call.done()
 	}
@@ -122,29 +156,51 @@ func (client *Client) receive() {
 		if err = client.cc.ReadHeader(&h); err != nil { // 读取响应头
 			break
 		}
-		call := client.removeCall(h.Seq) // 从pending中移除请求并接收
-		switch {
-		case call == nil: // call已经被移除
-			// 通常意味着Write部分失败并且已经删除了调用
-			err = client.cc.ReadBody(nil) // 读取响应体
-		case h.Error != "": // 服务端处理请求出错
-			call.Error = fmt.Errorf(h.Error)
-			err = client.cc.ReadBody(nil)
-			call.done() // 通知调用方
-		default:
-			err = client.cc.ReadBody(call.Reply) // 读取响应体
-			if err != nil {                      // 读取响应体出错
-				call.Error = errors.New("reading body " + err.Error())
-			}
-			call.done() // 通知调用方
+		if h.Flags&codec.FlagReverse != 0 { // 服务端发起的调用
+			err = client.serveCallback(&h)
+			continue
 		}
+		var handled bool // 流式调用的消息或额度, 调用尚未结束
+		if handled, err = client.receiveStreamFrame(&h, client.cc.ReadBody); handled {
+			continue
+		}
+		err = client.handleResponse(&h, client.cc.ReadBody)
 	}
 	// 错误发生，将所有未处理完的请求移除
 	client.terminateCalls(err)
 }
 
+// handleResponse 从pending中移除h对应的请求, 读取响应体并通知调用方
+func (client *Client) handleResponse(h *codec.Header, readBody func(interface{}) error) (err error) {
+	call := client.removeCall(h.Seq) // 从pending中移除请求并接收
+	switch {
+	case call == nil: // call已经被移除
+		// 通常意味着Write部分失败并且已经删除了调用
+		err = readBody(nil) // 读取响应体
+	case h.Error != "": // 服务端处理请求出错
+		call.Error = headerError(h)
+		err = readBody(nil)
+		call.done() // 通知调用方
+	default:
+		err = readBody(call.Reply)                    // 读取响应体
+		if errors.Is(err, codec.ErrMessageTooLarge) { // 超限的响应体已被跳过, 连接仍可使用
+			call.Error, err = sizeError(err), nil
+		} else if err != nil { // 读取响应体出错
+			call.Error = errors.New("reading body " + err.Error())
+		} else {
+			atomic.StoreInt64(&call.received, readSize(client.cc))
+		}
+		call.done() // 通知调用方
+	}
+	return err
+}
+
 // send 发送请求
 func (client *Client) send(call *Call) {
+	if client.mux != nil {
+		client.sendStream(call)
+		return
+	}
 	// 确保客户端发送完整的请求
 	client.sending.Lock()
 	defer client.sending.Unlock()
@@ -161,63 +217,131 @@ func (client *Client) send(call *Call) {
 	client.header.ServiceMethod = call.ServiceMethod
 	client.header.Seq = seq
 	client.header.Error = ""
+	client.header.Metadata = call.Metadata
 
 	// 编码并发送请求
 	if err := client.cc.Write(&client.header, call.Args); err != nil {
 		call := client.removeCall(seq)
 		// call可能为nil，通常意味着Write部分失败，client收到响应并处理
 		if call != nil {
-			call.Error = err
+			call.Error = sizeError(err)
 			call.done()
 		}
+		return
 	}
+	atomic.StoreInt64(&call.sent, writeSize(client.cc))
 }
 
 // Go 异步调用
 func (client *Client) Go(serviceMethod string, args, reply interface{}, done chan *Call) *Call {
+	return client.GoContext(context.Background(), serviceMethod, args, reply, done)
+}
+
+// GoContext 异步调用, ctx中的元数据随请求发送到服务端
+func (client *Client) GoContext(ctx context.Context, serviceMethod string, args, reply interface{}, done chan *Call) *Call {
 	if done == nil {
 		done = make(chan *Call, 1) // 无缓冲通道
 	} else if cap(done) == 0 {
-		log.Panic("rpc client: done channel is unbuffered")
+		panic("rpc client: done channel is unbuffered")
 	}
 	call := &Call{
 		ServiceMethod: serviceMethod,
 		Args:          args,
 		Reply:         reply,
+		Metadata:      MetadataFromContext(ctx),
 		Done:          done,
+		observe:       client.opt.Metrics.begin(sideClient, serviceMethod),
+	}
+	client.startSpan(ctx, call)
+	client.logCall(call)
+	if err := client.prepare(call); err != nil {
+		return call
 	}
 	client.send(call)
 	return call
 }
 
+// prepare 为请求附带凭证, 失败时以该错误结束调用
+func (client *Client) prepare(call *Call) error {
+	if client.opt.Credentials == nil {
+		return nil
+	}
+	md, err := client.opt.Credentials.RequestMetadata(call.ServiceMethod)
+	if err != nil {
+		call.Error = err
+		call.done()
+		return err
+	}
+	call.Metadata = call.Metadata.merge(md)
+	return nil
+}
+
 // Call 同步调用
 func (client *Client) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
-	call := <-client.Go(serviceMethod, args, reply, make(chan *Call, 1)).Done // 从done通道中阻塞读取响应
+	call := client.GoContext(ctx, serviceMethod, args, reply, make(chan *Call, 1))
 	select {
 	case <-ctx.Done(): // 超时
-		client.removeCall(call.Seq)
+		if call := client.removeCall(call.Seq); call != nil {
+			code := Canceled
+			if ctx.Err() == context.DeadlineExceeded {
+				code = DeadlineExceeded
+			}
+			call.record(Errorf(code, "%v", ctx.Err()))
+		}
 		return errors.New("rpc client: call failed: " + ctx.Err().Error())
-	case call := <-call.Done: // 读取响应
+	case call := <-call.Done: // 从done通道中阻塞读取响应
 		return call.Error
 	}
 }
 
+// Cancel 取消一个尚未完成的调用
+//
+// 调用从pending中移除, 并以 ErrCanceled 通知调用方; 若调用为nil、从未注册成功或已经完成则不做任何事。
+// 服务端仍可能执行该请求, 其响应到达后会被丢弃。
+func (client *Client) Cancel(call *Call) {
+	if call == nil || call.Seq == 0 { // 请求编号从1开始, 0表示未注册的请求
+		return
+	}
+	if call = client.removeCall(call.Seq); call != nil {
+		call.Error = ErrCanceled
+		call.done()
+	}
+}
+
 // NewClient 创建Client
 func NewClient(conn net.Conn, opt *Option) (*Client, error) {
-	f := codec.NewCodecFuncMap[opt.CodecType] // 根据编解码类型获取对应的编解码器
-	if f == nil {                             // 如果编解码器不存在，则返回错误
-		err := fmt.Errorf("invalid codec type %s", opt.CodecType)
-		log.Println("rpc client: codec error:", err)
+	f, err := opt.newCodecFunc() // 根据编解码类型和压缩算法获取对应的编解码器
+	if err != nil {              // 如果编解码器不存在，则返回错误
+		opt.logger().Error("rpc client: codec error", "error", err)
 		return nil, err
 	}
+	rw := opt.Metrics.meterConn(sideClient, conn)
+	var cc codec.Codec
+	if !opt.Multiplex { // 多路复用时每个流的编解码器在调用时创建和检查
+		// f(rw)是一个编解码器，将连接作为参数传入，返回一个编解码器
+		cc = f(rw)
+		if err := opt.limitCodec(cc); err != nil { // 不支持大小限制的编解码器不能在没有限制的情况下使用
+			opt.logger().Error("rpc client: codec error", "error", err)
+			_ = rw.Close()
+			return nil, err
+		}
+	}
 	// send options with server
-	if err := json.NewEncoder(conn).Encode(opt); err != nil { // 将编解码器类型发送给服务端
-		log.Println("rpc client: options error: ", err)
-		_ = conn.Close()
+	if err := json.NewEncoder(rw).Encode(opt); err != nil { // 将编解码器类型发送给服务端
+		opt.logger().Error("rpc client: options error", "remote", conn.RemoteAddr(), "error", err)
+		_ = rw.Close()
 		return nil, err
 	}
-	// f(conn)是一个编解码器，将conn作为参数传入，返回一个编解码器
-	return newClientCodec(f(conn), opt), nil // 创建Client
+	var client *Client
+	if opt.Multiplex {
+		client = newMuxClient(rw, f, opt)
+	} else {
+		client = newClientCodec(cc, opt) // 创建Client
+	}
+	if addr := conn.RemoteAddr(); addr != nil {
+		client.remote = addr.String()
+	}
+	return client, nil
 }
 
 // newClientCodec 创建Client的编解码器
@@ -234,35 +358,7 @@ func newClientCodec(cc codec.Codec, opt *Option) *Client {
 
 // Dial 连接服务端
 func Dial(network, address string, opts ...*Option) (client *Client, err error) {
-	opt, err := parseOptions(opts...)
-	if err != nil {
-		return nil, err
-	}
-	conn, err := net.DialTimeout(network, address, opt.ConnectTimeout) // 建立连接
-	if err != nil {
-		return nil, err
-	}
-	// close the connection if client is nil
-	defer func() {
-		if client == nil { // 如果client为nil，则关闭连接
-			_ = conn.Close()
-		}
-	}()
-	ch := make(chan clientResult) // 创建通道
-	go func() {
-		client, err = NewClient(conn, opt) // 创建客户端
-		ch <- clientResult{client: client, err: err}
-	}()
-	if opt.ConnectTimeout == 0 { // 如果没有设置连接超时，则直接返回
-		result := <-ch
-		return result.client, result.err
-	}
-	select {
-	case <-time.After(opt.ConnectTimeout): // 超时
-		return nil, fmt.Errorf("rpc client: connect timeout: expect within %s", opt.ConnectTimeout)
-	case result := <-ch: // 从通道中读取结果
-		return result.client, result.err
-	}
+	return dialTimeout(NewClient, network, address, opts...)
 }
 
 // Close 关闭连接
@@ -272,18 +368,21 @@ func (client *Client) Close() error {
 	if client.closing {      // 如果已经关闭，则返回错误
 		return ErrShutdown
 	}
-	client.closing = true    // 设置关闭标志
+	client.closing = true // 设置关闭标志
+	if client.mux != nil {
+		return client.mux.Close() // 关闭会话和所有的流
+	}
 	return client.cc.Close() // 关闭Codec编解码器
 }
 
 // parseOptions 解析可选可变长参数
 //
-// Option {
-// 	MagicNumber:    MagicNumber,
-// 	CodecType:      codec.GobType,
-//  ConnectTimeout time.Duration,
-//	HandleTimeout time.Duration
-// }
+//	Option {
+//		MagicNumber:    MagicNumber,
+//		CodecType:      codec.GobType,
+//	 ConnectTimeout time.Duration,
+//		HandleTimeout time.Duration
+//	}
 //
 // 1. 如果opts为空或者opts[0]为空，则返回默认值
 //
@@ -333,7 +432,7 @@ func dialTimeout(f newClientFunc, network, address string, opts ...*Option) (cli
 	if err != nil {
 		return nil, err
 	}
-	conn, err := net.DialTimeout(network, address, opt.ConnectTimeout)
+	conn, err := dialConn(network, address, opt.ConnectTimeout)
 	if err != nil {
 		return nil, err
 	}
@@ -343,7 +442,7 @@ func dialTimeout(f newClientFunc, network, address string, opts ...*Option) (cli
 			_ = conn.Close()
 		}
 	}()
-	ch := make(chan clientResult)
+	ch := make(chan clientResult, 1) // 带缓冲, 超时返回后goroutine不会阻塞
 
 	go func() {
 		client, err := f(conn, opt)
@@ -371,6 +470,14 @@ func XDial(rpcAddr string, opts ...*Option) (*Client, error) {
 	switch parts[0] {
 	case "http":
 		return DialHTTP("tcp", addr, opts...)
+	case "unix", "inproc": // unix@/path/to.sock, inproc@name
+		return Dial(protocol, addr, opts...)
+	case "tls":
+		var config *tls.Config
+		if len(opts) > 0 && opts[0] != nil {
+			config = opts[0].TLSConfig
+		}
+		return DialTLS("tcp", addr, config, opts...)
 	default:
 		return Dial(protocol, addr, opts...)
 	}
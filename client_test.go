@@ -1,6 +1,7 @@
 package GeeRPC
 
 import (
+	"GeeRPC/codec"
 	"context"
 	"net"
 	"strings"
@@ -13,12 +14,18 @@ func TestClient_dialTimeout(t *testing.T) {
 	t.Parallel()
 	l, _ := net.Listen("tcp", ":0")
 
+	// f 模拟一个创建客户端很慢的过程
+	f := func(conn net.Conn, opt *Option) (client *Client, err error) {
+		_ = conn.Close()
+		time.Sleep(time.Millisecond * 200)
+		return nil, nil
+	}
 	t.Run("timeout", func(t *testing.T) {
-		_, err := Dial("tcp", l.Addr().String(), &Option{ConnectTimeout: time.Second})
+		_, err := dialTimeout(f, "tcp", l.Addr().String(), &Option{ConnectTimeout: time.Millisecond * 100})
 		_assert(err != nil && strings.Contains(err.Error(), "connect timeout"), "expect a timeout error")
 	})
 	t.Run("0", func(t *testing.T) {
-		_, err := Dial("tcp", l.Addr().String(), &Option{ConnectTimeout: 0})
+		_, err := dialTimeout(f, "tcp", l.Addr().String(), &Option{ConnectTimeout: 0})
 		_assert(err == nil, "0 means no limit")
 	})
 }
@@ -47,7 +54,8 @@ func TestClient_Call(t *testing.T) {
 	time.Sleep(time.Second)
 	t.Run("client timeout", func(t *testing.T) {
 		client, _ := Dial("tcp", addr)
-		ctx, _ := context.WithTimeout(context.Background(), time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
 		var reply int
 		err := client.Call(ctx, "Bar.Timeout", 1, &reply)
 		_assert(err != nil && strings.Contains(err.Error(), ctx.Err().Error()), "expect a timeout error")
@@ -62,6 +70,59 @@ func TestClient_Call(t *testing.T) {
 	})
 }
 
+// TestClient_Cancel 测试取消调用
+func TestClient_Cancel(t *testing.T) {
+	t.Parallel()
+	server := NewServer()
+	var b Bar
+	_ = server.Register(&b)
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+	client, err := Dial("tcp", l.Addr().String())
+	_assert(err == nil, "dial failed: %v", err)
+	defer func() { _ = client.Close() }()
+
+	var reply int
+	call := client.Go("Bar.Timeout", 1, &reply, nil)
+	client.Cancel(call)
+	select {
+	case call = <-call.Done:
+		_assert(call.Error == ErrCanceled, "expect ErrCanceled, got %v", call.Error)
+	case <-time.After(time.Second):
+		_assert(false, "canceled call was not notified")
+	}
+	// 重复取消、取消nil或未注册的调用都不应panic
+	client.Cancel(call)
+	client.Cancel(nil)
+	client.Cancel(&Call{Done: make(chan *Call, 1)})
+}
+
+// TestClient_jsonCodec 测试JSON编解码器上的普通调用、流式调用和压缩
+func TestClient_jsonCodec(t *testing.T) {
+	t.Parallel()
+	addr := startTestServer(t).addr
+	for _, opt := range []*Option{
+		{CodecType: codec.JsonType},
+		{CodecType: codec.JsonType, Multiplex: true},
+		{CodecType: codec.JsonType, Compression: codec.Gzip, CompressThreshold: 1},
+	} {
+		client, err := Dial("tcp", addr, opt)
+		_assert(err == nil, "dial failed: %v", err)
+		var sum int
+		err = client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &sum)
+		_assert(err == nil && sum == 3, "call over json failed: %d, %v", sum, err)
+		err = client.Call(context.Background(), "Foo.Missing", Args{}, &sum)
+		_assert(err != nil && strings.Contains(err.Error(), "can't find method"), "expect an unknown method error, got %v", err)
+		stream, err := NewStreamReader[int](context.Background(), client, "Counter.Count", 3)
+		_assert(err == nil, "open stream failed: %v", err)
+		for i := 1; i <= 3; i++ {
+			n, err := stream.Recv()
+			_assert(err == nil && n == i, "expect %d, got %d, %v", i, n, err)
+		}
+		_ = client.Close()
+	}
+}
+
 // TestXDial 测试XDial
 func TestXDial(t *testing.T) {
 	// 测试
@@ -0,0 +1,392 @@
+package GeeRPC
+
+import (
+	"GeeRPC/codec"
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+var errFlowControl = errors.New("rpc client: stream flow control violated")
+
+// ClientStream 客户端一侧的流式调用
+//
+// SendMsg/CloseSend 与 Recv 可以在不同的goroutine中调用, 但各自不能并发调用。
+type ClientStream struct {
+	client *Client
+	call   *Call
+	// newMsg 创建用于解码消息的指针, 为nil时服务端不发送消息
+	newMsg func() interface{}
+	msgs   chan interface{}
+	// credits 还可以发送的消息数
+	credits chan struct{}
+	// ready 请求发出后被关闭, 之后才能发送消息
+	ready chan struct{}
+	// write 在调用所在的连接或流上写入一条消息
+	write func(h *codec.Header, body interface{}) error
+	// consumed Recv读取后尚未归还额度的消息数
+	consumed int
+	// finished 调用结束时被关闭, 之后err不再改变
+	finished chan struct{}
+	once     sync.Once
+	err      error
+}
+
+// NewStream 发起服务端流式调用, newMsg创建用于解码每条消息的指针, 如 func() interface{} { return new(int) }
+//
+// 消息通过Recv读取, 不再读取时应调用Close通知服务端停止发送。
+func (client *Client) NewStream(ctx context.Context, serviceMethod string, args interface{}, newMsg func() interface{}) (*ClientStream, error) {
+	return client.newStream(ctx, serviceMethod, args, nil, newMsg)
+}
+
+// newStream 发起流式调用, args为nil时请求体为空(客户端流和双向流), reply接收调用结束时的响应
+func (client *Client) newStream(ctx context.Context, serviceMethod string, args, reply interface{}, newMsg func() interface{}) (*ClientStream, error) {
+	if args == nil {
+		args = invalidRequest
+	}
+	cs := &ClientStream{
+		client:   client,
+		newMsg:   newMsg,
+		credits:  make(chan struct{}, streamWindow),
+		ready:    make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	for i := 0; i < streamWindow; i++ {
+		cs.credits <- struct{}{}
+	}
+	if newMsg != nil {
+		cs.msgs = make(chan interface{}, streamWindow)
+	}
+	cs.call = &Call{
+		ServiceMethod: serviceMethod,
+		Args:          args,
+		Reply:         reply,
+		Metadata:      MetadataFromContext(ctx),
+		Done:          make(chan *Call, 1),
+		stream:        cs,
+		observe:       client.opt.Metrics.begin(sideClient, serviceMethod),
+	}
+	client.startSpan(ctx, cs.call)
+	client.logCall(cs.call)
+	if err := client.prepare(cs.call); err != nil {
+		return nil, err
+	}
+	client.send(cs.call)
+	if client.mux == nil { // 多路复用时由roundTrip在请求发出后准备
+		cs.write = client.writeFrame
+		close(cs.ready)
+	}
+	select {
+	case <-cs.finished: // 发送失败
+		if cs.err != io.EOF {
+			return nil, cs.err
+		}
+	default:
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			cs.Close()
+		case <-cs.finished:
+		}
+	}()
+	return cs, nil
+}
+
+// SendMsg 向服务端发送一条消息, 服务端来不及接收时阻塞, 消息超过 Option.MaxRequestSize 时返回ResourceExhausted
+//
+// 调用已经结束时返回io.EOF, 结束的原因由Recv(或StreamWriter.CloseAndRecv)返回。
+func (cs *ClientStream) SendMsg(m interface{}) error {
+	select {
+	case <-cs.finished:
+		return io.EOF
+	default:
+	}
+	select {
+	case <-cs.ready:
+	case <-cs.finished:
+		return io.EOF
+	}
+	select {
+	case <-cs.credits:
+	case <-cs.finished:
+		return io.EOF
+	}
+	err := cs.write(&codec.Header{Seq: cs.call.Seq, Flags: codec.FlagStream}, m)
+	if errors.Is(err, codec.ErrMessageTooLarge) { // 超限的消息没有发出, 额度仍然可用, 调用可以继续
+		cs.grant(1)
+		return sizeError(err)
+	}
+	return err
+}
+
+// CloseSend 半关闭, 告诉服务端不会再发送消息, 之后仍可以Recv
+func (cs *ClientStream) CloseSend() error {
+	select {
+	case <-cs.ready:
+	case <-cs.finished:
+		return nil
+	}
+	return cs.write(&codec.Header{Seq: cs.call.Seq, Flags: codec.FlagStream | codec.FlagEndStream}, invalidRequest)
+}
+
+// Recv 读取下一条消息, 流正常结束时返回io.EOF, 否则返回调用的错误
+func (cs *ClientStream) Recv() (interface{}, error) {
+	var m interface{}
+	select {
+	case m = <-cs.msgs:
+	case <-cs.finished:
+		select { // 结束前收到的消息仍然有效
+		case m = <-cs.msgs:
+		default:
+			return nil, cs.err
+		}
+	}
+	cs.ack()
+	return m, nil
+}
+
+// ack Recv消费了一条消息, 攒够半个窗口后把额度归还给服务端
+func (cs *ClientStream) ack() {
+	if cs.consumed++; cs.consumed < streamWindow/2 {
+		return
+	}
+	n := cs.consumed
+	cs.consumed = 0
+	select {
+	case <-cs.finished:
+	case <-cs.ready: // 收到消息时请求一定已经发出
+		_ = cs.write(&codec.Header{Seq: cs.call.Seq, Flags: codec.FlagWindow}, uint32(n))
+	}
+}
+
+// wait 等待调用结束, 返回调用的错误, 正常结束时为nil
+func (cs *ClientStream) wait() error {
+	<-cs.finished
+	if cs.err == io.EOF {
+		return nil
+	}
+	return cs.err
+}
+
+// Close 放弃尚未读取的消息, 结束调用, 并通知服务端停止
+func (cs *ClientStream) Close() {
+	seq := cs.call.Seq
+	select {
+	case <-cs.finished: // 调用已经结束
+		return
+	default:
+	}
+	cs.client.Cancel(cs.call)
+	if cs.client.mux == nil { // 多路复用时由roundTrip重置流
+		cs.client.sendCancel(seq)
+	}
+}
+
+// finish 调用结束, err为nil时Recv最终返回io.EOF
+func (cs *ClientStream) finish(err error) {
+	cs.once.Do(func() {
+		if err == nil {
+			err = io.EOF
+		}
+		cs.err = err
+		close(cs.finished)
+	})
+}
+
+// grant 服务端归还了n个发送额度
+func (cs *ClientStream) grant(n int) {
+	for i := 0; i < n; i++ {
+		select {
+		case cs.credits <- struct{}{}:
+		default:
+			return
+		}
+	}
+}
+
+// push 解码一条消息并交给Recv, 服务端超出窗口时返回false
+func (cs *ClientStream) push(readBody func(interface{}) error) (bool, error) {
+	if cs.newMsg == nil {
+		return true, readBody(nil)
+	}
+	m := cs.newMsg()
+	if err := readBody(m); err != nil {
+		return true, err
+	}
+	select {
+	case cs.msgs <- m:
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// writeFrame 在连接上写入一条流式调用的控制消息或数据消息
+func (client *Client) writeFrame(h *codec.Header, body interface{}) error {
+	client.sending.Lock()
+	defer client.sending.Unlock()
+	return client.cc.Write(h, body)
+}
+
+// sendCancel 通知服务端取消seq对应的流式调用
+func (client *Client) sendCancel(seq uint64) {
+	_ = client.writeFrame(&codec.Header{Seq: seq, Flags: codec.FlagCancel}, invalidRequest)
+}
+
+// pendingStream 返回seq对应的进行中的流式调用
+func (client *Client) pendingStream(seq uint64) *ClientStream {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if call := client.pending[seq]; call != nil {
+		return call.stream
+	}
+	return nil
+}
+
+// receiveStreamFrame 处理流式调用中间的消息和额度, h为调用的最终响应时返回false
+func (client *Client) receiveStreamFrame(h *codec.Header, readBody func(interface{}) error) (bool, error) {
+	switch {
+	case h.Flags&codec.FlagWindow != 0:
+		var n uint32
+		if err := readBody(&n); err != nil {
+			return true, err
+		}
+		if cs := client.pendingStream(h.Seq); cs != nil {
+			cs.grant(int(n))
+		}
+		return true, nil
+	case !isStreamMsg(h):
+		return false, nil
+	}
+	cs := client.pendingStream(h.Seq)
+	if cs == nil { // 调用已被取消
+		return true, readBody(nil)
+	}
+	ok, err := cs.push(readBody)
+	var callErr error
+	switch {
+	case errors.Is(err, codec.ErrMessageTooLarge): // 超限的消息已被跳过, 只结束该调用
+		callErr, err = sizeError(err), nil
+	case err == nil && !ok: // 服务端不遵守流控, 结束该调用
+		callErr = errFlowControl
+	}
+	if callErr != nil {
+		if call := client.removeCall(h.Seq); call != nil {
+			call.Error = callErr
+			call.done()
+		}
+		if client.mux == nil { // 通知服务端停止发送, 多路复用时由roundTrip重置流
+			client.sendCancel(h.Seq)
+		}
+	}
+	return true, err
+}
+
+// StreamReader 带类型的服务端流式调用
+type StreamReader[R any] struct {
+	cs *ClientStream
+}
+
+// NewStreamReader 发起服务端流式调用, 每条消息的类型为R
+func NewStreamReader[R any](ctx context.Context, client *Client, serviceMethod string, args interface{}) (*StreamReader[R], error) {
+	cs, err := client.NewStream(ctx, serviceMethod, args, func() interface{} { return new(R) })
+	if err != nil {
+		return nil, err
+	}
+	return &StreamReader[R]{cs: cs}, nil
+}
+
+// Recv 读取下一条消息, 流正常结束时返回io.EOF
+func (r *StreamReader[R]) Recv() (R, error) {
+	m, err := r.cs.Recv()
+	if err != nil {
+		var zero R
+		return zero, err
+	}
+	return *m.(*R), nil
+}
+
+// Close 放弃尚未读取的消息, 结束调用
+func (r *StreamReader[R]) Close() {
+	r.cs.Close()
+}
+
+// StreamWriter 带类型的客户端流式调用, 发送任意多条A后得到一个R
+type StreamWriter[A, R any] struct {
+	cs    *ClientStream
+	reply *R
+}
+
+// NewStreamWriter 发起客户端流式调用
+func NewStreamWriter[A, R any](ctx context.Context, client *Client, serviceMethod string) (*StreamWriter[A, R], error) {
+	reply := new(R)
+	cs, err := client.newStream(ctx, serviceMethod, nil, reply, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &StreamWriter[A, R]{cs: cs, reply: reply}, nil
+}
+
+// Send 发送一条消息, 返回io.EOF时调用已经结束, 由CloseAndRecv得到原因
+func (w *StreamWriter[A, R]) Send(a A) error {
+	return w.cs.SendMsg(a)
+}
+
+// CloseAndRecv 半关闭并等待服务端的响应
+func (w *StreamWriter[A, R]) CloseAndRecv() (R, error) {
+	if err := w.cs.CloseSend(); err != nil {
+		var zero R
+		return zero, err
+	}
+	if err := w.cs.wait(); err != nil {
+		var zero R
+		return zero, err
+	}
+	return *w.reply, nil
+}
+
+// Close 放弃调用
+func (w *StreamWriter[A, R]) Close() {
+	w.cs.Close()
+}
+
+// BidiClient 带类型的双向流式调用, 发送A并接收R
+type BidiClient[A, R any] struct {
+	cs *ClientStream
+}
+
+// NewBidiClient 发起双向流式调用
+func NewBidiClient[A, R any](ctx context.Context, client *Client, serviceMethod string) (*BidiClient[A, R], error) {
+	cs, err := client.newStream(ctx, serviceMethod, nil, nil, func() interface{} { return new(R) })
+	if err != nil {
+		return nil, err
+	}
+	return &BidiClient[A, R]{cs: cs}, nil
+}
+
+// Send 发送一条消息, 返回io.EOF时调用已经结束, 由Recv得到原因
+func (b *BidiClient[A, R]) Send(a A) error {
+	return b.cs.SendMsg(a)
+}
+
+// Recv 读取下一条消息, 流正常结束时返回io.EOF
+func (b *BidiClient[A, R]) Recv() (R, error) {
+	m, err := b.cs.Recv()
+	if err != nil {
+		var zero R
+		return zero, err
+	}
+	return *m.(*R), nil
+}
+
+// CloseSend 半关闭, 之后仍可以Recv
+func (b *BidiClient[A, R]) CloseSend() error {
+	return b.cs.CloseSend()
+}
+
+// Close 放弃调用
+func (b *BidiClient[A, R]) Close() {
+	b.cs.Close()
+}
@@ -0,0 +1,351 @@
+// Command geerpc-bench 以固定并发或固定QPS压测一个方法, 输出吞吐量、延迟分位数和按错误码统计的错误
+//
+// 用法:
+//
+//	geerpc-bench [flags] <address> [Service.Method]
+//
+// address使用 GeeRPC.XDial 的格式; 方法默认为 geerpc-echo 的 Echo.Echo, 参数为 -payload 字节的数据,
+// 或者 -args 给出的JSON。参数和返回值的类型与 geerpc 一样由服务端的反射服务得到。
+// 压测在 -d 时间或 -n 个请求之后结束, 以先到者为准。调整 -codec、-multiplex、-compress 和地址的协议
+// 可以比较编解码器和传输方式, 比较服务端的执行模式见 geerpc-echo 的 -workers。
+package main
+
+import (
+	"GeeRPC"
+	"GeeRPC/codec"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// config 压测的参数
+type config struct {
+	address, method string
+	opt             GeeRPC.Option
+	conns           int
+	concurrency     int
+	qps             int
+	duration        time.Duration
+	requests        int64
+	timeout         time.Duration
+	args            []byte
+}
+
+// result 一个worker或整个压测的结果
+type result struct {
+	latencies []time.Duration
+	// errors 按错误码统计的错误数, samples为每种错误码的第一条错误信息
+	errors  map[GeeRPC.Code]int
+	samples map[GeeRPC.Code]string
+	elapsed time.Duration
+}
+
+// codecTypes -codec的取值
+var codecTypes = map[string]codec.Type{"gob": codec.GobType, "json": codec.JsonType}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run 执行压测, 返回退出码: 0完成(即使有调用失败), 1无法开始压测, 2用法错误
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("geerpc-bench", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	codecName := fs.String("codec", "gob", "codec: gob or json")
+	multiplex := fs.Bool("multiplex", false, "multiplex calls over each connection")
+	compression := fs.String("compress", "", "compression, such as gzip; empty for none")
+	conns := fs.Int("conns", 1, "number of connections")
+	concurrency := fs.Int("c", 10, "number of concurrent callers, spread over the connections")
+	qps := fs.Int("qps", 0, "total requests per second, 0 to call as fast as the callers can")
+	duration := fs.Duration("d", 10*time.Second, "duration of the run, 0 for no limit")
+	requests := fs.Int64("n", 0, "number of requests, 0 for no limit")
+	timeout := fs.Duration("timeout", 5*time.Second, "timeout of the connections and of each call")
+	payload := fs.Int("payload", 64, "size of the random []byte argument")
+	argsJSON := fs.String("args", "", "arguments as JSON, replacing -payload")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: geerpc-bench [flags] <address> [Service.Method]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	ct, ok := codecTypes[*codecName]
+	if fs.NArg() < 1 || fs.NArg() > 2 || !ok || *conns < 1 || *concurrency < 1 || *qps < 0 || (*duration <= 0 && *requests <= 0) {
+		fs.Usage()
+		return 2
+	}
+	cfg := &config{
+		address:     fs.Arg(0),
+		method:      "Echo.Echo",
+		opt:         GeeRPC.Option{CodecType: ct, ConnectTimeout: *timeout, Multiplex: *multiplex, Compression: *compression},
+		conns:       *conns,
+		concurrency: *concurrency,
+		qps:         *qps,
+		duration:    *duration,
+		requests:    *requests,
+		timeout:     *timeout,
+		args:        []byte(*argsJSON),
+	}
+	if fs.NArg() == 2 {
+		cfg.method = fs.Arg(1)
+	}
+	if *argsJSON == "" {
+		data := make([]byte, *payload)
+		_, _ = rand.Read(data)
+		cfg.args, _ = json.Marshal(data)
+	}
+	res, err := bench(cfg)
+	if err != nil {
+		fmt.Fprintln(stderr, "geerpc-bench:", err)
+		return 1
+	}
+	report(stdout, cfg, res)
+	return 0
+}
+
+// bench 建立连接并执行压测
+func bench(cfg *config) (*result, error) {
+	if !json.Valid(cfg.args) {
+		return nil, errors.New("arguments are not valid JSON")
+	}
+	clients := make([]*GeeRPC.Client, 0, cfg.conns)
+	defer func() {
+		for _, client := range clients {
+			_ = client.Close()
+		}
+	}()
+	for i := 0; i < cfg.conns; i++ {
+		opt := cfg.opt
+		client, err := GeeRPC.XDial(cfg.address, &opt)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	newArgs, newReply, err := prepare(clients[0], cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	if cfg.duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.duration)
+		defer cancel()
+	}
+	var tokens <-chan struct{}
+	if cfg.qps > 0 {
+		tokens = pace(ctx, cfg.qps, cfg.concurrency)
+	}
+	remaining := cfg.requests
+	results := make([]*result, cfg.concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := range results {
+		res := newResult()
+		results[i] = res
+		client := clients[i%len(clients)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if tokens != nil {
+					select {
+					case <-tokens:
+					case <-ctx.Done():
+						return
+					}
+				} else if ctx.Err() != nil {
+					return
+				}
+				if cfg.requests > 0 && atomic.AddInt64(&remaining, -1) < 0 {
+					return
+				}
+				res.add(callOnce(client, cfg, newArgs(), newReply()))
+			}
+		}()
+	}
+	wg.Wait()
+	total := newResult()
+	total.elapsed = time.Since(start)
+	for _, res := range results {
+		total.merge(res)
+	}
+	return total, nil
+}
+
+// prepare 返回创建参数和返回值的函数, 参数都由cfg.args解码而来
+//
+// JSON编解码器直接收发JSON; 其他编解码器按反射服务返回的结构构造参数和返回值的类型。
+func prepare(client *GeeRPC.Client, cfg *config) (func() interface{}, func() interface{}, error) {
+	if cfg.opt.CodecType == codec.JsonType {
+		return func() interface{} { return json.RawMessage(cfg.args) }, func() interface{} { return new(json.RawMessage) }, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+	defer cancel()
+	var schema GeeRPC.MethodSchema
+	if err := client.Call(ctx, GeeRPC.ReflectionService+".DescribeMethod", cfg.method, &schema); err != nil {
+		return nil, nil, err
+	}
+	if schema.Stream != "" {
+		return nil, nil, fmt.Errorf("%s is a streaming method, which is not supported", cfg.method)
+	}
+	argType, err := deref(schema.Arg).Build()
+	if err != nil {
+		return nil, nil, fmt.Errorf("argument type: %w", err)
+	}
+	replyType, err := deref(schema.Reply).Build()
+	if err != nil {
+		return nil, nil, fmt.Errorf("reply type: %w", err)
+	}
+	argv := reflect.New(argType)
+	if err = json.Unmarshal(cfg.args, argv.Interface()); err != nil {
+		return nil, nil, fmt.Errorf("arguments: %w", err)
+	}
+	args := argv.Elem().Interface() // 参数只被编码, 可以在调用之间共享
+	return func() interface{} { return args }, func() interface{} { return reflect.New(replyType).Interface() }, nil
+}
+
+// deref 去掉指针, gob编码时忽略指针, 参数和返回值都按元素类型构造
+func deref(ts *GeeRPC.TypeSchema) *GeeRPC.TypeSchema {
+	for ts.Kind == "ptr" {
+		ts = ts.Elem
+	}
+	return ts
+}
+
+// pace 按qps发放调用许可, ctx结束时停止; 调用方跟不上时许可不会累积超过burst个
+func pace(ctx context.Context, qps, burst int) <-chan struct{} {
+	tokens := make(chan struct{}, burst)
+	go func() {
+		interval := time.Second / time.Duration(qps)
+		next := time.Now()
+		timer := time.NewTimer(0)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+			select {
+			case tokens <- struct{}{}:
+			default: // 调用方都在忙, 丢弃许可
+			}
+			next = next.Add(interval)
+			timer.Reset(time.Until(next))
+		}
+	}()
+	return tokens
+}
+
+// callOnce 执行一次调用, 返回其耗时和错误; 调用不受压测结束的影响, 已发出的调用都会完成
+func callOnce(client *GeeRPC.Client, cfg *config, args, reply interface{}) sample {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+	defer cancel()
+	start := time.Now()
+	err := client.Call(ctx, cfg.method, args, reply)
+	return sample{latency: time.Since(start), err: err}
+}
+
+// sample 一次调用的结果
+type sample struct {
+	latency time.Duration
+	err     error
+}
+
+func newResult() *result {
+	return &result{errors: make(map[GeeRPC.Code]int), samples: make(map[GeeRPC.Code]string)}
+}
+
+func (r *result) add(s sample) {
+	r.latencies = append(r.latencies, s.latency)
+	if s.err != nil {
+		code := GeeRPC.CodeOf(s.err)
+		if r.errors[code] == 0 {
+			r.samples[code] = s.err.Error()
+		}
+		r.errors[code]++
+	}
+}
+
+func (r *result) merge(other *result) {
+	r.latencies = append(r.latencies, other.latencies...)
+	for code, n := range other.errors {
+		if r.errors[code] == 0 {
+			r.samples[code] = other.samples[code]
+		}
+		r.errors[code] += n
+	}
+}
+
+// report 输出压测结果
+func report(w io.Writer, cfg *config, r *result) {
+	n := len(r.latencies)
+	fmt.Fprintf(w, "target     %s on %s (codec %s, %d connections, concurrency %d", cfg.method, cfg.address, cfg.opt.CodecType, cfg.conns, cfg.concurrency)
+	if cfg.qps > 0 {
+		fmt.Fprintf(w, ", qps %d", cfg.qps)
+	}
+	if cfg.opt.Multiplex {
+		fmt.Fprint(w, ", multiplexed")
+	}
+	if cfg.opt.Compression != "" {
+		fmt.Fprintf(w, ", %s", cfg.opt.Compression)
+	}
+	fmt.Fprintln(w, ")")
+	fmt.Fprintf(w, "requests   %d in %v, %.1f req/s\n", n, r.elapsed.Round(time.Millisecond), float64(n)/r.elapsed.Seconds())
+	if n > 0 {
+		sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+		var sum time.Duration
+		for _, d := range r.latencies {
+			sum += d
+		}
+		fmt.Fprintf(w, "latency    min %v, mean %v, p50 %v, p90 %v, p99 %v, p99.9 %v, max %v\n",
+			round(r.latencies[0]), round(sum/time.Duration(n)), round(percentile(r.latencies, 0.5)),
+			round(percentile(r.latencies, 0.9)), round(percentile(r.latencies, 0.99)),
+			round(percentile(r.latencies, 0.999)), round(r.latencies[n-1]))
+	}
+	failed := 0
+	codes := make([]GeeRPC.Code, 0, len(r.errors))
+	for code, count := range r.errors {
+		failed += count
+		codes = append(codes, code)
+	}
+	if failed == 0 {
+		fmt.Fprintln(w, "errors     0")
+		return
+	}
+	fmt.Fprintf(w, "errors     %d (%.2f%%)\n", failed, float64(failed)*100/float64(n))
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	for _, code := range codes {
+		fmt.Fprintf(w, "  %-18s %8d  %s\n", code, r.errors[code], r.samples[code])
+	}
+}
+
+// percentile 返回升序的sorted中不小于比例p的调用的耗时
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+// round 按耗时的量级保留精度
+func round(d time.Duration) time.Duration {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond)
+	}
+	return d.Round(10 * time.Microsecond)
+}
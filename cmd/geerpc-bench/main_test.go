@@ -0,0 +1,86 @@
+package main
+
+import (
+	"GeeRPC"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// _assert 断言,如果cond为false，则panic
+func _assert(cond bool, msg string, v ...interface{}) {
+	if !cond {
+		panic(fmt.Sprintf("assert failed! "+msg, v...))
+	}
+}
+
+type Echo int
+
+func (e Echo) Echo(args []byte, reply *[]byte) error {
+	*reply = args
+	return nil
+}
+
+// Flaky 偶数参数失败
+func (e Echo) Flaky(n int, reply *int) error {
+	if n%2 == 0 {
+		return GeeRPC.Errorf(GeeRPC.InvalidArgument, "even %d", n)
+	}
+	return errors.New("odd")
+}
+
+// startTestServer 以opts启动注册了Echo的服务端, 返回 tcp@addr 格式的地址
+func startTestServer(t *testing.T, opts ...GeeRPC.ServerOption) string {
+	server := GeeRPC.NewServer(opts...)
+	_ = server.Register(new(Echo))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	_assert(err == nil, "listen failed: %v", err)
+	t.Cleanup(func() { _ = l.Close() })
+	go server.Accept(l)
+	return "tcp@" + l.Addr().String()
+}
+
+var requestsLine = regexp.MustCompile(`requests   (\d+) in `)
+
+// runBench 执行压测, 返回退出码、输出和完成的请求数
+func runBench(args ...string) (int, string, int) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	out := stdout.String() + stderr.String()
+	n := -1
+	if m := requestsLine.FindStringSubmatch(out); m != nil {
+		n, _ = strconv.Atoi(m[1])
+	}
+	return code, out, n
+}
+
+func TestBench(t *testing.T) {
+	addr := startTestServer(t)
+	for _, flags := range [][]string{
+		{"-codec", "gob"},
+		{"-codec", "json", "-multiplex"},
+		{"-compress", "gzip", "-payload", "4096"},
+	} {
+		args := append(flags, "-n", "200", "-c", "4", "-conns", "2", addr)
+		code, out, n := runBench(args...)
+		_assert(code == 0 && n == 200 && strings.Contains(out, "p99 ") && strings.Contains(out, "errors     0"),
+			"%v: unexpected report %d %q", flags, code, out)
+	}
+
+	code, out, n := runBench("-n", "20", "-c", "1", "-args", "2", addr, "Echo.Flaky")
+	_assert(code == 0 && n == 20 && strings.Contains(out, "errors     20 (100.00%)") && strings.Contains(out, "InvalidArgument") && strings.Contains(out, "even 2"),
+		"unexpected error breakdown %d %q", code, out)
+
+	code, out, n = runBench("-qps", "50", "-d", "300ms", "-c", "2", addr)
+	_assert(code == 0 && n > 0 && n <= 20, "expect about 15 requests at 50 qps, got %d %q", code, out)
+
+	code, out, _ = runBench("-n", "1", addr, "Echo.Missing")
+	_assert(code == 1 && strings.Contains(out, "can't find method"), "expect an unknown method to fail, got %d %q", code, out)
+	code, _, _ = runBench("-d", "0", addr)
+	_assert(code == 2, "expect a run without limits to be a usage error, got %d", code)
+}
@@ -0,0 +1,93 @@
+// Command geerpc-echo 供 geerpc-bench 压测的回显服务器
+//
+// 用法:
+//
+//	geerpc-echo [-addr tcp@:9999] [-workers N] [-delay 1ms]
+//
+// addr为 协议@地址, 协议为tcp、unix或http(同时在/debug/geerpc和/metrics提供调试页面和指标)。
+// 注册的服务:
+//
+//	Echo.Echo([]byte) returns (*[]byte)  原样返回参数
+//	Echo.Sum(Args) returns (*int)        与main/main.go中的Foo.Sum相同
+package main
+
+import (
+	"GeeRPC"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+type Args struct{ Num1, Num2 int }
+
+// Echo 回显服务, delay模拟处理耗时
+type Echo struct {
+	delay time.Duration
+}
+
+// Echo 原样返回args
+func (e *Echo) Echo(args []byte, reply *[]byte) error {
+	e.wait()
+	*reply = args
+	return nil
+}
+
+// Sum 返回两数之和
+func (e *Echo) Sum(args Args, reply *int) error {
+	e.wait()
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+func (e *Echo) wait() {
+	if e.delay > 0 {
+		time.Sleep(e.delay)
+	}
+}
+
+func main() {
+	addr := flag.String("addr", "tcp@:9999", "listen address as protocol@address, protocol is tcp, unix or http")
+	workers := flag.Int("workers", 0, "number of workers of the worker pool, 0 for a goroutine per request")
+	queue := flag.Int("queue", 0, "max queued requests of the worker pool, 0 for 16 per worker")
+	delay := flag.Duration("delay", 0, "time to sleep in each call")
+	flag.Parse()
+
+	var opts []GeeRPC.ServerOption
+	if *workers > 0 {
+		opts = append(opts, GeeRPC.WithWorkerPool(GeeRPC.WorkerPool{Workers: *workers, QueueSize: *queue}))
+	}
+	protocol, address, ok := strings.Cut(*addr, "@")
+	if protocol == "http" {
+		opts = append(opts, GeeRPC.WithMetrics(GeeRPC.NewMetrics(), ""))
+	}
+	server := GeeRPC.NewServer(opts...)
+	_ = server.Register(&Echo{delay: *delay})
+
+	var l net.Listener
+	var err error
+	switch {
+	case !ok:
+		err = fmt.Errorf("invalid address %s, expect protocol@address", *addr)
+	case protocol == "unix":
+		l, err = GeeRPC.ListenUnix(address, 0o600)
+	case protocol == "tcp" || protocol == "http":
+		l, err = net.Listen("tcp", address)
+	default:
+		err = fmt.Errorf("unsupported protocol %s", protocol)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "geerpc-echo:", err)
+		os.Exit(2)
+	}
+	log.Printf("geerpc-echo: serving on %s@%s", protocol, l.Addr())
+	if protocol == "http" {
+		server.HandleHTTP()
+		log.Fatal(http.Serve(l, nil))
+	}
+	server.Accept(l)
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// rpcPath GeeRPC的导入路径
+const rpcPath = "GeeRPC"
+
+// method 一个服务方法, 类型都是源码中的写法
+type method struct {
+	Name string
+	// Stream 流式方法的种类: "server"、"client"、"bidi", 普通方法为空
+	Stream string
+	// Params 服务方法的参数类型(不含接收者), 用于生成服务接口
+	Params []string
+	// Arg, Reply 参数和返回值(去掉一层指针)的类型, 流式方法中为消息类型
+	Arg, Reply string
+}
+
+// service 一个服务类型及其方法
+type service struct {
+	Name    string
+	Methods []method
+}
+
+// importSpec 生成的文件需要的一个导入
+type importSpec struct {
+	Name, Path string
+}
+
+// generator 从一个包的源码生成代码
+type generator struct {
+	fset    *token.FileSet
+	pkg     string
+	files   []*ast.File
+	imports map[importSpec]bool
+}
+
+// parseDir 解析dir中除测试文件和skip以外的Go源文件
+func parseDir(dir, skip string) (*generator, error) {
+	g := &generator{fset: token.NewFileSet(), imports: make(map[importSpec]bool)}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") || name == skip {
+			continue
+		}
+		f, err := parser.ParseFile(g.fset, filepath.Join(dir, name), nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		if g.pkg != "" && f.Name.Name != g.pkg {
+			return nil, fmt.Errorf("found packages %s and %s in %s", g.pkg, f.Name.Name, dir)
+		}
+		g.pkg = f.Name.Name
+		g.files = append(g.files, f)
+	}
+	if g.pkg == "" {
+		return nil, fmt.Errorf("no Go files in %s", dir)
+	}
+	return g, nil
+}
+
+// service 找到类型name的所有服务方法, 规则与Server注册时相同, 不是服务方法的被忽略
+func (g *generator) service(name string) (*service, error) {
+	found := false
+	svc := &service{Name: name}
+	for _, f := range g.files {
+		for _, decl := range f.Decls {
+			switch d := decl.(type) {
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					if ts, ok := spec.(*ast.TypeSpec); ok && ts.Name.Name == name {
+						found = true
+					}
+				}
+			case *ast.FuncDecl:
+				if d.Recv == nil || receiverName(d.Recv.List[0].Type) != name || !ast.IsExported(d.Name.Name) {
+					continue
+				}
+				used := make(map[importSpec]bool)
+				if m, ok := g.method(f, d, used); ok {
+					svc.Methods = append(svc.Methods, m)
+					for spec := range used {
+						g.imports[spec] = true
+					}
+				}
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("type %s not found in package %s", name, g.pkg)
+	}
+	if !ast.IsExported(name) {
+		return nil, fmt.Errorf("type %s is not exported, which is not a valid service name", name)
+	}
+	sort.Slice(svc.Methods, func(i, j int) bool { return svc.Methods[i].Name < svc.Methods[j].Name })
+	return svc, nil
+}
+
+// receiverName 返回接收者 T 或 *T 中的T
+func receiverName(expr ast.Expr) string {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if id, ok := expr.(*ast.Ident); ok { // 泛型类型的方法不能作为服务方法
+		return id.Name
+	}
+	return ""
+}
+
+// method 按 newMethodType 的规则判断d是否为服务方法, 方法的类型用到的导入记录在used中
+func (g *generator) method(f *ast.File, d *ast.FuncDecl, used map[importSpec]bool) (method, bool) {
+	m := method{Name: d.Name.Name}
+	src := func(e ast.Expr) string { return g.expr(f, e, used) } // e在源码中的写法
+	results := flatten(d.Type.Results)
+	if len(results) != 1 || !isIdent(results[0], "error") {
+		return m, false
+	}
+	params := flatten(d.Type.Params)
+	for _, p := range params {
+		m.Params = append(m.Params, src(p))
+	}
+	first := 0
+	if len(params) >= 2 && g.isSelector(f, params[0], "context", "Context") {
+		first = 1
+	}
+	switch len(params) - first {
+	case 1: // 唯一的参数是双向流
+		args, ok := g.streamArgs(f, params[first], "BidiStream")
+		if !ok || len(args) != 2 {
+			return m, false
+		}
+		m.Stream, m.Arg, m.Reply = "bidi", src(args[0]), src(args[1])
+		return m, exportedOrBuiltin(args[0]) && exportedOrBuiltin(args[1])
+	case 2:
+	default:
+		return m, false
+	}
+	arg, reply := params[first], params[first+1]
+	if args, ok := g.streamArgs(f, reply, "ServerStream"); ok && len(args) == 1 {
+		m.Stream, m.Arg, m.Reply = "server", src(arg), src(args[0])
+		return m, exportedOrBuiltin(arg) && exportedOrBuiltin(args[0])
+	}
+	star, ok := reply.(*ast.StarExpr)
+	if !ok { // 与net/rpc一样, 返回值必须是指针
+		return m, false
+	}
+	m.Reply = src(star.X)
+	if args, ok := g.streamArgs(f, arg, "RecvStream"); ok && len(args) == 1 {
+		m.Stream, m.Arg = "client", src(args[0])
+		return m, exportedOrBuiltin(args[0]) && exportedOrBuiltin(reply)
+	}
+	m.Arg = src(arg)
+	return m, exportedOrBuiltin(arg) && exportedOrBuiltin(reply)
+}
+
+// flatten 把 a, b int 形式的参数展开为每个参数一个类型
+func flatten(fields *ast.FieldList) []ast.Expr {
+	if fields == nil {
+		return nil
+	}
+	var exprs []ast.Expr
+	for _, field := range fields.List {
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			exprs = append(exprs, field.Type)
+		}
+	}
+	return exprs
+}
+
+func isIdent(expr ast.Expr, name string) bool {
+	id, ok := expr.(*ast.Ident)
+	return ok && id.Name == name
+}
+
+// importPath 返回f中以name导入的包路径
+func importPath(f *ast.File, name string) (string, bool) {
+	for _, spec := range f.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		local := path[strings.LastIndex(path, "/")+1:]
+		if spec.Name != nil {
+			local = spec.Name.Name
+		}
+		if local == name {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// isSelector 判断expr是否为f中导入的包path的导出名sel
+func (g *generator) isSelector(f *ast.File, expr ast.Expr, path, sel string) bool {
+	s, ok := expr.(*ast.SelectorExpr)
+	if !ok || s.Sel.Name != sel {
+		return false
+	}
+	pkg, ok := s.X.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	p, ok := importPath(f, pkg.Name)
+	return ok && p == path
+}
+
+// streamArgs 判断expr是否为 GeeRPC.<kind>[...], 返回其类型参数
+func (g *generator) streamArgs(f *ast.File, expr ast.Expr, kind string) ([]ast.Expr, bool) {
+	switch e := expr.(type) {
+	case *ast.IndexExpr:
+		return []ast.Expr{e.Index}, g.isSelector(f, e.X, rpcPath, kind)
+	case *ast.IndexListExpr:
+		return e.Indices, g.isSelector(f, e.X, rpcPath, kind)
+	}
+	return nil, false
+}
+
+// exportedOrBuiltin 与 isExportedOrBuiltinType 相同: 去掉指针后是导出的类型、其他包的类型或预声明的类型
+func exportedOrBuiltin(expr ast.Expr) bool {
+	for {
+		star, ok := expr.(*ast.StarExpr)
+		if !ok {
+			break
+		}
+		expr = star.X
+	}
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return ast.IsExported(e.Name) || types.Universe.Lookup(e.Name) != nil
+	case *ast.SelectorExpr:
+		return ast.IsExported(e.Sel.Name)
+	case *ast.IndexExpr, *ast.IndexListExpr: // 泛型类型的实例化没有名称
+		return false
+	}
+	return true // 切片、map等未命名的类型
+}
+
+// expr 返回expr在源码中的写法, 并把它用到的导入记录在used中
+func (g *generator) expr(f *ast.File, expr ast.Expr, used map[importSpec]bool) string {
+	ast.Inspect(expr, func(n ast.Node) bool {
+		s, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if pkg, ok := s.X.(*ast.Ident); ok {
+			if path, ok := importPath(f, pkg.Name); ok {
+				used[importSpec{Name: pkg.Name, Path: path}] = true
+			}
+		}
+		return false
+	})
+	var buf bytes.Buffer
+	_ = printer.Fprint(&buf, g.fset, expr)
+	return buf.String()
+}
+
+// generate 为services生成代码, command写入文件头
+func (g *generator) generate(command string, services []*service) ([]byte, error) {
+	if g.pkg == rpcPath {
+		return nil, fmt.Errorf("cannot generate code in package %s itself", rpcPath)
+	}
+	imports := []importSpec{{Path: "context"}, {Path: rpcPath}}
+	for spec := range g.imports {
+		if spec.Name == spec.Path[strings.LastIndex(spec.Path, "/")+1:] {
+			spec.Name = ""
+		}
+		if spec != imports[0] && spec != imports[1] {
+			imports = append(imports, spec)
+		}
+	}
+	sort.Slice(imports, func(i, j int) bool { return imports[i].Path < imports[j].Path })
+	var buf bytes.Buffer
+	err := fileTemplate.Execute(&buf, map[string]interface{}{
+		"Command":  command,
+		"Package":  g.pkg,
+		"Imports":  imports,
+		"Services": services,
+	})
+	if err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %w\n%s", err, buf.Bytes())
+	}
+	return src, nil
+}
+
+var fileTemplate = template.Must(template.New("file").Funcs(template.FuncMap{
+	"join": strings.Join,
+}).Parse(`// Code generated by {{.Command}}; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .Imports}}
+	{{with .Name}}{{.}} {{end}}"{{.Path}}"
+{{- end}}
+)
+{{range .Services}}{{$svc := .Name}}
+// {{$svc}}Client {{$svc}}服务的类型化客户端, 方法名、参数和返回值在编译期检查
+type {{$svc}}Client struct {
+	client *GeeRPC.Client
+}
+
+// New{{$svc}}Client 返回通过client调用{{$svc}}服务的客户端
+func New{{$svc}}Client(client *GeeRPC.Client) *{{$svc}}Client {
+	return &{{$svc}}Client{client: client}
+}
+{{range .Methods}}
+{{- if eq .Stream "server"}}
+// {{.Name}} 发起服务端流式调用 {{$svc}}.{{.Name}}
+func (c *{{$svc}}Client) {{.Name}}(ctx context.Context, args {{.Arg}}) (*GeeRPC.StreamReader[{{.Reply}}], error) {
+	return GeeRPC.NewStreamReader[{{.Reply}}](ctx, c.client, "{{$svc}}.{{.Name}}", args)
+}
+{{else if eq .Stream "client"}}
+// {{.Name}} 发起客户端流式调用 {{$svc}}.{{.Name}}
+func (c *{{$svc}}Client) {{.Name}}(ctx context.Context) (*GeeRPC.StreamWriter[{{.Arg}}, {{.Reply}}], error) {
+	return GeeRPC.NewStreamWriter[{{.Arg}}, {{.Reply}}](ctx, c.client, "{{$svc}}.{{.Name}}")
+}
+{{else if eq .Stream "bidi"}}
+// {{.Name}} 发起双向流式调用 {{$svc}}.{{.Name}}
+func (c *{{$svc}}Client) {{.Name}}(ctx context.Context) (*GeeRPC.BidiClient[{{.Arg}}, {{.Reply}}], error) {
+	return GeeRPC.NewBidiClient[{{.Arg}}, {{.Reply}}](ctx, c.client, "{{$svc}}.{{.Name}}")
+}
+{{else}}
+// {{.Name}} 调用 {{$svc}}.{{.Name}}
+func (c *{{$svc}}Client) {{.Name}}(ctx context.Context, args {{.Arg}}) ({{.Reply}}, error) {
+	var reply {{.Reply}}
+	err := c.client.Call(ctx, "{{$svc}}.{{.Name}}", args, &reply)
+	return reply, err
+}
+{{end}}
+{{- end}}
+// {{$svc}}Server {{$svc}}服务的方法集
+type {{$svc}}Server interface {
+{{- range .Methods}}
+	{{.Name}}({{join .Params ", "}}) error
+{{- end}}
+}
+
+// Register{{$svc}}Server 以服务名{{$svc}}把impl注册到server, impl的方法集在编译期检查
+func Register{{$svc}}Server(server *GeeRPC.Server, impl {{$svc}}Server) error {
+	return server.RegisterName("{{$svc}}", impl)
+}
+
+// {{$svc}}的方法与生成的代码不一致时编译失败, 需要重新运行go generate
+var _ {{$svc}}Server = (*{{$svc}})(nil)
+{{end}}`))
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// _assert 断言,如果cond为false，则panic
+func _assert(cond bool, msg string, v ...interface{}) {
+	if !cond {
+		panic(fmt.Sprintf("assert failed! "+msg, v...))
+	}
+}
+
+func TestService(t *testing.T) {
+	g, err := parseDir("testdata/svc", "")
+	_assert(err == nil, "parse failed: %v", err)
+	svc, err := g.service("Calc")
+	_assert(err == nil, "service failed: %v", err)
+	var names []string
+	for _, m := range svc.Methods {
+		names = append(names, m.Name+":"+m.Stream+":"+m.Arg+":"+m.Reply)
+	}
+	_assert(strings.Join(names, " ") == "Count:server:int:int Echo:bidi:string:string Sum::Args:int Total:client:int:int When::time.Duration:time.Time",
+		"unexpected methods %v", names)
+	_assert(strings.Join(svc.Methods[1].Params, ", ") == "context.Context, rpc.BidiStream[string, string]", "unexpected params %v", svc.Methods[1].Params)
+
+	_, err = g.service("Missing")
+	_assert(err != nil && strings.Contains(err.Error(), "not found"), "expect an unknown type to fail, got %v", err)
+	_, err = g.service("private")
+	_assert(err != nil && strings.Contains(err.Error(), "not exported"), "expect an unexported type to fail, got %v", err)
+}
+
+// TestGenerate 生成的代码与服务一起编译
+func TestGenerate(t *testing.T) {
+	dir, err := os.MkdirTemp("testdata", "build")
+	_assert(err == nil, "mkdir failed: %v", err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	src, err := os.ReadFile("testdata/svc/svc.go")
+	_assert(err == nil, "read failed: %v", err)
+	_assert(os.WriteFile(filepath.Join(dir, "svc.go"), src, 0o644) == nil, "write failed")
+
+	output := filepath.Join(dir, "calc_geerpc.go")
+	err = run(dir, []string{"Calc"}, output, "geerpc-gen -type Calc")
+	_assert(err == nil, "generate failed: %v", err)
+	gen, _ := os.ReadFile(output)
+	for _, want := range []string{
+		"// Code generated by geerpc-gen -type Calc; DO NOT EDIT.",
+		`rpc "GeeRPC"`,
+		`"time"`,
+		"func (c *CalcClient) Sum(ctx context.Context, args Args) (int, error) {",
+		"func (c *CalcClient) Count(ctx context.Context, args int) (*GeeRPC.StreamReader[int], error) {",
+		"func (c *CalcClient) Total(ctx context.Context) (*GeeRPC.StreamWriter[int, int], error) {",
+		"func (c *CalcClient) Echo(ctx context.Context) (*GeeRPC.BidiClient[string, string], error) {",
+		"When(context.Context, time.Duration, *time.Time) error",
+		"func RegisterCalcServer(server *GeeRPC.Server, impl CalcServer) error {",
+		"var _ CalcServer = (*Calc)(nil)",
+	} {
+		_assert(strings.Contains(string(gen), want), "expect %q in generated code:\n%s", want, gen)
+	}
+	_assert(!strings.Contains(string(gen), "Hidden") && !strings.Contains(string(gen), "Bad"), "unexpected methods in generated code:\n%s", gen)
+
+	// 再次生成时忽略之前的输出
+	err = run(dir, []string{"Calc"}, output, "geerpc-gen -type Calc")
+	_assert(err == nil, "regenerate failed: %v", err)
+	out, err := exec.Command("go", "vet", "./"+filepath.ToSlash(dir)).CombinedOutput()
+	_assert(err == nil, "generated code does not compile: %v\n%s\n%s", err, out, gen)
+}
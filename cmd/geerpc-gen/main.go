@@ -0,0 +1,70 @@
+// Command geerpc-gen 为服务类型生成类型化的客户端和注册函数, 方法名、参数和返回值的错误在编译期暴露
+//
+// 在服务类型所在的文件中加入
+//
+//	//go:generate go run GeeRPC/cmd/geerpc-gen -type Foo
+//
+// 运行go generate后, 同一目录下的 foo_geerpc.go 包含:
+//
+//	type FooClient struct{ ... }                  // NewFooClient(client).Sum(ctx, args) (int, error)
+//	type FooServer interface{ ... }               // Foo的服务方法集
+//	func RegisterFooServer(server, impl) error    // 以服务名Foo注册impl
+//
+// 服务方法的规则与 Server.Register 相同, 流式方法生成返回 StreamReader、StreamWriter 或 BidiClient 的方法。
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	typeNames := flag.String("type", "", "comma-separated list of service type names; required")
+	output := flag.String("output", "", "output file name; default <dir>/<type>_geerpc.go")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: geerpc-gen -type T[,T...] [-output file] [dir]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *typeNames == "" || flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	dir := "."
+	if flag.NArg() == 1 {
+		dir = flag.Arg(0)
+	}
+	names := strings.Split(*typeNames, ",")
+	if *output == "" {
+		*output = filepath.Join(dir, strings.ToLower(names[0])+"_geerpc.go")
+	}
+	command := "geerpc-gen " + strings.Join(os.Args[1:], " ")
+	if err := run(dir, names, *output, command); err != nil {
+		fmt.Fprintln(os.Stderr, "geerpc-gen:", err)
+		os.Exit(1)
+	}
+}
+
+// run 读取dir中的包, 为names中的类型生成代码并写入output
+func run(dir string, names []string, output, command string) error {
+	g, err := parseDir(dir, filepath.Base(output))
+	if err != nil {
+		return err
+	}
+	services := make([]*service, 0, len(names))
+	for _, name := range names {
+		svc, err := g.service(strings.TrimSpace(name))
+		if err != nil {
+			return err
+		}
+		services = append(services, svc)
+	}
+	src, err := g.generate(command, services)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(output, src, 0o644)
+}
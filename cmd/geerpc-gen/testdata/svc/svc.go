@@ -0,0 +1,38 @@
+// Package svc 用于测试geerpc-gen的服务
+package svc
+
+import (
+	rpc "GeeRPC"
+	"context"
+	"time"
+)
+
+type Args struct{ Num1, Num2 int }
+
+type Calc struct{}
+
+func (c *Calc) Sum(args Args, reply *int) error { return nil }
+
+func (c *Calc) When(ctx context.Context, d time.Duration, reply *time.Time) error { return nil }
+
+func (c *Calc) Count(n int, stream rpc.ServerStream[int]) error { return nil }
+
+func (c *Calc) Total(stream rpc.RecvStream[int], total *int) error { return nil }
+
+func (c *Calc) Echo(ctx context.Context, stream rpc.BidiStream[string, string]) error { return nil }
+
+// 以下不是服务方法
+
+func (c *Calc) Bad(args Args) error { return nil }
+
+func (c *Calc) Value(args Args, reply int) error { return nil }
+
+func (c *Calc) Two(args Args, reply *int) (int, error) { return 0, nil }
+
+func (c *Calc) sum(args Args, reply *int) error { return nil }
+
+func (c Calc) Hidden(args hidden, reply *int) error { return nil }
+
+type hidden struct{}
+
+type private int
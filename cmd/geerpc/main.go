@@ -0,0 +1,233 @@
+// Command geerpc 调试用的命令行客户端, 通过服务端内置的反射服务列出和调用方法, 不需要编译进服务的类型
+//
+// 用法:
+//
+//	geerpc [flags] <address> list [service]
+//	geerpc [flags] <address> call <Service.Method> [json]
+//
+// address使用 GeeRPC.XDial 的格式, 如 tcp@localhost:9999、http@localhost:9999、unix@/tmp/rpc.sock。
+// call的参数为JSON, 省略时为参数类型的零值, 为"-"时从标准输入读取; 返回值以JSON输出。
+// 只支持普通方法, 不支持流式方法。
+package main
+
+import (
+	"GeeRPC"
+	"GeeRPC/codec"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// metadataFlag 可重复的 -m key=value
+type metadataFlag GeeRPC.Metadata
+
+func (m metadataFlag) String() string {
+	return fmt.Sprint(GeeRPC.Metadata(m))
+}
+
+func (m metadataFlag) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("metadata %q is not key=value", s)
+	}
+	m[k] = v
+	return nil
+}
+
+// codecTypes -codec的取值
+var codecTypes = map[string]codec.Type{"gob": codec.GobType, "json": codec.JsonType}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run 执行命令, 返回退出码: 0成功, 1调用失败, 2用法错误
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("geerpc", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	codecName := fs.String("codec", "gob", "codec: gob or json")
+	timeout := fs.Duration("timeout", 5*time.Second, "timeout of the connection and of each call, 0 for no limit")
+	repeat := fs.Int("n", 1, "number of times to make the call")
+	md := metadataFlag{}
+	fs.Var(md, "m", "request metadata `key=value`, may be repeated")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: geerpc [flags] <address> list [service]")
+		fmt.Fprintln(stderr, "       geerpc [flags] <address> call <Service.Method> [json|-]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	rest := fs.Args()
+	ct, ok := codecTypes[*codecName]
+	if len(rest) < 2 || !ok || *repeat < 1 {
+		fs.Usage()
+		return 2
+	}
+	var err error
+	switch cmd := rest[1]; {
+	case cmd == "list" && len(rest) <= 3:
+		err = withClient(rest[0], ct, *timeout, func(client *GeeRPC.Client) error {
+			ctx, cancel := callContext(md, *timeout)
+			defer cancel()
+			if len(rest) == 2 {
+				return listServices(ctx, client, stdout)
+			}
+			return listMethods(ctx, client, rest[2], stdout)
+		})
+	case cmd == "call" && (len(rest) == 3 || len(rest) == 4):
+		input := "null"
+		if len(rest) == 4 {
+			input = rest[3]
+		}
+		if input == "-" {
+			data, rerr := io.ReadAll(stdin)
+			if rerr != nil {
+				fmt.Fprintln(stderr, "geerpc:", rerr)
+				return 1
+			}
+			input = string(data)
+		}
+		err = withClient(rest[0], ct, *timeout, func(client *GeeRPC.Client) error {
+			return call(client, ct, rest[2], []byte(input), md, *timeout, *repeat, stdout, stderr)
+		})
+	default:
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "geerpc:", err)
+		return 1
+	}
+	return 0
+}
+
+// withClient 连接address并调用f, 结束后关闭连接
+func withClient(address string, ct codec.Type, timeout time.Duration, f func(*GeeRPC.Client) error) error {
+	client, err := GeeRPC.XDial(address, &GeeRPC.Option{CodecType: ct, ConnectTimeout: timeout})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = client.Close() }()
+	return f(client)
+}
+
+// callContext 返回携带元数据、按timeout超时的ctx
+func callContext(md metadataFlag, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx := context.Background()
+	if len(md) > 0 {
+		ctx = GeeRPC.WithMetadata(ctx, GeeRPC.Metadata(md))
+	}
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// listServices 每行输出一个服务名
+func listServices(ctx context.Context, client *GeeRPC.Client, w io.Writer) error {
+	var names []string
+	if err := client.Call(ctx, GeeRPC.ReflectionService+".List", "", &names); err != nil {
+		return err
+	}
+	for _, name := range names {
+		fmt.Fprintln(w, name)
+	}
+	return nil
+}
+
+// listMethods 每行输出服务的一个方法签名
+func listMethods(ctx context.Context, client *GeeRPC.Client, service string, w io.Writer) error {
+	var schema GeeRPC.ServiceSchema
+	if err := client.Call(ctx, GeeRPC.ReflectionService+".Describe", service, &schema); err != nil {
+		return err
+	}
+	for _, m := range schema.Methods {
+		fmt.Fprintf(w, "%s.%s\n", schema.Name, signature(m))
+	}
+	return nil
+}
+
+// call 以JSON参数调用serviceMethod repeat次, 每次输出一个JSON返回值; 失败的调用输出到stderr, 返回最后一个错误
+//
+// JSON编解码器直接收发JSON; gob编解码器按反射服务返回的结构构造参数和返回值的类型。
+func call(client *GeeRPC.Client, ct codec.Type, serviceMethod string, input []byte, md metadataFlag, timeout time.Duration, repeat int, stdout, stderr io.Writer) error {
+	if !json.Valid(input) {
+		return errors.New("arguments are not valid JSON")
+	}
+	newArgs, newReply := func() (interface{}, error) { return json.RawMessage(input), nil }, func() interface{} { return new(json.RawMessage) }
+	if ct != codec.JsonType {
+		ctx, cancel := callContext(md, timeout)
+		var schema GeeRPC.MethodSchema
+		err := client.Call(ctx, GeeRPC.ReflectionService+".DescribeMethod", serviceMethod, &schema)
+		cancel()
+		if err != nil {
+			return err
+		}
+		if schema.Stream != "" {
+			return fmt.Errorf("%s is a streaming method, which is not supported", serviceMethod)
+		}
+		argType, err := deref(schema.Arg).Build()
+		if err != nil {
+			return fmt.Errorf("argument type: %w", err)
+		}
+		replyType, err := deref(schema.Reply).Build()
+		if err != nil {
+			return fmt.Errorf("reply type: %w", err)
+		}
+		newArgs = func() (interface{}, error) {
+			argv := reflect.New(argType)
+			if err := json.Unmarshal(input, argv.Interface()); err != nil {
+				return nil, fmt.Errorf("arguments: %w", err)
+			}
+			return argv.Elem().Interface(), nil
+		}
+		newReply = func() interface{} { return reflect.New(replyType).Interface() }
+	}
+
+	var lastErr error
+	for i := 0; i < repeat; i++ {
+		args, err := newArgs()
+		if err != nil {
+			return err
+		}
+		reply := newReply()
+		ctx, cancel := callContext(md, timeout)
+		err = client.Call(ctx, serviceMethod, args, reply)
+		cancel()
+		if err == nil {
+			err = printJSON(stdout, reply)
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, "geerpc:", err)
+			lastErr = err
+		}
+	}
+	if lastErr != nil {
+		return fmt.Errorf("%s failed", serviceMethod)
+	}
+	return nil
+}
+
+// printJSON 以缩进的JSON输出v
+func printJSON(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	if err = json.Indent(&out, data, "", "  "); err != nil {
+		return err
+	}
+	out.WriteByte('\n')
+	_, err = out.WriteTo(w)
+	return err
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"GeeRPC"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+// _assert 断言,如果cond为false，则panic
+func _assert(cond bool, msg string, v ...interface{}) {
+	if !cond {
+		panic(fmt.Sprintf("assert failed! "+msg, v...))
+	}
+}
+
+type Args struct {
+	Num1 int `json:"a"`
+	Num2 int `json:"b"`
+}
+
+type Point struct{ X, Y int }
+
+type Calc int
+
+func (c Calc) Sum(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+func (c Calc) Split(args []int, reply *map[string][]Point) error {
+	for _, n := range args {
+		(*reply)["p"] = append((*reply)["p"], Point{X: n, Y: -n})
+	}
+	return nil
+}
+
+func (c Calc) Who(ctx context.Context, _ int, reply *string) error {
+	*reply = GeeRPC.IncomingMetadata(ctx)["user"]
+	return nil
+}
+
+func (c Calc) Fail(_ int, _ *int) error {
+	return errors.New("boom")
+}
+
+// startTestServer 以opts启动注册了Calc的服务端, 返回 tcp@addr 格式的地址
+func startTestServer(t *testing.T, opts ...GeeRPC.ServerOption) string {
+	server := GeeRPC.NewServer(opts...)
+	_ = server.Register(new(Calc))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	_assert(err == nil, "listen failed: %v", err)
+	t.Cleanup(func() { _ = l.Close() })
+	go server.Accept(l)
+	return "tcp@" + l.Addr().String()
+}
+
+// runCmd 执行命令, 返回退出码和输出
+func runCmd(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestList(t *testing.T) {
+	addr := startTestServer(t)
+	code, out, _ := runCmd("", addr, "list")
+	_assert(code == 0 && out == "Calc\n"+GeeRPC.ReflectionService+"\n", "unexpected services %d %q", code, out)
+	code, out, _ = runCmd("", addr, "list", "Calc")
+	_assert(code == 0 && strings.Contains(out, "Calc.Sum(main.Args) returns (*int)\n"), "unexpected methods %d %q", code, out)
+	code, _, errOut := runCmd("", addr, "list", "Missing")
+	_assert(code == 1 && strings.Contains(errOut, "can't find service"), "expect an unknown service to fail, got %d %q", code, errOut)
+}
+
+func TestCall(t *testing.T) {
+	addr := startTestServer(t)
+	for _, c := range []string{"gob", "json"} {
+		code, out, errOut := runCmd("", "-codec", c, addr, "call", "Calc.Sum", `{"a": 1, "b": 2}`)
+		_assert(code == 0 && out == "3\n", "%s: unexpected reply %d %q %q", c, code, out, errOut)
+		code, out, errOut = runCmd("[1, 2]", "-codec", c, addr, "call", "Calc.Split", "-")
+		_assert(code == 0 && strings.Contains(out, `"X": 2`) && strings.Contains(out, `"Y": -2`), "%s: unexpected reply %d %q %q", c, code, out, errOut)
+		code, out, _ = runCmd("", "-codec", c, "-m", "user=alice", "-n", "3", addr, "call", "Calc.Who")
+		_assert(code == 0 && out == strings.Repeat("\"alice\"\n", 3), "%s: unexpected reply %d %q", c, code, out)
+		code, _, errOut = runCmd("", "-codec", c, "-n", "2", addr, "call", "Calc.Fail", "0")
+		_assert(code == 1 && strings.Count(errOut, "boom") == 2, "%s: expect the call to fail twice, got %d %q", c, code, errOut)
+	}
+	code, _, errOut := runCmd("", addr, "call", "Calc.Sum", "{")
+	_assert(code == 1 && strings.Contains(errOut, "not valid JSON"), "expect invalid JSON to be refused, got %d %q", code, errOut)
+	code, _, errOut = runCmd("", addr, "call", GeeRPC.ReflectionService+".Describe", `"Calc"`)
+	_assert(code == 1 && strings.Contains(errOut, "recursive type"), "expect a recursive reply type to be refused, got %d %q", code, errOut)
+	code, _, _ = runCmd("", "-codec", "xml", addr, "list")
+	_assert(code == 2, "expect an unknown codec to be a usage error, got %d", code)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"GeeRPC"
+	"fmt"
+)
+
+// deref 去掉指针, gob编码时忽略指针, 参数和返回值都按元素类型构造
+func deref(ts *GeeRPC.TypeSchema) *GeeRPC.TypeSchema {
+	for ts.Kind == "ptr" {
+		ts = ts.Elem
+	}
+	return ts
+}
+
+// signature 方法的签名, 如 Sum(main.Args) returns (*int)、Count(int) returns (stream int)
+func signature(m GeeRPC.MethodSchema) string {
+	switch m.Stream {
+	case "server":
+		return fmt.Sprintf("%s(%s) returns (stream %s)", m.Name, m.Arg.Name, m.Send.Name)
+	case "client":
+		return fmt.Sprintf("%s(stream %s) returns (%s)", m.Name, m.Recv.Name, m.Reply.Name)
+	case "bidi":
+		return fmt.Sprintf("%s(stream %s) returns (stream %s)", m.Name, m.Recv.Name, m.Send.Name)
+	}
+	return fmt.Sprintf("%s(%s) returns (%s)", m.Name, m.Arg.Name, m.Reply.Name)
+}
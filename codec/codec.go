@@ -7,8 +7,27 @@ type Header struct {
 	ServiceMethod string //	format "Service.Method"
 	Seq           uint64
 	Error         string
+	Code          uint32            // 错误码, 0表示没有错误码
+	Metadata      map[string]string // 请求元数据, 如客户端标识
+	Flags         uint32            // 消息标志, 见 FlagStream 等
 }
 
+// Header.Flags 的取值
+const (
+	// FlagStream 流式调用中的消息, 同一个Seq可以有多条
+	FlagStream uint32 = 1 << iota
+	// FlagEndStream 服务端发送时为调用的最终响应, 客户端发送时为半关闭, 消息体为空(客户端流式方法的响应除外)
+	FlagEndStream
+	// FlagCancel 客户端取消Seq对应的流式调用, 消息体为空
+	FlagCancel
+	// FlagWindow 接收方归还发送额度, 消息体为归还的消息数(uint32)
+	FlagWindow
+	// FlagReverse 服务端发起的调用(反向调用)的请求和响应, Seq由服务端分配
+	FlagReverse
+	// FlagCompressed 消息体被压缩, 由 WithCompression 包装的编解码器设置和去除
+	FlagCompressed
+)
+
 type Codec interface {
 	io.Closer
 	ReadHeader(*Header) error
@@ -16,6 +35,14 @@ type Codec interface {
 	Write(*Header, interface{}) error
 }
 
+// BodySizer 能统计消息体在连接上所占字节数的编解码器, 用于在追踪中记录消息大小
+type BodySizer interface {
+	// ReadSize 返回最近一次 ReadBody 读取的字节数
+	ReadSize() int
+	// WriteSize 返回最近一次 Write 写入的消息体的字节数
+	WriteSize() int
+}
+
 type NewCodecFunc func(io.ReadWriteCloser) Codec
 type Type string
 
@@ -29,4 +56,43 @@ var NewCodecFuncMap map[Type]NewCodecFunc
 func init() {
 	NewCodecFuncMap = make(map[Type]NewCodecFunc)
 	NewCodecFuncMap[GobType] = NewGobCodec
+	NewCodecFuncMap[JsonType] = NewJsonCodec
+}
+
+// countingWriter 统计写入w的字节数
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += n
+	return n, err
+}
+
+// byteReader 可以按字节读取的Reader, gob解码器不会再为它加一层缓冲
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// countingReader 统计从r读取的字节数
+type countingReader struct {
+	r byteReader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
 }
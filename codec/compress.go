@@ -0,0 +1,218 @@
+package codec
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// 内置的压缩算法名称
+const (
+	// Gzip 标准gzip
+	Gzip = "gzip"
+	// FlateFast 速度优先的deflate, 类似snappy的取舍: 压缩率较低, CPU开销小
+	FlateFast = "flate-fast"
+	// FlateBest 压缩率优先的deflate, 类似zstd高压缩级别的取舍, 适合带宽紧张的链路
+	FlateBest = "flate-best"
+)
+
+// DefaultCompressThreshold 消息体序列化后小于该字节数时不压缩
+const DefaultCompressThreshold = 1024
+
+// Compressor 压缩算法
+type Compressor interface {
+	// Name 在 Option 中协商时使用的名称
+	Name() string
+	// Compress 返回把压缩后的数据写入w的Writer, Close时写完所有数据
+	Compress(w io.Writer) (io.WriteCloser, error)
+	// Decompress 返回从r中读取解压数据的Reader
+	Decompress(r io.Reader) (io.Reader, error)
+}
+
+// BodyMarshaler 编解码器单独序列化消息体的能力, 压缩需要先得到消息体的字节
+type BodyMarshaler interface {
+	MarshalBody(body interface{}) ([]byte, error)
+	UnmarshalBody(data []byte, body interface{}) error
+}
+
+var compressors sync.Map // name -> Compressor
+
+// RegisterCompressor 注册压缩算法, 同名的算法被替换
+func RegisterCompressor(c Compressor) {
+	compressors.Store(c.Name(), c)
+}
+
+// GetCompressor 返回name对应的压缩算法, 不存在时返回nil
+func GetCompressor(name string) Compressor {
+	c, ok := compressors.Load(name)
+	if !ok {
+		return nil
+	}
+	return c.(Compressor)
+}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Name() string { return Gzip }
+
+func (gzipCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+func (gzipCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+// flateCompressor 指定级别的deflate
+type flateCompressor struct {
+	name  string
+	level int
+}
+
+func (c flateCompressor) Name() string { return c.name }
+
+func (c flateCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return flate.NewWriter(w, c.level)
+}
+
+func (c flateCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	return flate.NewReader(r), nil
+}
+
+func init() {
+	RegisterCompressor(gzipCompressor{})
+	RegisterCompressor(flateCompressor{name: FlateFast, level: flate.BestSpeed})
+	RegisterCompressor(flateCompressor{name: FlateBest, level: flate.BestCompression})
+}
+
+// WithCompression 包装f, 使其创建的编解码器压缩不小于threshold字节的消息体
+//
+// 消息体先由内层编解码器的 BodyMarshaler 序列化, 再以[]byte通过内层编解码器发送, 压缩的消息头上带
+// FlagCompressed, 因此适用于任何实现了 BodyMarshaler 的编解码器。小于threshold的消息体直接发送序列化的结果,
+// 每个消息体只序列化一次。
+// threshold不大于0时使用 DefaultCompressThreshold。
+func WithCompression(f NewCodecFunc, c Compressor, threshold int) NewCodecFunc {
+	if threshold <= 0 {
+		threshold = DefaultCompressThreshold
+	}
+	return func(conn io.ReadWriteCloser) Codec {
+		return &compressCodec{Codec: f(conn), c: c, threshold: threshold}
+	}
+}
+
+// errNotMarshaler 内层编解码器不能单独序列化消息体, 无法解压
+var errNotMarshaler = errors.New("rpc codec: codec does not support compression")
+
+// compressCodec 按消息压缩消息体的编解码器
+type compressCodec struct {
+	Codec
+	c         Compressor
+	threshold int
+	// compressed 最近读到的消息头带有 FlagCompressed
+	compressed bool
+	// maxRecv, maxSend 解压后和压缩前的消息体的最大字节数, 不大于0时不限制
+	maxRecv, maxSend int
+}
+
+// SetMaxMessageSize 实现 SizeLimiter, 同时限制内层编解码器读写的压缩数据
+func (cc *compressCodec) SetMaxMessageSize(recv, send int) {
+	cc.maxRecv, cc.maxSend = recv, send
+	if l, ok := cc.Codec.(SizeLimiter); ok {
+		l.SetMaxMessageSize(recv, send)
+	}
+}
+
+// ReadSize 实现 BodySizer, 返回内层编解码器读取的压缩后的字节数, 内层不统计时返回0
+func (cc *compressCodec) ReadSize() int {
+	if s, ok := cc.Codec.(BodySizer); ok {
+		return s.ReadSize()
+	}
+	return 0
+}
+
+// WriteSize 实现 BodySizer, 返回内层编解码器写入的压缩后的字节数, 内层不统计时返回0
+func (cc *compressCodec) WriteSize() int {
+	if s, ok := cc.Codec.(BodySizer); ok {
+		return s.WriteSize()
+	}
+	return 0
+}
+
+func (cc *compressCodec) ReadHeader(h *Header) error {
+	if err := cc.Codec.ReadHeader(h); err != nil {
+		return err
+	}
+	cc.compressed = h.Flags&FlagCompressed != 0
+	h.Flags &^= FlagCompressed // 上层不需要知道消息是否被压缩
+	return nil
+}
+
+func (cc *compressCodec) ReadBody(body interface{}) error {
+	m, ok := cc.Codec.(BodyMarshaler)
+	if !ok {
+		if cc.compressed {
+			return errNotMarshaler
+		}
+		return cc.Codec.ReadBody(body)
+	}
+	var data []byte
+	if err := cc.Codec.ReadBody(&data); err != nil {
+		return err
+	}
+	if body == nil {
+		return nil
+	}
+	if !cc.compressed {
+		return m.UnmarshalBody(data, body)
+	}
+	r, err := cc.c.Decompress(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("rpc codec: decompress body: %w", err)
+	}
+	if cc.maxRecv > 0 { // 压缩数据已经完整读出, 解压超限时连接仍然同步
+		r = io.LimitReader(r, int64(cc.maxRecv)+1)
+	}
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("rpc codec: decompress body: %w", err)
+	}
+	if cc.maxRecv > 0 && len(raw) > cc.maxRecv {
+		return tooLarge(len(raw), cc.maxRecv)
+	}
+	return m.UnmarshalBody(raw, body)
+}
+
+func (cc *compressCodec) Write(h *Header, body interface{}) error {
+	m, ok := cc.Codec.(BodyMarshaler)
+	if !ok {
+		return cc.Codec.Write(h, body)
+	}
+	raw, err := m.MarshalBody(body)
+	if err != nil { // 还没有写入任何数据, 连接仍然同步
+		return fmt.Errorf("rpc codec: marshal body: %w", err)
+	}
+	if cc.maxSend > 0 && len(raw) > cc.maxSend { // 与内层的限制一致, 按序列化后的大小计算
+		return tooLarge(len(raw), cc.maxSend)
+	}
+	if len(raw) < cc.threshold { // 小的消息体压缩得不偿失
+		return cc.Codec.Write(h, raw)
+	}
+	var buf bytes.Buffer
+	w, err := cc.c.Compress(&buf)
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(raw); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	ch := *h // 不修改调用方复用的消息头
+	ch.Flags |= FlagCompressed
+	return cc.Codec.Write(&ch, buf.Bytes())
+}
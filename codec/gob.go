@@ -3,9 +3,11 @@ package codec
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/gob"
+	"errors"
+	"fmt"
 	"io"
-	"log"
 )
 
 type GobCodec struct {
@@ -25,16 +27,29 @@ type GobCodec struct {
 	//
 	// 用于将数据编码为二进制格式并写入网络连接
 	enc *gob.Encoder
+	// maxRecv, maxSend 读取和写入的消息体的最大字节数, 不大于0时不限制
+	maxRecv, maxSend int
+	// r 限制读取大小时从连接读取的Reader, 检查过大小的消息放入frames, dec从frames解码
+	r      *bufio.Reader
+	frames bytes.Buffer
+	// wbuf 限制写入大小时编码器先写入wbuf, 检查过大小后再写到buf
+	wbuf bytes.Buffer
+	// in, out 统计解码器读取和编码器写入的字节数
+	in  countingReader
+	out countingWriter
+	// readSize, writeSize 最近一次读取和写入的消息体的字节数
+	readSize, writeSize int
 }
 
 func NewGobCodec(conn io.ReadWriteCloser) Codec {
 	buf := bufio.NewWriter(conn)
-	return &GobCodec{
+	g := &GobCodec{
 		conn: conn,
 		buf:  buf,
-		dec:  gob.NewDecoder(conn),
-		enc:  gob.NewEncoder(buf),
 	}
+	g.in.r, g.out.w = bufio.NewReader(conn), buf
+	g.dec, g.enc = gob.NewDecoder(&g.in), gob.NewEncoder(&g.out)
+	return g
 }
 
 // Close 关闭 GobCodec 的连接
@@ -42,28 +57,166 @@ func (g *GobCodec) Close() error {
 	return g.conn.Close()
 }
 
+// SetMaxMessageSize 实现 SizeLimiter, 必须在读写任何消息之前调用
+func (g *GobCodec) SetMaxMessageSize(recv, send int) {
+	if recv > 0 {
+		g.maxRecv = recv
+		g.r = bufio.NewReader(g.conn)
+		g.in.r = &g.frames
+	}
+	if send > 0 {
+		g.maxSend = send
+		g.out.w = &g.wbuf
+	}
+}
+
 func (g *GobCodec) ReadHeader(h *Header) error {
-	return g.dec.Decode(h)
+	return g.decode(h)
 }
 
 func (g *GobCodec) ReadBody(body interface{}) error {
-	return g.dec.Decode(body)
+	n := g.in.n
+	err := g.decode(body)
+	g.readSize = g.in.n - n
+	return err
+}
+
+// ReadSize 实现 BodySizer
+func (g *GobCodec) ReadSize() int {
+	return g.readSize
+}
+
+// WriteSize 实现 BodySizer
+func (g *GobCodec) WriteSize() int {
+	return g.writeSize
+}
+
+// decode 解码下一个值, 限制读取大小时先检查并读入该值的所有消息
+func (g *GobCodec) decode(v interface{}) error {
+	if g.maxRecv <= 0 {
+		return g.dec.Decode(v)
+	}
+	if err := g.load(); err != nil {
+		return err
+	}
+	defer g.frames.Reset() // 解码出错时丢弃剩余的消息
+	return g.dec.Decode(v)
+}
+
+// load 把下一个值及其之前的类型定义读入frames
+//
+// 值超过maxRecv时跳过它并返回 ErrMessageTooLarge, 已读入的类型定义留给下一个值, 解码器的状态保持一致;
+// 类型定义无法跳过, 累计超过maxRecv时返回不包装 ErrMessageTooLarge 的错误,
+// 因此一次读入frames的数据不超过两倍maxRecv。
+func (g *GobCodec) load() error {
+	for {
+		size, raw, err := readGobUint(g.r)
+		if err != nil {
+			return err
+		}
+		n := int(size)
+		if size > uint64(int(^uint(0)>>1)) {
+			n = int(^uint(0) >> 1)
+		}
+		peek := maxGobUintLen
+		if n < peek {
+			peek = n
+		}
+		head, err := g.r.Peek(peek)
+		if err != nil {
+			return err
+		}
+		id, err := decodeGobTypeId(head)
+		if err != nil {
+			return err
+		}
+		if id < 0 && g.frames.Len()+n > g.maxRecv {
+			return fmt.Errorf("rpc codec: gob type definitions of %d bytes exceed the limit of %d bytes", g.frames.Len()+n, g.maxRecv)
+		}
+		if n > g.maxRecv {
+			if _, err = g.r.Discard(n); err != nil {
+				return err
+			}
+			return tooLarge(n, g.maxRecv)
+		}
+		g.frames.Write(raw)
+		if _, err = io.CopyN(&g.frames, g.r, int64(n)); err != nil {
+			return err
+		}
+		if id > 0 {
+			return nil
+		}
+	}
+}
+
+// MarshalBody 单独序列化消息体, 结果自带类型信息, 与连接上的编码器无关
+func (g *GobCodec) MarshalBody(body interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(body); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBody 反序列化 MarshalBody 的结果
+func (g *GobCodec) UnmarshalBody(data []byte, body interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(body)
 }
 
 func (g *GobCodec) Write(h *Header, body interface{}) (err error) {
 	defer func() {
 		_ = g.buf.Flush() // 刷新输入缓冲区
-		if err != nil {
+		if err != nil && !errors.Is(err, ErrMessageTooLarge) {
 			_ = g.Close()
 		}
 	}()
+	g.writeSize = 0
+	if g.maxSend > 0 {
+		return g.writeLimited(h, body)
+	}
 	if err := g.enc.Encode(h); err != nil {
-		log.Println("rpc codec: gob error encoding header:", err)
 		return err
 	}
+	n := g.out.n
 	if err := g.enc.Encode(body); err != nil {
-		log.Println("rpc codec: gob error encoding body:", err)
 		return err
 	}
+	g.writeSize = g.out.n - n
 	return nil
 }
+
+// writeLimited 先把消息编码到wbuf, 消息体不超过maxSend时才写到连接
+//
+// 消息体超限时只写入编码器已经生成的类型定义, 对端把它们留给下一个值, 连接可以继续使用。
+func (g *GobCodec) writeLimited(h *Header, body interface{}) error {
+	g.wbuf.Reset()
+	if err := g.enc.Encode(h); err != nil {
+		return err
+	}
+	n := g.out.n
+	if err := g.enc.Encode(body); err != nil {
+		return err
+	}
+	size := g.out.n - n
+	data := g.wbuf.Bytes()
+	frames, err := splitGobFrames(data)
+	if err != nil {
+		return err
+	}
+	last := frames[len(frames)-1]
+	if last.size <= g.maxSend {
+		if _, err = g.buf.Write(data); err == nil {
+			g.writeSize = size
+		}
+		return err
+	}
+	for _, f := range frames {
+		if !f.typeDef {
+			continue
+		}
+		if _, err = g.buf.Write(data[f.start:f.end]); err != nil {
+			return err
+		}
+	}
+	return tooLarge(last.size, g.maxSend)
+}
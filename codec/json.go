@@ -1 +1,164 @@
 package codec
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// JsonCodec 以JSON编码消息, 消息头和消息体各为一个JSON值, 便于其他语言和调试工具接入
+type JsonCodec struct {
+	conn io.ReadWriteCloser
+	buf  *bufio.Writer
+	dec  *json.Decoder
+	enc  *json.Encoder
+	// out 统计编码器写入的字节数
+	out countingWriter
+	// readSize, writeSize 最近一次读取和写入的消息体的字节数
+	readSize, writeSize int
+	// maxRecv, maxSend 读取和写入的消息的最大字节数, 不大于0时不限制
+	maxRecv, maxSend int
+	// in 限制读取大小时解码器从in读取, 每个值开始解码前重置剩余额度
+	in *limitedReader
+}
+
+func NewJsonCodec(conn io.ReadWriteCloser) Codec {
+	buf := bufio.NewWriter(conn)
+	j := &JsonCodec{
+		conn: conn,
+		buf:  buf,
+		dec:  json.NewDecoder(conn),
+	}
+	j.out.w = buf
+	j.enc = json.NewEncoder(&j.out)
+	return j
+}
+
+// Close 关闭 JsonCodec 的连接
+func (j *JsonCodec) Close() error {
+	return j.conn.Close()
+}
+
+// SetMaxMessageSize 实现 SizeLimiter, 必须在读写任何消息之前调用
+//
+// JSON没有长度前缀, 读取超限的值时无法跳过它的剩余部分: 返回的错误包装 ErrMessageTooLarge,
+// 之后的读取都返回同一错误, 连接随之关闭。写入超限的消息体时不写入任何数据, 连接可以继续使用。
+func (j *JsonCodec) SetMaxMessageSize(recv, send int) {
+	if recv > 0 {
+		j.maxRecv = recv
+		j.in = &limitedReader{r: j.conn, limit: recv}
+		j.dec = json.NewDecoder(j.in)
+	}
+	if send > 0 {
+		j.maxSend = send
+	}
+}
+
+// decode 解码下一个值, 限制读取大小时该值最多从连接读取maxRecv字节
+func (j *JsonCodec) decode(v interface{}) error {
+	if j.in != nil {
+		j.in.n = j.maxRecv + 1 // 多留一个字节给值之后的换行符
+		if b, ok := j.dec.Buffered().(interface{ Len() int }); ok {
+			j.in.n -= b.Len() // 已缓冲的数据属于这个值
+		}
+	}
+	return j.dec.Decode(v)
+}
+
+func (j *JsonCodec) ReadHeader(h *Header) error {
+	return j.decode(h)
+}
+
+// ReadBody body为nil时丢弃消息体
+func (j *JsonCodec) ReadBody(body interface{}) error {
+	n := j.dec.InputOffset()
+	defer func() { j.readSize = int(j.dec.InputOffset() - n) }()
+	if body == nil {
+		var discard json.RawMessage
+		return j.decode(&discard)
+	}
+	return j.decode(body)
+}
+
+// ReadSize 实现 BodySizer
+func (j *JsonCodec) ReadSize() int {
+	return j.readSize
+}
+
+// WriteSize 实现 BodySizer
+func (j *JsonCodec) WriteSize() int {
+	return j.writeSize
+}
+
+// MarshalBody 单独序列化消息体
+func (j *JsonCodec) MarshalBody(body interface{}) ([]byte, error) {
+	return json.Marshal(body)
+}
+
+// UnmarshalBody 反序列化 MarshalBody 的结果
+func (j *JsonCodec) UnmarshalBody(data []byte, body interface{}) error {
+	return json.Unmarshal(data, body)
+}
+
+func (j *JsonCodec) Write(h *Header, body interface{}) (err error) {
+	defer func() {
+		_ = j.buf.Flush()
+		if err != nil && !errors.Is(err, ErrMessageTooLarge) {
+			_ = j.Close()
+		}
+	}()
+	j.writeSize = 0
+	if j.maxSend > 0 {
+		return j.writeLimited(h, body)
+	}
+	if err := j.enc.Encode(h); err != nil {
+		return err
+	}
+	n := j.out.n
+	if err := j.enc.Encode(body); err != nil {
+		return err
+	}
+	j.writeSize = j.out.n - n
+	return nil
+}
+
+// writeLimited 先序列化消息体, 不超过maxSend时才写入消息头和消息体
+func (j *JsonCodec) writeLimited(h *Header, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	if len(data) > j.maxSend {
+		return tooLarge(len(data), j.maxSend)
+	}
+	if err = j.enc.Encode(h); err != nil {
+		return err
+	}
+	n := j.out.n
+	if _, err = j.out.Write(append(data, '\n')); err != nil { // 和json.Encoder一样以换行结尾
+		return err
+	}
+	j.writeSize = j.out.n - n
+	return nil
+}
+
+// limitedReader 最多再读取n字节, 超出时返回包装 ErrMessageTooLarge 的错误
+type limitedReader struct {
+	r     io.Reader
+	n     int
+	limit int
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		return 0, fmt.Errorf("%w: more than %d bytes", ErrMessageTooLarge, l.limit)
+	}
+	if len(p) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= n
+	return n, err
+}
@@ -0,0 +1,141 @@
+package codec
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrMessageTooLarge 消息体超过了大小限制
+//
+// 返回包装了该错误的错误时, 超限的消息已被完整跳过, 连接仍然可以继续读写;
+// 其他错误(如消息头或类型定义超限)意味着无法再与对端同步, 连接应当关闭。
+// 例外是 JsonCodec 读取超限的值: 它无法跳过, 之后的读取都返回同一错误。
+var ErrMessageTooLarge = errors.New("rpc codec: message too large")
+
+// SizeLimiter 可以限制单条消息大小的编解码器
+type SizeLimiter interface {
+	// SetMaxMessageSize 在读写任何消息之前调用, recv限制读取的消息, send限制写入的消息, 不大于0时不限制
+	SetMaxMessageSize(recv, send int)
+}
+
+// ErrSizeLimitUnsupported 配置了消息大小限制, 但编解码器没有实现 SizeLimiter
+var ErrSizeLimitUnsupported = errors.New("rpc codec: codec does not support message size limits")
+
+// SetMaxMessageSize 限制c读取超过recv字节、写入超过send字节的消息体, 超限时返回 ErrMessageTooLarge, 必须在读写任何消息之前调用
+//
+// 大小在解码之前检查, 超限的消息不会被读入内存。recv和send都不大于0时不做任何事;
+// c没有实现 SizeLimiter 时返回 ErrSizeLimitUnsupported, 调用方不应在没有限制的情况下使用它。
+func SetMaxMessageSize(c Codec, recv, send int) error {
+	if recv <= 0 && send <= 0 {
+		return nil
+	}
+	l, ok := c.(SizeLimiter)
+	if !ok {
+		return ErrSizeLimitUnsupported
+	}
+	l.SetMaxMessageSize(recv, send)
+	return nil
+}
+
+// tooLarge 返回大小为n的消息超过limit的错误
+func tooLarge(n, limit int) error {
+	return fmt.Errorf("%w: %d bytes exceeds the limit of %d bytes", ErrMessageTooLarge, n, limit)
+}
+
+// gob的数据流由消息组成, 每条消息以无符号整数编码的长度开头, 之后是有符号整数编码的类型id:
+// 类型id为负数时是类型定义, 为正数时是一个值。一个值之前可能有它所需的类型定义。
+
+// maxGobUintLen 无符号整数编码的最大长度
+const maxGobUintLen = 9
+
+// readGobUint 从r读取一个无符号整数, 同时返回其原始字节
+func readGobUint(r *bufio.Reader) (uint64, []byte, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	if b < 0x80 {
+		return uint64(b), []byte{b}, nil
+	}
+	n := -int(int8(b))
+	if n > maxGobUintLen-1 {
+		return 0, nil, errors.New("rpc codec: invalid gob message length")
+	}
+	raw := make([]byte, n+1)
+	raw[0] = b
+	if _, err = io.ReadFull(r, raw[1:]); err != nil {
+		return 0, nil, err
+	}
+	var x uint64
+	for _, c := range raw[1:] {
+		x = x<<8 | uint64(c)
+	}
+	return x, raw, nil
+}
+
+// decodeGobUint 解码buf开头的无符号整数, 返回其值和占用的字节数
+func decodeGobUint(buf []byte) (uint64, int, error) {
+	if len(buf) == 0 {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+	b := buf[0]
+	if b < 0x80 {
+		return uint64(b), 1, nil
+	}
+	n := -int(int8(b))
+	if n > maxGobUintLen-1 || len(buf) < n+1 {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+	var x uint64
+	for _, c := range buf[1 : n+1] {
+		x = x<<8 | uint64(c)
+	}
+	return x, n + 1, nil
+}
+
+// decodeGobTypeId 解码消息开头的类型id
+func decodeGobTypeId(buf []byte) (int64, error) {
+	u, _, err := decodeGobUint(buf)
+	if err != nil {
+		return 0, err
+	}
+	if u&1 != 0 {
+		return ^int64(u >> 1), nil
+	}
+	return int64(u >> 1), nil
+}
+
+// gobFrame 已编码数据中的一条消息
+type gobFrame struct {
+	// start, end 消息(含长度)在数据中的范围
+	start, end int
+	// size 消息除长度外的字节数
+	size int
+	// typeDef 消息是类型定义
+	typeDef bool
+}
+
+// splitGobFrames 把编码器输出的数据切分成消息
+func splitGobFrames(data []byte) ([]gobFrame, error) {
+	var frames []gobFrame
+	for off := 0; off < len(data); {
+		size, n, err := decodeGobUint(data[off:])
+		if err != nil {
+			return nil, err
+		}
+		body := off + n
+		end := body + int(size)
+		if end > len(data) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		id, err := decodeGobTypeId(data[body:end])
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, gobFrame{start: off, end: end, size: int(size), typeDef: id < 0})
+		off = end
+	}
+	return frames, nil
+}
@@ -0,0 +1,123 @@
+package GeeRPC
+
+import (
+	"GeeRPC/codec"
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// Repeat 返回大的、容易压缩的响应
+type Repeat int
+
+func (r Repeat) Bytes(n int, reply *[]byte) error {
+	*reply = bytes.Repeat([]byte("geerpc "), n)
+	return nil
+}
+
+// Counted 统计gob编码次数的消息体
+type Counted struct{ N int }
+
+var countedEncodes int32
+
+func (c Counted) GobEncode() ([]byte, error) {
+	atomic.AddInt32(&countedEncodes, 1)
+	return []byte{byte(c.N)}, nil
+}
+
+func (c *Counted) GobDecode(data []byte) error {
+	c.N = int(data[0])
+	return nil
+}
+
+func (r Repeat) Echo(c Counted, reply *Counted) error {
+	*reply = c
+	return nil
+}
+
+// countingListener 统计服务端收发的字节数
+type countingListener struct {
+	net.Listener
+	read, written int64
+}
+
+type countingConn struct {
+	net.Conn
+	l *countingListener
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &countingConn{Conn: conn, l: l}, nil
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	atomic.AddInt64(&c.l.read, int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	atomic.AddInt64(&c.l.written, int64(n))
+	return n, err
+}
+
+// transferred 用opt建立连接, 发送和接收约64KB的数据, 返回服务端收发的总字节数
+func transferred(t *testing.T, opt *Option) int64 {
+	server := NewServer()
+	_ = server.Register(new(Repeat))
+	_ = server.Register(new(Blob))
+	tcp, _ := net.Listen("tcp", ":0")
+	l := &countingListener{Listener: tcp}
+	defer func() { _ = l.Close() }()
+	go server.Accept(l)
+
+	client, err := Dial("tcp", l.Addr().String(), opt)
+	_assert(err == nil, "dial failed: %v", err)
+	defer func() { _ = client.Close() }()
+	var reply []byte
+	err = client.Call(context.Background(), "Repeat.Bytes", 10000, &reply)
+	_assert(err == nil && len(reply) == 70000, "expect 70000 bytes, got %d, %v", len(reply), err)
+	var n int
+	err = client.Call(context.Background(), "Blob.Len", make([]byte, 64<<10), &n)
+	_assert(err == nil && n == 64<<10, "expect %d, got %d, %v", 64<<10, n, err)
+	// 小于阈值的消息体不压缩
+	err = client.Call(context.Background(), "Repeat.Bytes", 1, &reply)
+	_assert(err == nil && string(reply) == "geerpc ", "unexpected small reply %q, %v", reply, err)
+	_ = client.Close()
+	return atomic.LoadInt64(&l.read) + atomic.LoadInt64(&l.written)
+}
+
+func TestOption_Compression(t *testing.T) {
+	t.Parallel()
+	plain := transferred(t, nil)
+	for _, name := range []string{codec.Gzip, codec.FlateFast, codec.FlateBest} {
+		for _, multiplex := range []bool{false, true} {
+			n := transferred(t, &Option{Compression: name, Multiplex: multiplex})
+			_assert(n < plain/10, "expect %s (multiplex %v) to shrink %d bytes, got %d", name, multiplex, plain, n)
+		}
+	}
+
+	// 不小于阈值的消息才压缩
+	n := transferred(t, &Option{Compression: codec.Gzip, CompressThreshold: 1 << 20})
+	_assert(n > plain*9/10, "expect no compression below the threshold, got %d of %d bytes", n, plain)
+
+	_, err := Dial("tcp", startTestServer(t).addr, &Option{Compression: "bogus"})
+	_assert(err != nil && strings.Contains(err.Error(), "unsupported compression"), "expect an unsupported compression to be rejected, got %v", err)
+}
+
+// TestOption_CompressionEncodesOnce 测试小于阈值的消息体只序列化一次
+func TestOption_CompressionEncodesOnce(t *testing.T) {
+	client := startTestServer(t).dial(&Option{Compression: codec.Gzip})
+	var reply Counted
+	err := client.Call(context.Background(), "Repeat.Echo", Counted{N: 7}, &reply)
+	_assert(err == nil && reply.N == 7, "unexpected reply %+v, %v", reply, err)
+	_assert(atomic.LoadInt32(&countedEncodes) == 2, "expect one encode for the request and one for the reply, got %d", countedEncodes)
+}
@@ -0,0 +1,129 @@
+package GeeRPC
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// serverConn Server上一个正在服务的连接
+type serverConn struct {
+	id     uint64
+	remote string
+	// conn 强制关闭时关闭的连接
+	conn io.Closer
+	// opt 协商的选项
+	opt   Option
+	tls   bool
+	start time.Time
+	// traffic 连接上收发的字节数
+	traffic *connMetrics
+	// served 已处理完的调用数
+	served uint64
+	mu     sync.Mutex
+	// calls 该连接上正在处理的调用
+	calls map[*request]inFlightCall
+	// queue 工作池模式下该连接的请求队列, 多路复用时所有的流共用
+	queue *connQueue
+}
+
+// inFlightCall 正在处理的调用, 开始处理时记录, 之后不再读取request
+type inFlightCall struct {
+	method string
+	seq    uint64
+	start  time.Time
+}
+
+type connKey struct{}
+
+// countTraffic 统计conn上收发的字节数, 交给 trackConn
+func countTraffic(conn io.ReadWriteCloser) (io.ReadWriteCloser, *connMetrics) {
+	traffic := new(connMetrics)
+	return &meteredConn{ReadWriteCloser: conn, m: traffic}, traffic
+}
+
+// trackConn 记录一个完成Option协商的连接, 返回携带该连接的ctx, 连接结束后调用untrackConn
+func (server *Server) trackConn(ctx context.Context, conn io.Closer, remote string, opt *Option, traffic *connMetrics) (*serverConn, context.Context) {
+	sc := &serverConn{
+		id:      atomic.AddUint64(&server.connSeq, 1),
+		remote:  remote,
+		conn:    conn,
+		opt:     *opt,
+		start:   time.Now(),
+		traffic: traffic,
+		calls:   make(map[*request]inFlightCall),
+	}
+	if p, ok := PeerFromContext(ctx); ok && p.TLS != nil {
+		sc.tls = true
+	}
+	if server.pool != nil {
+		sc.queue = server.pool.newQueue()
+	}
+	server.conns.Store(sc.id, sc)
+	return sc, context.WithValue(ctx, connKey{}, sc)
+}
+
+func (server *Server) untrackConn(sc *serverConn) {
+	server.conns.Delete(sc.id)
+}
+
+// connFromContext 返回请求所在的连接, 不是通过 ServeConn 服务的连接返回nil
+func connFromContext(ctx context.Context) *serverConn {
+	sc, _ := ctx.Value(connKey{}).(*serverConn)
+	return sc
+}
+
+// begin 记录req开始处理
+func (sc *serverConn) begin(req *request) {
+	sc.mu.Lock()
+	sc.calls[req] = inFlightCall{method: req.h.ServiceMethod, seq: req.h.Seq, start: req.start}
+	sc.mu.Unlock()
+}
+
+// end 记录req处理结束
+func (sc *serverConn) end(req *request) {
+	sc.mu.Lock()
+	delete(sc.calls, req)
+	sc.mu.Unlock()
+	atomic.AddUint64(&sc.served, 1)
+}
+
+// CloseConn 强制关闭编号为id的连接, 连接上未完成的调用随之失败; 连接不存在时返回false
+//
+// 连接编号见调试页面或 Server.DebugInfo。
+func (server *Server) CloseConn(id uint64) bool {
+	v, ok := server.conns.Load(id)
+	if !ok {
+		return false
+	}
+	sc := v.(*serverConn)
+	server.log().Warn("rpc server: closing connection", "conn", id, "remote", sc.remote)
+	_ = sc.conn.Close()
+	return true
+}
+
+// connections 按连接的先后返回所有正在服务的连接
+func (server *Server) connections() []*serverConn {
+	var conns []*serverConn
+	server.conns.Range(func(_, v interface{}) bool {
+		conns = append(conns, v.(*serverConn))
+		return true
+	})
+	sort.Slice(conns, func(i, j int) bool { return conns[i].id < conns[j].id })
+	return conns
+}
+
+// inFlight 返回该连接上正在处理的调用, 按开始时间排序
+func (sc *serverConn) inFlight() []inFlightCall {
+	sc.mu.Lock()
+	calls := make([]inFlightCall, 0, len(sc.calls))
+	for _, c := range sc.calls {
+		calls = append(calls, c)
+	}
+	sc.mu.Unlock()
+	sort.Slice(calls, func(i, j int) bool { return calls[i].start.Before(calls[j].start) })
+	return calls
+}
@@ -1,15 +1,27 @@
 package GeeRPC
 
 import (
+	"GeeRPC/codec"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const debugText = `<html>
 	<body>
 	<title>GeeRPC Services</title>
-	{{range .}}
+	{{range .Services}}
 	<hr>
 	Service {{.Name}}
 	<hr>
@@ -23,6 +35,53 @@ const debugText = `<html>
 		{{end}}
 		</table>
 	{{end}}
+	<hr>
+	Connections
+	<hr>
+		<table>
+		<th align=center>ID</th><th align=center>Remote</th><th align=center>Options</th><th align=center>Connected</th>
+		<th align=center>Requests</th><th align=center>Bytes In</th><th align=center>Bytes Out</th><th></th>
+		{{range .Info.Connections}}
+			<tr>
+			<td align=center>{{.ID}}</td>
+			<td align=left font=fixed>{{.Remote}}</td>
+			<td align=left font=fixed>{{.Codec}}{{if .TLS}} tls{{end}}{{if .Multiplex}} multiplex{{end}}{{if .Compression}} {{.Compression}}{{end}}{{if .HandleTimeout}} timeout={{.HandleTimeout}}{{end}}</td>
+			<td align=left>{{.Connected.Format "2006-01-02 15:04:05"}}</td>
+			<td align=center>{{.Requests}}</td>
+			<td align=center>{{.BytesIn}}</td>
+			<td align=center>{{.BytesOut}}</td>
+			<td><form method="post"><input type="hidden" name="close" value="{{.ID}}"><input type="hidden" name="token" value="{{$.Token}}"><input type="submit" value="Close"></form></td>
+			</tr>
+		{{end}}
+		</table>
+	<hr>
+	In-flight Calls
+	<hr>
+		<table>
+		<th align=center>Conn</th><th align=center>Remote</th><th align=center>Method</th><th align=center>Seq</th><th align=center>Elapsed (ms)</th>
+		{{range .Info.InFlight}}
+			<tr>
+			<td align=center>{{.Conn}}</td>
+			<td align=left font=fixed>{{.Remote}}</td>
+			<td align=left font=fixed>{{.Method}}</td>
+			<td align=center>{{.Seq}}</td>
+			<td align=center>{{.ElapsedMs}}</td>
+			</tr>
+		{{end}}
+		</table>
+	{{range .Tables}}
+	<hr>
+	{{.Title}}
+	<hr>
+		<table>
+		{{range .Header}}<th align=center>{{.}}</th>{{end}}
+		{{range .Rows}}
+			<tr>
+			{{range .}}<td align=left font=fixed>{{.}}</td>{{end}}
+			</tr>
+		{{end}}
+		</table>
+	{{end}}
 	</body>
 	</html>`
 
@@ -37,8 +96,63 @@ type debugService struct {
 	Method map[string]*methodType
 }
 
-// Runs at /debug/geerpc
+// DebugTable 附加在调试页面上的表格, 如客户端的熔断器状态
+type DebugTable interface {
+	// DebugTitle 表格标题
+	DebugTitle() string
+	// DebugHeader 表头
+	DebugHeader() []string
+	// DebugRows 当前的表格内容
+	DebugRows() [][]string
+}
+
+// debugTables 已注册的附加表格
+var debugTables sync.Map
+
+// RegisterDebugTable 将t展示在所有Server的调试页面上
+func RegisterDebugTable(t DebugTable) {
+	debugTables.Store(t, struct{}{})
+}
+
+// UnregisterDebugTable 从调试页面上移除t
+func UnregisterDebugTable(t DebugTable) {
+	debugTables.Delete(t)
+}
+
+type debugTable struct {
+	Title  string
+	Header []string
+	Rows   [][]string
+}
+
+// debugToken 本进程的调试页面令牌, 关闭连接的表单必须带上它, 其他站点的页面无法读到它
+var debugToken = newDebugToken()
+
+func newDebugToken() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Runs at /debug/geerpc, 带 ?format=json 或 Accept: application/json 时返回 DebugInfo 和 close_token
+//
+// POST表单 close=<连接编号>&token=<close_token> 强制关闭该连接, 来自其他站点的请求被拒绝。
+// 能读取调试页面的人都能拿到令牌, 因此调试路径不应暴露给不受信任的网络。
 func (server debugHTTP) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodPost {
+		server.closeConn(w, req)
+		return
+	}
+	if wantJSON(req) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(struct {
+			DebugInfo
+			CloseToken string `json:"close_token"`
+		}{server.DebugInfo(), debugToken})
+		return
+	}
 	// Build a sorted version of the data.
 	var services []debugService
 	server.serviceMap.Range(func(namei, svci interface{}) bool {
@@ -49,8 +163,203 @@ func (server debugHTTP) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		})
 		return true
 	})
-	err := debug.Execute(w, services)
+	var tables []debugTable
+	debugTables.Range(func(ti, _ interface{}) bool {
+		t := ti.(DebugTable)
+		tables = append(tables, debugTable{Title: t.DebugTitle(), Header: t.DebugHeader(), Rows: t.DebugRows()})
+		return true
+	})
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Title < tables[j].Title })
+	err := debug.Execute(w, struct {
+		Services []debugService
+		Info     DebugInfo
+		Tables   []debugTable
+		Token    string
+	}{services, server.DebugInfo(), tables, debugToken})
 	if err != nil {
 		_, _ = fmt.Fprintln(w, "rpc: error executing template:", err.Error())
 	}
 }
+
+// DebugInfo 调试接口的JSON内容, 用于脚本化的健康检查
+type DebugInfo struct {
+	Services    []DebugServiceInfo `json:"services"`
+	Connections []DebugConnInfo    `json:"connections"`
+	InFlight    []DebugCallInfo    `json:"in_flight"`
+}
+
+// DebugServiceInfo 一个服务及其方法
+type DebugServiceInfo struct {
+	Name    string            `json:"name"`
+	Methods []DebugMethodInfo `json:"methods"`
+}
+
+// DebugMethodInfo 一个方法的签名和调用统计
+type DebugMethodInfo struct {
+	Name string `json:"name"`
+	// Signature 如 "Sum(main.Args, *int) error"
+	Signature string `json:"signature"`
+	ArgType   string `json:"arg_type"`
+	// ReplyType 双向流方法没有响应参数, 为空
+	ReplyType string `json:"reply_type,omitempty"`
+	// Stream 流式方法的种类: server、client或bidi, 普通方法为空
+	Stream  string         `json:"stream,omitempty"`
+	Calls   uint64         `json:"calls"`
+	Errors  uint64         `json:"errors"`
+	Latency LatencySummary `json:"latency"`
+}
+
+// LatencySummary 方法处理耗时的汇总
+type LatencySummary struct {
+	MeanMs float64 `json:"mean_ms"`
+	MaxMs  float64 `json:"max_ms"`
+}
+
+// DebugConnInfo 一个正在服务的连接
+type DebugConnInfo struct {
+	ID     uint64     `json:"id"`
+	Remote string     `json:"remote"`
+	Codec  codec.Type `json:"codec"`
+	// TLS, Multiplex, Compression, HandleTimeout 协商的连接选项
+	TLS           bool      `json:"tls"`
+	Multiplex     bool      `json:"multiplex"`
+	Compression   string    `json:"compression,omitempty"`
+	HandleTimeout string    `json:"handle_timeout,omitempty"`
+	Connected     time.Time `json:"connected"`
+	// Requests 已处理完的调用数
+	Requests uint64 `json:"requests"`
+	BytesIn  uint64 `json:"bytes_in"`
+	BytesOut uint64 `json:"bytes_out"`
+}
+
+// DebugCallInfo 一个正在处理的调用
+type DebugCallInfo struct {
+	Conn      uint64  `json:"conn"`
+	Remote    string  `json:"remote"`
+	Method    string  `json:"method"`
+	Seq       uint64  `json:"seq"`
+	ElapsedMs float64 `json:"elapsed_ms"`
+}
+
+var streamKindNames = [...]string{streamServer: "server", streamClient: "client", streamBidi: "bidi"}
+
+// DebugInfo 返回服务、连接和正在处理的调用的快照
+func (server *Server) DebugInfo() DebugInfo {
+	info := DebugInfo{Services: []DebugServiceInfo{}, Connections: []DebugConnInfo{}, InFlight: []DebugCallInfo{}}
+	server.serviceMap.Range(func(_, svci interface{}) bool {
+		svc := svci.(*service)
+		si := DebugServiceInfo{Name: svc.name, Methods: []DebugMethodInfo{}}
+		for _, name := range svc.methodNames() {
+			si.Methods = append(si.Methods, svc.method[name].debugInfo(name))
+		}
+		info.Services = append(info.Services, si)
+		return true
+	})
+	sort.Slice(info.Services, func(i, j int) bool { return info.Services[i].Name < info.Services[j].Name })
+	now := time.Now()
+	for _, sc := range server.connections() {
+		info.Connections = append(info.Connections, sc.debugInfo())
+		for _, c := range sc.inFlight() {
+			info.InFlight = append(info.InFlight, DebugCallInfo{
+				Conn:      sc.id,
+				Remote:    sc.remote,
+				Method:    c.method,
+				Seq:       c.seq,
+				ElapsedMs: durationMs(now.Sub(c.start)),
+			})
+		}
+	}
+	return info
+}
+
+func (m *methodType) debugInfo(name string) DebugMethodInfo {
+	mi := DebugMethodInfo{
+		Name:    name,
+		ArgType: m.ArgType.String(),
+		Stream:  streamKindNames[m.stream],
+		Calls:   m.NumCalls(),
+		Errors:  atomic.LoadUint64(&m.numErrors),
+	}
+	params := []string{mi.ArgType}
+	if m.ReplyType != nil {
+		mi.ReplyType = m.ReplyType.String()
+		params = append(params, mi.ReplyType)
+	}
+	if m.withContext {
+		params = append([]string{typeOfContext.String()}, params...)
+	}
+	mi.Signature = name + "(" + strings.Join(params, ", ") + ") error"
+	if n := atomic.LoadUint64(&m.numRecorded); n > 0 {
+		mi.Latency.MeanMs = durationMs(time.Duration(atomic.LoadUint64(&m.latencyNanos) / n))
+	}
+	mi.Latency.MaxMs = durationMs(time.Duration(atomic.LoadUint64(&m.maxLatencyNanos)))
+	return mi
+}
+
+// durationMs 以毫秒表示d, 保留3位小数
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func (sc *serverConn) debugInfo() DebugConnInfo {
+	ci := DebugConnInfo{
+		ID:          sc.id,
+		Remote:      sc.remote,
+		Codec:       sc.opt.CodecType,
+		TLS:         sc.tls,
+		Multiplex:   sc.opt.Multiplex,
+		Compression: sc.opt.Compression,
+		Connected:   sc.start,
+		Requests:    atomic.LoadUint64(&sc.served),
+		BytesIn:     atomic.LoadUint64(&sc.traffic.bytesIn),
+		BytesOut:    atomic.LoadUint64(&sc.traffic.bytesOut),
+	}
+	if sc.opt.HandleTimeout > 0 {
+		ci.HandleTimeout = sc.opt.HandleTimeout.String()
+	}
+	return ci
+}
+
+// wantJSON 请求要求JSON格式的调试信息
+func wantJSON(req *http.Request) bool {
+	return req.URL.Query().Get("format") == "json" || strings.Contains(req.Header.Get("Accept"), "application/json")
+}
+
+// closeConn 处理强制关闭连接的POST请求, 完成后回到调试页面
+func (server debugHTTP) closeConn(w http.ResponseWriter, req *http.Request) {
+	if !sameOrigin(req) {
+		http.Error(w, "rpc: cross-origin request", http.StatusForbidden)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(req.FormValue("token")), []byte(debugToken)) != 1 {
+		http.Error(w, "rpc: invalid token", http.StatusForbidden)
+		return
+	}
+	id, err := strconv.ParseUint(req.FormValue("close"), 10, 64)
+	if err != nil {
+		http.Error(w, "rpc: invalid connection id", http.StatusBadRequest)
+		return
+	}
+	if !server.CloseConn(id) {
+		http.Error(w, "rpc: connection not found", http.StatusNotFound)
+		return
+	}
+	if wantJSON(req) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]uint64{"closed": id})
+		return
+	}
+	http.Redirect(w, req, req.URL.Path, http.StatusSeeOther)
+}
+
+// sameOrigin 请求不是由其他站点的页面发起的; 没有 Sec-Fetch-Site 和 Origin 的请求(如curl)视为同源
+func sameOrigin(req *http.Request) bool {
+	if site := req.Header.Get("Sec-Fetch-Site"); site != "" && site != "same-origin" && site != "none" {
+		return false
+	}
+	if origin := req.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		return err == nil && u.Host == req.Host
+	}
+	return true
+}
@@ -0,0 +1,149 @@
+package GeeRPC
+
+import (
+	"GeeRPC/codec"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeTable struct{}
+
+func (fakeTable) DebugTitle() string    { return "Fake Table" }
+func (fakeTable) DebugHeader() []string { return []string{"Address", "State"} }
+func (fakeTable) DebugRows() [][]string { return [][]string{{"tcp@127.0.0.1:1", "open"}} }
+
+// TestDebugHTTP 测试调试页面展示服务和附加表格
+func TestDebugHTTP(t *testing.T) {
+	server := NewServer()
+	var foo Foo
+	_ = server.Register(&foo)
+	RegisterDebugTable(fakeTable{})
+	defer UnregisterDebugTable(fakeTable{})
+
+	w := httptest.NewRecorder()
+	debugHTTP{server}.ServeHTTP(w, httptest.NewRequest("GET", defaultDebugPath, nil))
+	body := w.Body.String()
+	_assert(strings.Contains(body, "Service Foo"), "expect service in debug page")
+	_assert(strings.Contains(body, "Fake Table") && strings.Contains(body, "tcp@127.0.0.1:1"), "expect debug table in debug page")
+}
+
+// Slow 阻塞到release被关闭
+type Slow struct {
+	release chan struct{}
+}
+
+func (s *Slow) Wait(n int, reply *int) error {
+	<-s.release
+	*reply = n
+	return nil
+}
+
+// TestDebugHTTP_json 测试JSON调试接口中的方法统计、连接和正在处理的调用
+func TestDebugHTTP_json(t *testing.T) {
+	t.Parallel()
+	server := NewServer()
+	slow := &Slow{release: make(chan struct{})}
+	_ = server.Register(new(Foo))
+	_ = server.Register(new(Failing))
+	_ = server.Register(slow)
+	l, _ := net.Listen("tcp", ":0")
+	defer func() { _ = l.Close() }()
+	go server.Accept(l)
+	client, err := Dial("tcp", l.Addr().String())
+	_assert(err == nil, "dial failed: %v", err)
+	defer func() { _ = client.Close() }()
+
+	var reply int
+	_ = client.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_ = client.Call(context.Background(), "Failing.Fail", int(NotFound), &reply)
+	call := client.Go("Slow.Wait", 7, &reply, nil)
+	waitFor(func() bool { return len(server.DebugInfo().InFlight) == 1 })
+
+	w := httptest.NewRecorder()
+	debugHTTP{server}.ServeHTTP(w, httptest.NewRequest("GET", defaultDebugPath+"?format=json", nil))
+	_assert(w.Header().Get("Content-Type") == "application/json", "expect json content type")
+	var info DebugInfo
+	_assert(json.Unmarshal(w.Body.Bytes(), &info) == nil, "invalid json: %s", w.Body.String())
+	_assert(len(info.Services) == 4 && info.Services[0].Name == "Failing" && info.Services[1].Name == "Foo" && info.Services[2].Name == ReflectionService, "unexpected services %+v", info.Services)
+	sum := info.Services[1].Methods[0]
+	_assert(sum.Name == "Sum" && sum.Signature == "Sum(GeeRPC.Args, *int) error" && sum.Calls == 1 && sum.Errors == 0, "unexpected method %+v", sum)
+	fail := info.Services[0].Methods[0]
+	_assert(fail.Calls == 1 && fail.Errors == 1 && fail.Latency.MaxMs >= fail.Latency.MeanMs, "unexpected method %+v", fail)
+	_assert(len(info.Connections) == 1 && info.Connections[0].Codec == codec.GobType && info.Connections[0].Remote != "", "unexpected connections %+v", info.Connections)
+	_assert(len(info.InFlight) == 1 && info.InFlight[0].Method == "Slow.Wait" && info.InFlight[0].Conn == info.Connections[0].ID, "unexpected in-flight calls %+v", info.InFlight)
+
+	close(slow.release)
+	<-call.Done
+	waitFor(func() bool { return len(server.DebugInfo().InFlight) == 0 })
+	_assert(len(server.DebugInfo().InFlight) == 0, "call should no longer be in flight")
+	_ = client.Close()
+	waitFor(func() bool { return len(server.DebugInfo().Connections) == 0 })
+	_assert(len(server.DebugInfo().Connections) == 0, "closed connection should be removed")
+}
+
+// TestServer_CloseConn 测试连接的统计和通过调试页面强制关闭连接
+func TestServer_CloseConn(t *testing.T) {
+	t.Parallel()
+	server := NewServer()
+	_ = server.Register(new(Foo))
+	l, _ := net.Listen("tcp", ":0")
+	defer func() { _ = l.Close() }()
+	go server.Accept(l)
+	client, err := Dial("tcp", l.Addr().String(), &Option{Compression: codec.Gzip, HandleTimeout: time.Second})
+	_assert(err == nil, "dial failed: %v", err)
+	defer func() { _ = client.Close() }()
+	var reply int
+	_assert(client.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply) == nil, "Foo.Sum failed")
+	waitFor(func() bool {
+		return len(server.DebugInfo().Connections) == 1 && server.DebugInfo().Connections[0].Requests == 1
+	})
+
+	conn := server.DebugInfo().Connections[0]
+	_assert(conn.Requests == 1 && conn.BytesIn > 0 && conn.BytesOut > 0, "unexpected traffic %+v", conn)
+	_assert(conn.Compression == codec.Gzip && conn.HandleTimeout == "1s" && !conn.Multiplex && !conn.TLS, "unexpected options %+v", conn)
+
+	w := httptest.NewRecorder()
+	debugHTTP{server}.ServeHTTP(w, httptest.NewRequest("GET", defaultDebugPath, nil))
+	page := w.Body.String()
+	_assert(strings.Contains(page, "Connections") && strings.Contains(page, conn.Remote) && strings.Contains(page, "In-flight Calls"), "expect connection table in debug page")
+
+	_assert(strings.Contains(page, `name="token" value="`+debugToken+`"`), "expect the token in the close form")
+
+	w = httptest.NewRecorder()
+	debugHTTP{server}.ServeHTTP(w, httptest.NewRequest("GET", defaultDebugPath+"?format=json", nil))
+	var info struct {
+		CloseToken string `json:"close_token"`
+	}
+	_assert(json.NewDecoder(w.Body).Decode(&info) == nil && info.CloseToken == debugToken, "expect close_token in the JSON page")
+
+	post := func(form string, header ...string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", defaultDebugPath, strings.NewReader(form))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		debugHTTP{server}.ServeHTTP(w, r)
+		return w.Code
+	}
+	closeForm := fmt.Sprintf("close=%d&token=%s", conn.ID, debugToken)
+	_assert(post(fmt.Sprintf("close=%d", conn.ID)) == http.StatusForbidden, "expect 403 without the token")
+	_assert(post(fmt.Sprintf("close=%d&token=guess", conn.ID)) == http.StatusForbidden, "expect 403 for a wrong token")
+	_assert(post(closeForm, "Origin", "http://evil.example") == http.StatusForbidden, "expect 403 for a cross-origin request")
+	_assert(post(closeForm, "Sec-Fetch-Site", "cross-site") == http.StatusForbidden, "expect 403 for a cross-site request")
+	_assert(client.IsAvailable(), "rejected requests should not close the connection")
+	_assert(post("close=999&token="+debugToken) == http.StatusNotFound, "expect 404 for unknown connection")
+	code := post(closeForm, "Origin", "http://example.com", "Sec-Fetch-Site", "same-origin")
+	_assert(code == http.StatusSeeOther, "expect redirect after close, got %d", code)
+	waitFor(func() bool { return !client.IsAvailable() })
+	_assert(!client.IsAvailable(), "client should see the connection closed")
+	waitFor(func() bool { return len(server.DebugInfo().Connections) == 0 })
+	_assert(len(server.DebugInfo().Connections) == 0, "closed connection should be removed")
+}
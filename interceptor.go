@@ -0,0 +1,40 @@
+package GeeRPC
+
+import "context"
+
+// ServerInfo 传给拦截器的请求信息
+type ServerInfo struct {
+	// ServiceMethod 调用的方法, 格式为 "Service.Method"
+	ServiceMethod string
+	// Args 请求参数
+	Args interface{}
+	// Reply 返回值, 在next返回后才被填充
+	Reply interface{}
+}
+
+// Handler 继续处理请求, 最终调用服务方法
+type Handler func(ctx context.Context) error
+
+// ServerInterceptor 服务端拦截器, 包裹服务方法的调用
+//
+// 拦截器可以通过 PeerFromContext 和 IncomingMetadata 获取调用方信息,
+// 调用next继续处理, 不调用next时请求以其返回的错误结束。
+type ServerInterceptor func(ctx context.Context, info *ServerInfo, next Handler) error
+
+// WithInterceptor 添加服务端拦截器, 多个拦截器按添加顺序由外向内执行
+func WithInterceptor(interceptors ...ServerInterceptor) ServerOption {
+	return func(server *Server) {
+		server.interceptors = append(server.interceptors, interceptors...)
+	}
+}
+
+// chain 将拦截器和handler组合为一个Handler
+func chain(interceptors []ServerInterceptor, info *ServerInfo, handler Handler) Handler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context) error {
+			return interceptor(ctx, info, next)
+		}
+	}
+	return handler
+}
@@ -0,0 +1,184 @@
+package GeeRPC
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Limits 服务端的限流配置, 超出限制的请求以ResourceExhausted拒绝, 不会为其创建goroutine
+type Limits struct {
+	// MaxInFlight 整个Server同时处理的请求数上限, 0表示不限制
+	MaxInFlight int
+	// Methods 按服务或方法配置的限制, key为 "Service" 或 "Service.Method", 两者都配置时同时生效
+	Methods map[string]MethodLimit
+}
+
+// MethodLimit 单个服务或方法的限制
+type MethodLimit struct {
+	// MaxConcurrent 同时处理的请求数上限, 0表示不限制
+	MaxConcurrent int
+	// Rate 令牌桶每秒生成的令牌数, 即平均每秒允许的请求数, 0表示不限制
+	Rate float64
+	// Burst 令牌桶容量, 即允许的突发请求数, 默认为 max(1, Rate)
+	Burst int
+	// KeyBy 不为空时, 按该元数据的值(如客户端标识)分别计算上述限制
+	KeyBy string
+}
+
+// WithLimits 为Server配置限流
+func WithLimits(l Limits) ServerOption {
+	return func(server *Server) {
+		server.limiter = newLimiter(l)
+	}
+}
+
+// maxLimitKeys 每个限制保留的KeyBy状态数, 超出时清理空闲的状态
+const maxLimitKeys = 4096
+
+// limiter 实现Limits
+type limiter struct {
+	maxInFlight int64
+	inFlight    int64
+	// methods key为 "Service" 或 "Service.Method"
+	methods map[string]*methodLimiter
+}
+
+// methodLimiter 单个服务或方法的限制状态
+type methodLimiter struct {
+	limit MethodLimit
+	mu    sync.Mutex
+	// keys KeyBy的值对应的状态, 未配置KeyBy时只有""一项
+	keys map[string]*limitState
+}
+
+// limitState 同一个KeyBy值的并发数和令牌桶
+type limitState struct {
+	inFlight int
+	tokens   float64
+	last     time.Time
+}
+
+func newLimiter(l Limits) *limiter {
+	lim := &limiter{maxInFlight: int64(l.MaxInFlight), methods: make(map[string]*methodLimiter)}
+	for name, ml := range l.Methods {
+		if ml.Burst <= 0 {
+			ml.Burst = int(ml.Rate)
+			if ml.Burst < 1 {
+				ml.Burst = 1
+			}
+		}
+		lim.methods[name] = &methodLimiter{limit: ml, keys: make(map[string]*limitState)}
+	}
+	return lim
+}
+
+// acquire 为请求申请执行名额, 成功时返回的release必须在请求处理完成后调用
+func (lim *limiter) acquire(serviceMethod string, md map[string]string) (release func(), err error) {
+	if lim.maxInFlight > 0 && atomic.AddInt64(&lim.inFlight, 1) > lim.maxInFlight {
+		atomic.AddInt64(&lim.inFlight, -1)
+		return nil, Errorf(ResourceExhausted, "rpc server: too many requests in flight (max %d)", lim.maxInFlight)
+	}
+	releaseGlobal := func() {
+		if lim.maxInFlight > 0 {
+			atomic.AddInt64(&lim.inFlight, -1)
+		}
+	}
+	// 先检查方法的限制, 再检查整个服务的限制
+	mls := make([]*methodLimiter, 0, 2)
+	if ml := lim.methods[serviceMethod]; ml != nil {
+		mls = append(mls, ml)
+	}
+	if dot := strings.LastIndex(serviceMethod, "."); dot >= 0 {
+		if ml := lim.methods[serviceMethod[:dot]]; ml != nil {
+			mls = append(mls, ml)
+		}
+	}
+	keys := make([]string, len(mls))
+	for i, ml := range mls {
+		if ml.limit.KeyBy != "" {
+			keys[i] = md[ml.limit.KeyBy]
+		}
+		if err := ml.acquire(keys[i], serviceMethod); err != nil {
+			for j := 0; j < i; j++ { // 被后面的限制拒绝, 归还已占用的名额和令牌
+				mls[j].undo(keys[j])
+			}
+			releaseGlobal()
+			return nil, err
+		}
+	}
+	return func() {
+		for i, ml := range mls {
+			ml.release(keys[i])
+		}
+		releaseGlobal()
+	}, nil
+}
+
+// refill 按时间补充令牌, 调用方持有锁
+func (ml *methodLimiter) refill(st *limitState, now time.Time) {
+	st.tokens += now.Sub(st.last).Seconds() * ml.limit.Rate
+	if burst := float64(ml.limit.Burst); st.tokens > burst {
+		st.tokens = burst
+	}
+	st.last = now
+}
+
+func (ml *methodLimiter) acquire(key, serviceMethod string) error {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	now := time.Now()
+	st, ok := ml.keys[key]
+	if !ok {
+		if len(ml.keys) >= maxLimitKeys {
+			ml.sweep(now)
+		}
+		st = &limitState{tokens: float64(ml.limit.Burst), last: now}
+		ml.keys[key] = st
+	}
+	if ml.limit.MaxConcurrent > 0 && st.inFlight >= ml.limit.MaxConcurrent {
+		return Errorf(ResourceExhausted, "rpc server: too many concurrent requests for %s (max %d)", serviceMethod, ml.limit.MaxConcurrent)
+	}
+	if ml.limit.Rate > 0 {
+		ml.refill(st, now)
+		if st.tokens < 1 {
+			return Errorf(ResourceExhausted, "rpc server: rate limit exceeded for %s (%g/s)", serviceMethod, ml.limit.Rate)
+		}
+		st.tokens--
+	}
+	st.inFlight++
+	return nil
+}
+
+func (ml *methodLimiter) release(key string) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	if st, ok := ml.keys[key]; ok {
+		st.inFlight--
+	}
+}
+
+// undo 撤销一次成功的acquire, 归还名额和令牌
+func (ml *methodLimiter) undo(key string) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	if st, ok := ml.keys[key]; ok {
+		st.inFlight--
+		if ml.limit.Rate > 0 && st.tokens+1 <= float64(ml.limit.Burst) {
+			st.tokens++
+		}
+	}
+}
+
+// sweep 清理没有请求在处理且令牌桶已满的状态, 调用方持有锁
+func (ml *methodLimiter) sweep(now time.Time) {
+	for key, st := range ml.keys {
+		if ml.limit.Rate > 0 {
+			ml.refill(st, now)
+		}
+		if st.inFlight == 0 && (ml.limit.Rate == 0 || st.tokens >= float64(ml.limit.Burst)) {
+			delete(ml.keys, key)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package GeeRPC
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Gate 阻塞直到gate被关闭
+type Gate struct{ ch chan struct{} }
+
+func (g *Gate) Wait(arg int, reply *int) error {
+	<-g.ch
+	*reply = arg
+	return nil
+}
+
+func TestLimits_concurrency(t *testing.T) {
+	t.Parallel()
+	gate := &Gate{ch: make(chan struct{})}
+	ts := startTestServer(t, WithLimits(Limits{
+		MaxInFlight: 2,
+		Methods:     map[string]MethodLimit{"Gate.Wait": {MaxConcurrent: 1}},
+	}))
+	_ = ts.Register(gate)
+	client := ts.dial()
+	var r1, r2 int
+	first := client.Go("Gate.Wait", 1, &r1, nil)
+	time.Sleep(50 * time.Millisecond) // 等待第一个请求开始处理
+	err := client.Call(context.Background(), "Gate.Wait", 2, &r2)
+	_assert(CodeOf(err) == ResourceExhausted, "expect ResourceExhausted for the method cap, got %v", err)
+
+	var sum int
+	err = client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &sum)
+	_assert(err == nil && sum == 3, "expect other methods to pass, got %v", err)
+
+	close(gate.ch)
+	<-first.Done
+	_assert(first.Error == nil && r1 == 1, "expect the admitted call to succeed, got %v", first.Error)
+	err = client.Call(context.Background(), "Gate.Wait", 3, &r2)
+	_assert(err == nil && r2 == 3, "expect the slot to be released, got %v", err)
+}
+
+// TestLimits_serviceAndMethod 测试同时配置服务和方法的限制时两者都生效
+func TestLimits_serviceAndMethod(t *testing.T) {
+	t.Parallel()
+	gate := &Gate{ch: make(chan struct{})}
+	ts := startTestServer(t, WithLimits(Limits{
+		Methods: map[string]MethodLimit{"Gate": {MaxConcurrent: 1}, "Gate.Wait": {MaxConcurrent: 2}},
+	}))
+	_ = ts.Register(gate)
+	client := ts.dial()
+	var r1, r2 int
+	first := client.Go("Gate.Wait", 1, &r1, nil)
+	time.Sleep(50 * time.Millisecond)
+	err := client.Call(context.Background(), "Gate.Wait", 2, &r2)
+	_assert(CodeOf(err) == ResourceExhausted, "expect the service cap to apply to the method, got %v", err)
+	close(gate.ch)
+	<-first.Done
+	err = client.Call(context.Background(), "Gate.Wait", 3, &r2)
+	_assert(err == nil && r2 == 3, "expect both slots to be released, got %v", err)
+}
+
+func TestLimits_global(t *testing.T) {
+	t.Parallel()
+	gate := &Gate{ch: make(chan struct{})}
+	ts := startTestServer(t, WithLimits(Limits{MaxInFlight: 1}))
+	_ = ts.Register(gate)
+	client := ts.dial()
+	var r1, sum int
+	first := client.Go("Gate.Wait", 1, &r1, nil)
+	time.Sleep(50 * time.Millisecond)
+	err := client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &sum)
+	_assert(CodeOf(err) == ResourceExhausted, "expect ResourceExhausted for the global cap, got %v", err)
+	close(gate.ch)
+	<-first.Done
+}
+
+func TestLimits_rateByKey(t *testing.T) {
+	t.Parallel()
+	client := startTestServer(t, WithLimits(Limits{
+		Methods: map[string]MethodLimit{"Foo": {Rate: 1, Burst: 2, KeyBy: "client-id"}},
+	})).dial()
+	var sum int
+	a := WithMetadata(context.Background(), Metadata{"client-id": "a"})
+	for i := 0; i < 2; i++ {
+		err := client.Call(a, "Foo.Sum", Args{Num1: 1, Num2: 2}, &sum)
+		_assert(err == nil, "expect burst to pass, got %v", err)
+	}
+	err := client.Call(a, "Foo.Sum", Args{Num1: 1, Num2: 2}, &sum)
+	_assert(CodeOf(err) == ResourceExhausted, "expect rate limit for client a, got %v", err)
+
+	b := WithMetadata(context.Background(), Metadata{"client-id": "b"})
+	err = client.Call(b, "Foo.Sum", Args{Num1: 1, Num2: 2}, &sum)
+	_assert(err == nil, "expect client b to have its own bucket, got %v", err)
+}
+
+// TestLimits_observed 测试被拒绝的请求也记录指标、追踪和访问日志
+func TestLimits_observed(t *testing.T) {
+	t.Parallel()
+	m, exp, logger := NewMetrics(), new(InMemoryExporter), new(recordLogger)
+	client := startTestServer(t,
+		WithLimits(Limits{Methods: map[string]MethodLimit{"Foo.Sum": {Rate: 0.001, Burst: 1}}}),
+		WithMetrics(m, ""), WithTracer(NewTracer(exp)), WithLogger(logger), WithAccessLog(1),
+	).dial()
+
+	var sum int
+	_assert(client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &sum) == nil, "expect the first call to pass")
+	err := client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &sum)
+	_assert(CodeOf(err) == ResourceExhausted, "expect rate limit, got %v", err)
+
+	spans := waitSpans(exp, 2)
+	_assert(len(spans) == 2 && spans[1].Code == ResourceExhausted, "expect a ResourceExhausted span, got %d spans", len(spans))
+	_assert(logger.find("rpc server: access", "code=ResourceExhausted") != "", "expect an access log for the rejection")
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", defaultMetricsPath, nil))
+	want := `geerpc_errors_total{side="server",method="Foo.Sum",code="ResourceExhausted"} 1`
+	_assert(strings.Contains(w.Body.String(), want), "expect %q in metrics:\n%s", want, w.Body.String())
+}
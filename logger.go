@@ -0,0 +1,166 @@
+package GeeRPC
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+)
+
+// Logger 分级的结构化日志, 方法集与 *slog.Logger 相同, 可以直接传入 slog.Default()
+//
+// args为交替的键和值, 如 "remote", addr, "seq", 1。
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// Level 日志级别, 取值与slog.Level一致
+type Level int
+
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+func (l Level) String() string {
+	switch {
+	case l < LevelInfo:
+		return "DEBUG"
+	case l < LevelWarn:
+		return "INFO"
+	case l < LevelError:
+		return "WARN"
+	}
+	return "ERROR"
+}
+
+// NewStdLogger 返回把不低于level的日志以 "LEVEL msg key=value ..." 的格式写入l的Logger, l为nil时使用log的默认Logger
+func NewStdLogger(l *log.Logger, level Level) Logger {
+	if l == nil {
+		l = log.Default()
+	}
+	return &stdLogger{l: l, level: level}
+}
+
+// defaultLogger 没有配置Logger时使用, 与之前直接调用log包的输出位置相同
+var defaultLogger = NewStdLogger(nil, LevelInfo)
+
+// stdLogger 基于标准库log的Logger
+type stdLogger struct {
+	l     *log.Logger
+	level Level
+}
+
+func (s *stdLogger) Debug(msg string, args ...any) { s.log(LevelDebug, msg, args) }
+func (s *stdLogger) Info(msg string, args ...any)  { s.log(LevelInfo, msg, args) }
+func (s *stdLogger) Warn(msg string, args ...any)  { s.log(LevelWarn, msg, args) }
+func (s *stdLogger) Error(msg string, args ...any) { s.log(LevelError, msg, args) }
+
+func (s *stdLogger) log(level Level, msg string, args []any) {
+	if level < s.level {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for i := 0; i < len(args); i += 2 {
+		b.WriteByte(' ')
+		if i+1 == len(args) { // 缺少值的键, 与slog一样记为!BADKEY
+			fmt.Fprintf(&b, "!BADKEY=%v", args[i])
+			break
+		}
+		v := fmt.Sprint(args[i+1])
+		if strings.ContainsAny(v, " \"=") || v == "" {
+			v = fmt.Sprintf("%q", v)
+		}
+		fmt.Fprintf(&b, "%v=%s", args[i], v)
+	}
+	_ = s.l.Output(3, b.String())
+}
+
+// WithLogger 设置Server的日志, 默认写入log的默认Logger
+func WithLogger(l Logger) ServerOption {
+	return func(server *Server) {
+		server.logger = l
+	}
+}
+
+// WithAccessLog 为Server开启访问日志: 失败的调用都被记录, 成功的调用按rate(0到1)的比例采样记录
+func WithAccessLog(rate float64) ServerOption {
+	return func(server *Server) {
+		server.accessLogRate = rate
+	}
+}
+
+func (server *Server) log() Logger {
+	if server.logger == nil {
+		return defaultLogger
+	}
+	return server.logger
+}
+
+func (client *Client) log() Logger {
+	return client.opt.logger()
+}
+
+// logAccess 按采样率记录一次调用, 失败的调用总是记录
+func logAccess(l Logger, rate float64, msg, remote, serviceMethod string, seq uint64, latency time.Duration, err error) {
+	if err == nil && (rate <= 0 || (rate < 1 && rand.Float64() >= rate)) {
+		return
+	}
+	args := []any{"remote", remote, "method", serviceMethod, "seq", seq, "latency", latency, "code", CodeOf(err)}
+	if err != nil {
+		l.Warn(msg, append(args, "error", err)...)
+		return
+	}
+	l.Info(msg, args...)
+}
+
+// logger 返回opt中的Logger, 没有配置时返回默认的Logger
+func (opt *Option) logger() Logger {
+	if opt == nil || opt.Logger == nil {
+		return defaultLogger
+	}
+	return opt.Logger
+}
+
+// logAccess 记录服务端的一次调用
+func (server *Server) logAccess(req *request, err error) {
+	var remote string
+	if p, ok := PeerFromContext(req.ctx); ok && p.Addr != nil {
+		remote = p.Addr.String()
+	}
+	logAccess(server.log(), server.accessLogRate, "rpc server: access", remote, req.h.ServiceMethod, req.h.Seq, time.Since(req.start), err)
+}
+
+// logCall 按 Option.AccessLogRate 在调用结束时记录客户端的访问日志
+func (client *Client) logCall(call *Call) {
+	rate := client.opt.AccessLogRate
+	if rate <= 0 {
+		return
+	}
+	start, observe := time.Now(), call.observe
+	call.observe = func(err error) {
+		logAccess(client.log(), rate, "rpc client: access", client.remote, call.ServiceMethod, call.Seq, time.Since(start), err)
+		if observe != nil {
+			observe(err)
+		}
+	}
+}
+
+// remoteAddr 返回连接的对端地址, 连接不是net.Conn时返回空
+func remoteAddr(conn io.ReadWriteCloser) string {
+	if c, ok := conn.(net.Conn); ok && c.RemoteAddr() != nil {
+		return c.RemoteAddr().String()
+	}
+	return ""
+}
@@ -0,0 +1,113 @@
+package GeeRPC
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewStdLogger(log.New(&buf, "", 0), LevelInfo)
+	l.Debug("hidden")
+	l.Info("rpc server: access", "method", "Foo.Sum", "seq", 3, "error", "bad thing")
+	l.Error("odd", "key")
+	want := "INFO rpc server: access method=Foo.Sum seq=3 error=\"bad thing\"\nERROR odd !BADKEY=key\n"
+	_assert(buf.String() == want, "unexpected output:\n%s", buf.String())
+}
+
+// recordLogger 记录日志, 用于测试
+type recordLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (r *recordLogger) record(level, msg string, args []any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	line := level + " " + msg
+	for i := 0; i+1 < len(args); i += 2 {
+		line += fmt.Sprintf(" %v=%v", args[i], args[i+1])
+	}
+	r.lines = append(r.lines, line)
+}
+
+func (r *recordLogger) Debug(msg string, args ...any) { r.record("DEBUG", msg, args) }
+func (r *recordLogger) Info(msg string, args ...any)  { r.record("INFO", msg, args) }
+func (r *recordLogger) Warn(msg string, args ...any)  { r.record("WARN", msg, args) }
+func (r *recordLogger) Error(msg string, args ...any) { r.record("ERROR", msg, args) }
+
+// find 返回包含所有parts的第一行
+func (r *recordLogger) find(parts ...string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+next:
+	for _, line := range r.lines {
+		for _, p := range parts {
+			if !strings.Contains(line, p) {
+				continue next
+			}
+		}
+		return line
+	}
+	return ""
+}
+
+// waitFor 等待cond成立, 最多等待1秒
+func waitFor(cond func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !cond() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWithAccessLog(t *testing.T) {
+	t.Parallel()
+	serverLog, clientLog := new(recordLogger), new(recordLogger)
+	server := NewServer(WithLogger(serverLog), WithAccessLog(1))
+	_ = server.Register(new(Foo))
+	_ = server.Register(new(Failing))
+	_assert(serverLog.find("DEBUG rpc server: register", "Foo.Sum") != "", "expect registration logged")
+	l, _ := net.Listen("tcp", ":0")
+	defer func() { _ = l.Close() }()
+	go server.Accept(l)
+	client, err := Dial("tcp", l.Addr().String(), &Option{Logger: clientLog, AccessLogRate: 1})
+	_assert(err == nil, "dial failed: %v", err)
+	defer func() { _ = client.Close() }()
+
+	var reply int
+	_ = client.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	_ = client.Call(context.Background(), "Failing.Fail", int(NotFound), &reply)
+	waitFor(func() bool { return serverLog.find("Failing.Fail") != "" })
+	_assert(serverLog.find("INFO rpc server: access", "remote", "remote=", "method=Foo.Sum", "seq=1", "latency=", "code=OK") != "", "expect server access log")
+	_assert(serverLog.find("WARN rpc server: access", "Failing.Fail", "code=NotFound", "error=") != "", "expect failed call logged as warning")
+	_assert(clientLog.find("INFO rpc client: access", "Foo.Sum", "code=OK") != "", "expect client access log")
+	_assert(clientLog.find("WARN rpc client: access", "Failing.Fail") != "", "expect failed client call logged")
+}
+
+func TestWithAccessLog_sampled(t *testing.T) {
+	t.Parallel()
+	serverLog := new(recordLogger)
+	server := NewServer(WithLogger(serverLog), WithAccessLog(0.000001))
+	_ = server.Register(new(Foo))
+	_ = server.Register(new(Failing))
+	l, _ := net.Listen("tcp", ":0")
+	defer func() { _ = l.Close() }()
+	go server.Accept(l)
+	client, _ := Dial("tcp", l.Addr().String())
+	defer func() { _ = client.Close() }()
+	var reply int
+	for i := 0; i < 20; i++ {
+		_ = client.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	}
+	_ = client.Call(context.Background(), "Failing.Fail", int(NotFound), &reply)
+	waitFor(func() bool { return serverLog.find("Failing.Fail") != "" })
+	_assert(serverLog.find("rpc server: access", "Foo.Sum") == "", "successful calls should be sampled out")
+	_assert(serverLog.find("WARN rpc server: access", "Failing.Fail") != "", "failed calls are always logged")
+}
@@ -0,0 +1,38 @@
+// Code generated by geerpc-gen -type Foo; DO NOT EDIT.
+
+package main
+
+import (
+	"GeeRPC"
+	"context"
+)
+
+// FooClient Foo服务的类型化客户端, 方法名、参数和返回值在编译期检查
+type FooClient struct {
+	client *GeeRPC.Client
+}
+
+// NewFooClient 返回通过client调用Foo服务的客户端
+func NewFooClient(client *GeeRPC.Client) *FooClient {
+	return &FooClient{client: client}
+}
+
+// Sum 调用 Foo.Sum
+func (c *FooClient) Sum(ctx context.Context, args Args) (int, error) {
+	var reply int
+	err := c.client.Call(ctx, "Foo.Sum", args, &reply)
+	return reply, err
+}
+
+// FooServer Foo服务的方法集
+type FooServer interface {
+	Sum(Args, *int) error
+}
+
+// RegisterFooServer 以服务名Foo把impl注册到server, impl的方法集在编译期检查
+func RegisterFooServer(server *GeeRPC.Server, impl FooServer) error {
+	return server.RegisterName("Foo", impl)
+}
+
+// Foo的方法与生成的代码不一致时编译失败, 需要重新运行go generate
+var _ FooServer = (*Foo)(nil)
@@ -10,6 +10,8 @@ import (
 	"time"
 )
 
+//go:generate go run GeeRPC/cmd/geerpc-gen -type Foo
+
 type Foo int
 
 type Args struct{ Num1, Num2 int }
@@ -23,7 +25,7 @@ func (f Foo) Sum(args Args, reply *int) error {
 func startServer(addrCh chan string) {
 	var foo Foo
 	l, _ := net.Listen("tcp", ":9999")
-	_ = GeeRPC.Register(&foo)
+	_ = RegisterFooServer(GeeRPC.DefaultServer, &foo)
 	GeeRPC.HandleHTTP()
 	addrCh <- l.Addr().String()
 	_ = http.Serve(l, nil)
@@ -34,6 +36,7 @@ func call(addr chan string) {
 	log.Println("address:", address)
 	client, _ := GeeRPC.DialHTTP("tcp", address) // 连接服务端
 	defer func() { _ = client.Close() }()        // defer关闭连接
+	foo := NewFooClient(client)                  // 生成的类型化客户端, 见 foo_geerpc.go
 
 	time.Sleep(time.Second)
 	// send request & receive response
@@ -42,10 +45,10 @@ func call(addr chan string) {
 		wg.Add(1) // 计数器加1
 		go func(i int) {
 			defer wg.Done() // 计数器减1
-			args := &Args{Num1: i, Num2: i * i}
-			var reply int
+			args := Args{Num1: i, Num2: i * i}
 			//ctx, _ := context.WithTimeout(context.Background(), time.Second) // 设置超时时间
-			if err := client.Call(context.Background(), "Foo.Sum", args, &reply); err != nil {
+			reply, err := foo.Sum(context.Background(), args)
+			if err != nil {
 				log.Fatal("call Foo.Sum error:", err)
 			}
 			log.Printf("%d + %d = %d\n", args.Num1, args.Num2, reply)
@@ -0,0 +1,33 @@
+package GeeRPC
+
+import "context"
+
+// Metadata 请求元数据, 随请求头发送到服务端
+type Metadata map[string]string
+
+type metadataKey struct{}
+
+// WithMetadata 返回携带md的ctx, 与ctx中已有的元数据合并, 同名的键以md为准
+//
+// Client.Call 会将ctx中的元数据随请求发送到服务端。
+func WithMetadata(ctx context.Context, md Metadata) context.Context {
+	return context.WithValue(ctx, metadataKey{}, MetadataFromContext(ctx).merge(md))
+}
+
+// merge 返回md与other合并后的新Metadata, 同名的键以other为准
+func (md Metadata) merge(other Metadata) Metadata {
+	merged := make(Metadata, len(md)+len(other))
+	for k, v := range md {
+		merged[k] = v
+	}
+	for k, v := range other {
+		merged[k] = v
+	}
+	return merged
+}
+
+// MetadataFromContext 返回ctx中的元数据, 不存在时返回nil
+func MetadataFromContext(ctx context.Context) Metadata {
+	md, _ := ctx.Value(metadataKey{}).(Metadata)
+	return md
+}
@@ -0,0 +1,295 @@
+package GeeRPC
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultMetricsPath WithMetrics 未指定路径时 HandleHTTP 注册的路径
+const defaultMetricsPath = "/metrics"
+
+// 指标中side标签的取值
+const (
+	sideServer = "server"
+	sideClient = "client"
+)
+
+// latencyBuckets 调用耗时直方图的上界(秒)
+var latencyBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metrics 服务端和客户端的调用指标, 以Prometheus文本格式导出
+//
+// 同一个Metrics可以同时交给Server(WithMetrics)和Client(Option.Metrics), 以side标签区分。
+// 服务端只记录已注册的方法, 客户端记录调用的所有方法。
+type Metrics struct {
+	mu      sync.Mutex
+	methods map[methodKey]*methodMetrics
+	conns   map[string]*connMetrics // key为side
+}
+
+type methodKey struct {
+	side, method string
+}
+
+// methodMetrics 单个方法的指标
+type methodMetrics struct {
+	requests uint64
+	inFlight int64
+	mu       sync.Mutex
+	errors   map[Code]uint64
+	// buckets 落在各个上界内的调用数(不累计), 最后一项为+Inf
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+// connMetrics 连接数和收发字节数
+type connMetrics struct {
+	open, total       int64
+	bytesIn, bytesOut uint64
+}
+
+// NewMetrics 创建Metrics
+func NewMetrics() *Metrics {
+	return &Metrics{
+		methods: make(map[methodKey]*methodMetrics),
+		conns:   make(map[string]*connMetrics),
+	}
+}
+
+// WithMetrics 让Server把调用和连接记录到m, HandleHTTP 在path(为空时为"/metrics")上导出m
+func WithMetrics(m *Metrics, path string) ServerOption {
+	return func(server *Server) {
+		if path == "" {
+			path = defaultMetricsPath
+		}
+		server.metrics, server.metricsPath = m, path
+	}
+}
+
+func (m *Metrics) method(side, method string) *methodMetrics {
+	key := methodKey{side, method}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mm := m.methods[key]
+	if mm == nil {
+		mm = &methodMetrics{errors: make(map[Code]uint64), buckets: make([]uint64, len(latencyBuckets)+1)}
+		m.methods[key] = mm
+	}
+	return mm
+}
+
+func (m *Metrics) conn(side string) *connMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cm := m.conns[side]
+	if cm == nil {
+		cm = new(connMetrics)
+		m.conns[side] = cm
+	}
+	return cm
+}
+
+// begin 记录一次调用开始, 返回在调用结束时以其错误调用的函数; m为nil时返回nil
+func (m *Metrics) begin(side, method string) func(err error) {
+	if m == nil {
+		return nil
+	}
+	mm := m.method(side, method)
+	atomic.AddUint64(&mm.requests, 1)
+	atomic.AddInt64(&mm.inFlight, 1)
+	start := time.Now()
+	return func(err error) {
+		atomic.AddInt64(&mm.inFlight, -1)
+		mm.observe(time.Since(start), err)
+	}
+}
+
+func (mm *methodMetrics) observe(d time.Duration, err error) {
+	seconds := d.Seconds()
+	i := sort.SearchFloat64s(latencyBuckets, seconds) // 第一个不小于seconds的上界
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	mm.buckets[i]++
+	mm.sum += seconds
+	mm.count++
+	if err != nil {
+		mm.errors[CodeOf(err)]++
+	}
+}
+
+// meterConn 统计conn上收发的字节数, 关闭时减少打开的连接数; m为nil时返回conn
+func (m *Metrics) meterConn(side string, conn io.ReadWriteCloser) io.ReadWriteCloser {
+	if m == nil {
+		return conn
+	}
+	cm := m.conn(side)
+	atomic.AddInt64(&cm.open, 1)
+	atomic.AddInt64(&cm.total, 1)
+	return &meteredConn{ReadWriteCloser: conn, m: cm}
+}
+
+// meteredConn 统计收发字节数的连接
+type meteredConn struct {
+	io.ReadWriteCloser
+	m    *connMetrics
+	once sync.Once
+}
+
+func (c *meteredConn) Read(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(p)
+	atomic.AddUint64(&c.m.bytesIn, uint64(n))
+	return n, err
+}
+
+func (c *meteredConn) Write(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Write(p)
+	atomic.AddUint64(&c.m.bytesOut, uint64(n))
+	return n, err
+}
+
+func (c *meteredConn) Close() error {
+	c.once.Do(func() { atomic.AddInt64(&c.m.open, -1) })
+	return c.ReadWriteCloser.Close()
+}
+
+// ServeHTTP 以Prometheus文本格式输出所有指标
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = m.WriteTo(w)
+}
+
+// metricSample 一行指标
+type metricSample struct {
+	labels string
+	value  string
+}
+
+// WriteTo 以Prometheus文本格式把所有指标写入w
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	keys := make([]methodKey, 0, len(m.methods))
+	for k := range m.methods {
+		keys = append(keys, k)
+	}
+	sides := make([]string, 0, len(m.conns))
+	for side := range m.conns {
+		sides = append(sides, side)
+	}
+	m.mu.Unlock()
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].side != keys[j].side {
+			return keys[i].side < keys[j].side
+		}
+		return keys[i].method < keys[j].method
+	})
+	sort.Strings(sides)
+
+	var requests, inFlight, errs, hist []metricSample
+	for _, k := range keys {
+		mm := m.method(k.side, k.method)
+		l := labels("side", k.side, "method", k.method)
+		requests = append(requests, metricSample{l, strconv.FormatUint(atomic.LoadUint64(&mm.requests), 10)})
+		inFlight = append(inFlight, metricSample{l, strconv.FormatInt(atomic.LoadInt64(&mm.inFlight), 10)})
+		mm.mu.Lock()
+		codes := make([]Code, 0, len(mm.errors))
+		for c := range mm.errors {
+			codes = append(codes, c)
+		}
+		sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+		for _, c := range codes {
+			errs = append(errs, metricSample{labels("side", k.side, "method", k.method, "code", c.String()), strconv.FormatUint(mm.errors[c], 10)})
+		}
+		var cumulative uint64
+		for i, n := range mm.buckets {
+			cumulative += n
+			le := "+Inf"
+			if i < len(latencyBuckets) {
+				le = strconv.FormatFloat(latencyBuckets[i], 'g', -1, 64)
+			}
+			hist = append(hist, metricSample{"_bucket" + labels("side", k.side, "method", k.method, "le", le), strconv.FormatUint(cumulative, 10)})
+		}
+		hist = append(hist,
+			metricSample{"_sum" + l, strconv.FormatFloat(mm.sum, 'g', -1, 64)},
+			metricSample{"_count" + l, strconv.FormatUint(mm.count, 10)})
+		mm.mu.Unlock()
+	}
+	var open, total, in, out []metricSample
+	for _, side := range sides {
+		cm := m.conn(side)
+		l := labels("side", side)
+		open = append(open, metricSample{l, strconv.FormatInt(atomic.LoadInt64(&cm.open), 10)})
+		total = append(total, metricSample{l, strconv.FormatInt(atomic.LoadInt64(&cm.total), 10)})
+		in = append(in, metricSample{l, strconv.FormatUint(atomic.LoadUint64(&cm.bytesIn), 10)})
+		out = append(out, metricSample{l, strconv.FormatUint(atomic.LoadUint64(&cm.bytesOut), 10)})
+	}
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	writeMetric(cw, "geerpc_requests_total", "counter", "Total number of RPCs started.", requests)
+	writeMetric(cw, "geerpc_errors_total", "counter", "Total number of RPCs that failed, by status code.", errs)
+	writeMetric(cw, "geerpc_in_flight_requests", "gauge", "Number of RPCs currently in flight.", inFlight)
+	writeMetric(cw, "geerpc_request_duration_seconds", "histogram", "Latency of RPCs in seconds.", hist)
+	writeMetric(cw, "geerpc_connections", "gauge", "Number of open connections.", open)
+	writeMetric(cw, "geerpc_connections_total", "counter", "Total number of connections opened.", total)
+	writeMetric(cw, "geerpc_received_bytes_total", "counter", "Total bytes read from connections.", in)
+	writeMetric(cw, "geerpc_sent_bytes_total", "counter", "Total bytes written to connections.", out)
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+// writeMetric 写入一个指标的HELP、TYPE和所有样本, 没有样本时不写入
+func writeMetric(w *countingWriter, name, typ, help string, samples []metricSample) {
+	if len(samples) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	for _, s := range samples {
+		fmt.Fprintf(w, "%s%s %s\n", name, s.labels, s.value)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels 把成对的名称和值格式化为 {name="value",...}
+func labels(kv ...string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(kv); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(kv[i])
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(kv[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// countingWriter 记录写入的字节数和第一个错误
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
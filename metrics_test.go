@@ -0,0 +1,66 @@
+package GeeRPC
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Failing 以参数中的错误码失败
+type Failing int
+
+func (f Failing) Fail(code int, reply *int) error {
+	return Errorf(Code(code), "failing with %d", code)
+}
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+	m := NewMetrics()
+	server := NewServer(WithMetrics(m, ""))
+	_assert(server.metricsPath == defaultMetricsPath, "expect default metrics path, got %q", server.metricsPath)
+	_ = server.Register(new(Foo))
+	_ = server.Register(new(Failing))
+	l, _ := net.Listen("tcp", ":0")
+	defer func() { _ = l.Close() }()
+	go server.Accept(l)
+
+	client, err := Dial("tcp", l.Addr().String(), &Option{Metrics: m})
+	_assert(err == nil, "dial failed: %v", err)
+	ctx := context.Background()
+	var reply int
+	for i := 0; i < 3; i++ {
+		_assert(client.Call(ctx, "Foo.Sum", &Args{Num1: i, Num2: 1}, &reply) == nil, "Foo.Sum failed")
+	}
+	_ = client.Call(ctx, "Failing.Fail", int(NotFound), &reply)
+	_ = client.Call(ctx, "Foo.Missing", 1, &reply) // 服务端不记录未注册的方法
+	_ = client.Close()
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", defaultMetricsPath, nil))
+	body := w.Body.String()
+	_assert(strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4"), "unexpected content type")
+	for _, want := range []string{
+		"# TYPE geerpc_requests_total counter",
+		`geerpc_requests_total{side="server",method="Foo.Sum"} 3`,
+		`geerpc_requests_total{side="client",method="Foo.Sum"} 3`,
+		`geerpc_requests_total{side="client",method="Foo.Missing"} 1`,
+		`geerpc_errors_total{side="server",method="Failing.Fail",code="NotFound"} 1`,
+		`geerpc_errors_total{side="client",method="Failing.Fail",code="NotFound"} 1`,
+		`geerpc_in_flight_requests{side="client",method="Foo.Sum"} 0`,
+		`geerpc_request_duration_seconds_bucket{side="server",method="Foo.Sum",le="+Inf"} 3`,
+		`geerpc_request_duration_seconds_count{side="client",method="Foo.Sum"} 3`,
+		`geerpc_connections_total{side="client"} 1`,
+		`geerpc_connections{side="client"} 0`,
+	} {
+		_assert(strings.Contains(body, want), "expect %q in metrics:\n%s", want, body)
+	}
+	_assert(!strings.Contains(body, `side="server",method="Foo.Missing"`), "unregistered methods should not be recorded by the server")
+	_assert(strings.Contains(body, `geerpc_sent_bytes_total{side="client"}`) && !strings.Contains(body, `geerpc_sent_bytes_total{side="client"} 0`), "expect bytes sent by the client")
+}
+
+func TestLabels(t *testing.T) {
+	got := labels("method", "a\"b\\c\nd")
+	_assert(got == `{method="a\"b\\c\nd"}`, "unexpected escaping: %s", got)
+}
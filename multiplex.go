@@ -0,0 +1,135 @@
+package GeeRPC
+
+import (
+	"GeeRPC/codec"
+	"GeeRPC/mux"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// newMuxClient 创建多路复用的Client, conn上的Option握手已经完成
+func newMuxClient(conn io.ReadWriteCloser, f codec.NewCodecFunc, opt *Option) *Client {
+	client := &Client{
+		seq:      1,
+		opt:      opt,
+		pending:  make(map[uint64]*Call),
+		mux:      mux.Client(conn, nil),
+		newCodec: f,
+	}
+	go func() {
+		<-client.mux.Done() // 会话断开后结束所有未完成的调用
+		client.terminateCalls(ErrShutdown)
+	}()
+	return client
+}
+
+// sendStream 在独立的流上发送请求并接收响应
+//
+// 每个流有各自的编解码器, 大的请求体被切分后与其他流交替发送, 不会阻塞其他调用。
+func (client *Client) sendStream(call *Call) {
+	seq, err := client.registerCall(call)
+	if err != nil {
+		call.Error = err
+		call.done()
+		return
+	}
+	go func() {
+		err := client.roundTrip(seq, call)
+		if call := client.removeCall(seq); call != nil { // 可能已被取消或结束
+			call.Error = err
+			call.done()
+		}
+	}()
+}
+
+// roundTrip 打开一个流完成一次调用
+func (client *Client) roundTrip(seq uint64, call *Call) error {
+	stream, err := client.mux.Open()
+	if err != nil {
+		return err
+	}
+	cc := client.newCodec(stream)
+	defer func() { _ = cc.Close() }()
+	if err := client.opt.limitCodec(cc); err != nil {
+		return err
+	}
+	h := &codec.Header{ServiceMethod: call.ServiceMethod, Seq: seq, Metadata: call.Metadata}
+	if err := cc.Write(h, call.Args); err != nil {
+		return sizeError(err)
+	}
+	atomic.StoreInt64(&call.sent, writeSize(cc))
+	if cs := call.stream; cs != nil { // 流式调用被取消或出错时重置流, 服务端随之停止发送
+		var wmu sync.Mutex
+		cs.write = func(h *codec.Header, body interface{}) error {
+			wmu.Lock()
+			defer wmu.Unlock()
+			return cc.Write(h, body)
+		}
+		close(cs.ready)
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-cs.finished:
+				if cs.err != io.EOF {
+					stream.Reset()
+				}
+			case <-done:
+			}
+		}()
+	}
+	var rh codec.Header
+	for {
+		rh = codec.Header{} // gob不会清零消息中没有的字段
+		if err := cc.ReadHeader(&rh); err != nil {
+			return err
+		}
+		handled, err := client.receiveStreamFrame(&rh, cc.ReadBody)
+		if err != nil {
+			return err
+		}
+		if !handled {
+			break
+		}
+	}
+	if rh.Error != "" {
+		_ = cc.ReadBody(nil)
+		return headerError(&rh)
+	}
+	if err := cc.ReadBody(call.Reply); err != nil {
+		if errors.Is(err, codec.ErrMessageTooLarge) {
+			return sizeError(err)
+		}
+		return errors.New("reading body " + err.Error())
+	}
+	atomic.StoreInt64(&call.received, readSize(cc))
+	return nil
+}
+
+// serveMux 在多路复用的连接上, 为每个流启动一个ServerCodec
+func (server *Server) serveMux(ctx context.Context, conn io.ReadWriteCloser, f codec.NewCodecFunc, opt *Option) {
+	sess := mux.Server(conn, nil)
+	defer func() { _ = sess.Close() }()
+	var wg sync.WaitGroup
+	for {
+		stream, err := sess.Accept()
+		if err != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cc := f(stream)
+			if err := server.limitCodec(cc); err != nil {
+				server.log().Warn("rpc server: codec error", "error", err)
+				_ = cc.Close()
+				return
+			}
+			server.serveCodec(ctx, cc, opt)
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,57 @@
+package GeeRPC
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+)
+
+// Blob 接收大的请求体
+type Blob int
+
+func (b Blob) Len(data []byte, reply *int) error {
+	*reply = len(data)
+	return nil
+}
+
+func TestClient_multiplex(t *testing.T) {
+	t.Parallel()
+	server := NewServer()
+	var foo Foo
+	var blob Blob
+	_ = server.Register(&foo)
+	_ = server.Register(&blob)
+	l, _ := net.Listen("tcp", ":0")
+	defer func() { _ = l.Close() }()
+	go server.Accept(l)
+	client, err := Dial("tcp", l.Addr().String(), &Option{Multiplex: true})
+	_assert(err == nil, "dial failed: %v", err)
+	defer func() { _ = client.Close() }()
+
+	// 大的请求发送过程中, 小的调用不会被阻塞
+	var n int
+	big := client.Go("Blob.Len", make([]byte, 32<<20), &n, nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var sum int
+			err := client.Call(context.Background(), "Foo.Sum", Args{Num1: i, Num2: i}, &sum)
+			_assert(err == nil && sum == 2*i, "small call failed: %v", err)
+		}(i)
+	}
+	wg.Wait()
+	<-big.Done
+	_assert(big.Error == nil && n == 32<<20, "large call failed: %v", big.Error)
+
+	// 错误同样按流返回
+	err = client.Call(context.Background(), "Foo.Missing", Args{}, &n)
+	_assert(err != nil, "expect an error for an unknown method")
+
+	_ = client.Close()
+	_assert(!client.IsAvailable(), "expect a closed client to be unavailable")
+	err = client.Call(context.Background(), "Foo.Sum", Args{}, &n)
+	_assert(err == ErrShutdown, "expect ErrShutdown after Close, got %v", err)
+}
@@ -0,0 +1,290 @@
+// Package mux 在一个连接上复用多个双向字节流
+//
+// 帧格式参考yamux, 每一帧由12字节的帧头和负载组成:
+//
+//	| version(1) | type(1) | flags(2) | stream id(4) | length(4) | payload(length) |
+//
+// 大的写入被切分为不超过MaxFrameSize的数据帧, 与其他流的帧交替发送,
+// 每个流有各自的接收窗口, 接收方读取数据后通过窗口更新帧归还额度,
+// 因此一个大的消息不会阻塞同一连接上的其他流。
+package mux
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const (
+	protoVersion uint8 = 0
+	headerSize         = 12
+)
+
+// 帧类型
+const (
+	typeData uint8 = iota
+	typeWindowUpdate
+	typeGoAway
+)
+
+// 帧标志
+const (
+	flagSYN uint16 = 1 << iota // 打开流
+	flagFIN                    // 发送方不再写入
+	flagRST                    // 流被重置
+)
+
+var (
+	// ErrSessionClosed 会话已关闭
+	ErrSessionClosed = errors.New("mux: session closed")
+	// ErrStreamReset 流被对方重置
+	ErrStreamReset = errors.New("mux: stream reset")
+	// ErrStreamClosed 流已关闭写入
+	ErrStreamClosed = errors.New("mux: stream closed")
+)
+
+// Config 会话配置
+type Config struct {
+	// MaxFrameSize 数据帧负载的最大字节数, 默认16KB
+	MaxFrameSize int
+	// Window 每个流的接收窗口字节数, 默认256KB
+	Window uint32
+	// AcceptBacklog 等待Accept的流的数量, 默认256
+	AcceptBacklog int
+}
+
+func (c *Config) withDefaults() Config {
+	cfg := Config{}
+	if c != nil {
+		cfg = *c
+	}
+	if cfg.MaxFrameSize <= 0 {
+		cfg.MaxFrameSize = 16 << 10
+	}
+	if cfg.Window == 0 {
+		cfg.Window = 256 << 10
+	}
+	if cfg.AcceptBacklog <= 0 {
+		cfg.AcceptBacklog = 256
+	}
+	return cfg
+}
+
+// Session 一个连接上的多路复用会话
+type Session struct {
+	cfg  Config
+	conn io.ReadWriteCloser
+	// writeMu 保证帧的完整写入, 不同流的帧在此交替
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	streams map[uint32]*Stream
+	// nextID 下一个本端打开的流编号, 客户端为奇数, 服务端为偶数
+	nextID uint32
+
+	acceptCh  chan *Stream
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+// Client 创建客户端会话
+func Client(conn io.ReadWriteCloser, cfg *Config) *Session {
+	return newSession(conn, cfg, 1)
+}
+
+// Server 创建服务端会话
+func Server(conn io.ReadWriteCloser, cfg *Config) *Session {
+	return newSession(conn, cfg, 2)
+}
+
+func newSession(conn io.ReadWriteCloser, cfg *Config, firstID uint32) *Session {
+	c := cfg.withDefaults()
+	s := &Session{
+		cfg:      c,
+		conn:     conn,
+		streams:  make(map[uint32]*Stream),
+		nextID:   firstID,
+		acceptCh: make(chan *Stream, c.AcceptBacklog),
+		done:     make(chan struct{}),
+	}
+	go s.recvLoop()
+	return s
+}
+
+// Open 打开一个新的流
+func (s *Session) Open() (*Stream, error) {
+	s.mu.Lock()
+	if s.isClosed() {
+		s.mu.Unlock()
+		return nil, ErrSessionClosed
+	}
+	id := s.nextID
+	s.nextID += 2
+	st := newStream(s, id)
+	s.streams[id] = st
+	s.mu.Unlock()
+	// 通过窗口更新帧通知对方打开流
+	if err := s.writeFrame(typeWindowUpdate, flagSYN, id, nil, 0); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// Accept 等待对方打开的流
+func (s *Session) Accept() (*Stream, error) {
+	select {
+	case st := <-s.acceptCh:
+		return st, nil
+	case <-s.done:
+		return nil, s.closeErr()
+	}
+}
+
+// Close 关闭会话和底层连接, 所有的流随之关闭
+func (s *Session) Close() error {
+	_ = s.writeFrame(typeGoAway, 0, 0, nil, 0) // 通知对方, 失败也无妨
+	s.close(ErrSessionClosed)
+	return nil
+}
+
+// Done 会话关闭时被关闭
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// NumStreams 当前打开的流的数量
+func (s *Session) NumStreams() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.streams)
+}
+
+func (s *Session) isClosed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Session) closeErr() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *Session) close(err error) {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.err = err
+		streams := s.streams
+		s.streams = make(map[uint32]*Stream)
+		close(s.done)
+		s.mu.Unlock()
+		_ = s.conn.Close()
+		for _, st := range streams {
+			st.notify()
+		}
+	})
+}
+
+// writeFrame 写入一帧, length仅用于窗口更新帧的增量
+func (s *Session) writeFrame(typ uint8, flags uint16, id uint32, payload []byte, length uint32) error {
+	if typ == typeData {
+		length = uint32(len(payload))
+	}
+	buf := make([]byte, headerSize+len(payload))
+	buf[0] = protoVersion
+	buf[1] = typ
+	binary.BigEndian.PutUint16(buf[2:4], flags)
+	binary.BigEndian.PutUint32(buf[4:8], id)
+	binary.BigEndian.PutUint32(buf[8:12], length)
+	copy(buf[headerSize:], payload)
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if s.isClosed() {
+		return s.closeErr()
+	}
+	if _, err := s.conn.Write(buf); err != nil {
+		s.close(err)
+		return err
+	}
+	return nil
+}
+
+// recvLoop 读取帧并分发给各个流
+func (s *Session) recvLoop() {
+	hdr := make([]byte, headerSize)
+	for {
+		if _, err := io.ReadFull(s.conn, hdr); err != nil {
+			s.close(err)
+			return
+		}
+		if hdr[0] != protoVersion {
+			s.close(fmt.Errorf("mux: unsupported version %d", hdr[0]))
+			return
+		}
+		typ := hdr[1]
+		flags := binary.BigEndian.Uint16(hdr[2:4])
+		id := binary.BigEndian.Uint32(hdr[4:8])
+		length := binary.BigEndian.Uint32(hdr[8:12])
+
+		if typ == typeGoAway {
+			s.close(ErrSessionClosed)
+			return
+		}
+		var payload []byte
+		if typ == typeData && length > 0 {
+			if length > s.cfg.Window { // 数据帧不可能超过接收窗口
+				s.close(fmt.Errorf("mux: frame of %d bytes is too large", length))
+				return
+			}
+			payload = make([]byte, length)
+			if _, err := io.ReadFull(s.conn, payload); err != nil {
+				s.close(err)
+				return
+			}
+		}
+		st := s.stream(id, flags)
+		if st == nil { // 已经关闭或被拒绝的流, 丢弃
+			continue
+		}
+		if err := st.receive(typ, flags, payload, length); err != nil {
+			s.close(err)
+			return
+		}
+	}
+}
+
+// stream 返回id对应的流, 带SYN标志时创建对方打开的流
+func (s *Session) stream(id uint32, flags uint16) *Stream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st, ok := s.streams[id]; ok {
+		return st
+	}
+	if flags&flagSYN == 0 || s.isClosed() {
+		return nil
+	}
+	st := newStream(s, id)
+	select {
+	case s.acceptCh <- st:
+		s.streams[id] = st
+		return st
+	default: // 积压太多, 拒绝该流
+		go func() { _ = s.writeFrame(typeWindowUpdate, flagRST, id, nil, 0) }()
+		return nil
+	}
+}
+
+// remove 流的两个方向都已关闭时从会话中移除
+func (s *Session) remove(id uint32) {
+	s.mu.Lock()
+	delete(s.streams, id)
+	s.mu.Unlock()
+}
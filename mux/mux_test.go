@@ -0,0 +1,104 @@
+package mux
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// _assert 断言,如果cond为false，则panic
+func _assert(cond bool, msg string, v ...interface{}) {
+	if !cond {
+		panic(fmt.Sprintf("assert failed! "+msg, v...))
+	}
+}
+
+func newPair(cfg *Config) (*Session, *Session) {
+	a, b := net.Pipe()
+	return Client(a, cfg), Server(b, cfg)
+}
+
+// TestSession_echo 测试大数据被切分后完整送达, 多个流并发
+func TestSession_echo(t *testing.T) {
+	client, server := newPair(&Config{MaxFrameSize: 1024, Window: 4096})
+	defer client.Close()
+	go func() {
+		for {
+			st, err := server.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, _ = io.Copy(st, st)
+				_ = st.Close()
+			}()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			st, err := client.Open()
+			_assert(err == nil, "open failed: %v", err)
+			data := bytes.Repeat([]byte{byte(i)}, 64<<10+i)
+			go func() {
+				_, _ = st.Write(data)
+				_ = st.Close()
+			}()
+			got, err := io.ReadAll(st)
+			_assert(err == nil && bytes.Equal(got, data), "stream %d: echo mismatch (%d bytes, %v)", i, len(got), err)
+		}(i)
+	}
+	wg.Wait()
+	time.Sleep(10 * time.Millisecond)
+	_assert(client.NumStreams() == 0, "expect closed streams to be released, got %d", client.NumStreams())
+}
+
+// TestStream_flowControl 测试一个流写满接收窗口后阻塞, 但不影响其他流
+func TestStream_flowControl(t *testing.T) {
+	client, server := newPair(&Config{MaxFrameSize: 1024, Window: 4096})
+	defer client.Close()
+
+	big, _ := client.Open()
+	written := make(chan int, 1)
+	go func() {
+		n, _ := big.Write(make([]byte, 64<<10)) // 对方不读取, 写满窗口后阻塞
+		written <- n
+	}()
+	bigServer, _ := server.Accept()
+
+	small, _ := client.Open()
+	_, _ = small.Write([]byte("ping"))
+	smallServer, _ := server.Accept()
+	buf := make([]byte, 4)
+	_, err := io.ReadFull(smallServer, buf)
+	_assert(err == nil && string(buf) == "ping", "expect the small stream not to be blocked, got %q %v", buf, err)
+
+	select {
+	case <-written:
+		_assert(false, "expect the big write to block on the receive window")
+	case <-time.After(50 * time.Millisecond):
+	}
+	n, _ := io.CopyN(io.Discard, bigServer, 64<<10)
+	_assert(n == 64<<10, "expect all data after reading, got %d", n)
+	_assert(<-written == 64<<10, "expect the big write to finish")
+}
+
+// TestSession_close 测试会话关闭后流的读写返回错误
+func TestSession_close(t *testing.T) {
+	client, server := newPair(nil)
+	st, _ := client.Open()
+	_, _ = server.Accept()
+	_ = server.Close()
+	<-client.Done()
+	_, err := st.Read(make([]byte, 1))
+	_assert(err != nil, "expect read on a closed session to fail")
+	_, err = client.Open()
+	_assert(err == ErrSessionClosed, "expect open on a closed session to fail, got %v", err)
+}
@@ -0,0 +1,179 @@
+package mux
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Stream 会话中的一个双向字节流, 实现 io.ReadWriteCloser
+//
+// Close 只关闭写入方向(对方读到io.EOF), 两个方向都关闭后流被释放。
+type Stream struct {
+	id   uint32
+	sess *Session
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	// recvBuf 已接收未读取的数据
+	recvBuf bytes.Buffer
+	// consumed 已读取但还未通过窗口更新归还的字节数
+	consumed uint32
+	// sendWindow 对方还能接收的字节数
+	sendWindow uint32
+	// finRecv 对方已关闭写入
+	finRecv bool
+	// finSent 本端已关闭写入
+	finSent bool
+	// reset 流被重置
+	reset bool
+}
+
+var _ io.ReadWriteCloser = (*Stream)(nil)
+
+func newStream(sess *Session, id uint32) *Stream {
+	st := &Stream{id: id, sess: sess, sendWindow: sess.cfg.Window}
+	st.cond = sync.NewCond(&st.mu)
+	return st
+}
+
+// ID 流编号
+func (st *Stream) ID() uint32 {
+	return st.id
+}
+
+// notify 唤醒等待读写的goroutine
+func (st *Stream) notify() {
+	st.mu.Lock()
+	st.cond.Broadcast()
+	st.mu.Unlock()
+}
+
+// receive 处理发往该流的帧
+func (st *Stream) receive(typ uint8, flags uint16, payload []byte, length uint32) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	defer st.cond.Broadcast()
+	if flags&flagRST != 0 {
+		st.reset = true
+		st.sess.remove(st.id)
+		return nil
+	}
+	switch typ {
+	case typeWindowUpdate:
+		st.sendWindow += length
+	case typeData:
+		if uint32(st.recvBuf.Len())+uint32(len(payload)) > st.sess.cfg.Window {
+			return fmt.Errorf("mux: stream %d exceeded its receive window", st.id)
+		}
+		st.recvBuf.Write(payload)
+	}
+	if flags&flagFIN != 0 {
+		st.finRecv = true
+		if st.finSent {
+			st.sess.remove(st.id)
+		}
+	}
+	return nil
+}
+
+// Read 读取数据, 对方关闭写入且数据读完后返回io.EOF
+func (st *Stream) Read(p []byte) (int, error) {
+	st.mu.Lock()
+	for st.recvBuf.Len() == 0 {
+		switch {
+		case st.reset:
+			st.mu.Unlock()
+			return 0, ErrStreamReset
+		case st.finRecv:
+			st.mu.Unlock()
+			return 0, io.EOF
+		case st.sess.isClosed():
+			st.mu.Unlock()
+			return 0, st.sess.closeErr()
+		}
+		st.cond.Wait()
+	}
+	n, _ := st.recvBuf.Read(p)
+	st.consumed += uint32(n)
+	var delta uint32
+	if st.consumed >= st.sess.cfg.Window/2 && !st.finRecv { // 归还接收窗口
+		delta = st.consumed
+		st.consumed = 0
+	}
+	st.mu.Unlock()
+	if delta > 0 {
+		_ = st.sess.writeFrame(typeWindowUpdate, 0, st.id, nil, delta)
+	}
+	return n, nil
+}
+
+// Write 写入数据, 按MaxFrameSize和对方的接收窗口切分为多个数据帧
+func (st *Stream) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		st.mu.Lock()
+		for st.sendWindow == 0 && !st.reset && !st.finSent && !st.sess.isClosed() {
+			st.cond.Wait()
+		}
+		switch {
+		case st.reset:
+			st.mu.Unlock()
+			return written, ErrStreamReset
+		case st.finSent:
+			st.mu.Unlock()
+			return written, ErrStreamClosed
+		case st.sess.isClosed():
+			st.mu.Unlock()
+			return written, st.sess.closeErr()
+		}
+		n := len(p)
+		if n > st.sess.cfg.MaxFrameSize {
+			n = st.sess.cfg.MaxFrameSize
+		}
+		if uint32(n) > st.sendWindow {
+			n = int(st.sendWindow)
+		}
+		st.sendWindow -= uint32(n)
+		st.mu.Unlock()
+
+		if err := st.sess.writeFrame(typeData, 0, st.id, p[:n], 0); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Close 关闭写入方向
+func (st *Stream) Close() error {
+	st.mu.Lock()
+	if st.finSent || st.reset {
+		st.mu.Unlock()
+		return nil
+	}
+	st.finSent = true
+	finRecv := st.finRecv
+	st.cond.Broadcast()
+	st.mu.Unlock()
+	if finRecv {
+		st.sess.remove(st.id)
+	}
+	return st.sess.writeFrame(typeData, flagFIN, st.id, nil, 0)
+}
+
+// Reset 立即关闭两个方向, 对方的读写返回ErrStreamReset
+func (st *Stream) Reset() error {
+	st.mu.Lock()
+	if st.reset {
+		st.mu.Unlock()
+		return nil
+	}
+	st.reset = true
+	st.cond.Broadcast()
+	st.mu.Unlock()
+	st.sess.remove(st.id)
+	return st.sess.writeFrame(typeWindowUpdate, flagRST, st.id, nil, 0)
+}
@@ -0,0 +1,73 @@
+package GeeRPC
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+)
+
+// Peer 调用方的连接信息
+type Peer struct {
+	// Addr 调用方地址, 连接不是net.Conn时为nil
+	Addr net.Addr
+	// TLS 连接使用TLS时的连接状态, 否则为nil
+	TLS *tls.ConnectionState
+	// Identity 经过验证的客户端证书标识, 依次取CommonName、第一个DNS SAN、第一个URI SAN,
+	// 没有经过验证的客户端证书时为空
+	Identity string
+}
+
+// Certificate 经过验证的客户端证书, 没有时返回nil
+func (p *Peer) Certificate() *x509.Certificate {
+	if p.TLS == nil || len(p.TLS.VerifiedChains) == 0 {
+		return nil
+	}
+	return p.TLS.VerifiedChains[0][0]
+}
+
+type peerKey struct{}
+
+// PeerFromContext 返回服务方法和拦截器的ctx中调用方的连接信息
+func PeerFromContext(ctx context.Context) (*Peer, bool) {
+	p, ok := ctx.Value(peerKey{}).(*Peer)
+	return p, ok
+}
+
+// newPeer 从连接中获取调用方信息, TLS连接需要已完成握手
+func newPeer(conn io.ReadWriteCloser) *Peer {
+	p := &Peer{}
+	if c, ok := conn.(net.Conn); ok {
+		p.Addr = c.RemoteAddr()
+	}
+	if c, ok := conn.(*tls.Conn); ok {
+		state := c.ConnectionState()
+		p.TLS = &state
+		if cert := p.Certificate(); cert != nil {
+			p.Identity = certIdentity(cert)
+		}
+	}
+	return p
+}
+
+// certIdentity 证书标识
+func certIdentity(cert *x509.Certificate) string {
+	switch {
+	case cert.Subject.CommonName != "":
+		return cert.Subject.CommonName
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String()
+	}
+	return ""
+}
+
+type incomingMetadataKey struct{}
+
+// IncomingMetadata 返回服务方法和拦截器的ctx中调用方发送的元数据
+func IncomingMetadata(ctx context.Context) Metadata {
+	md, _ := ctx.Value(incomingMetadataKey{}).(Metadata)
+	return md
+}
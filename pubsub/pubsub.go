@@ -0,0 +1,328 @@
+// Package pubsub 基于GeeRPC的发布/订阅服务
+//
+// PubSub 注册到普通的 GeeRPC.Server 上, 复用服务端的注册和连接: 订阅是一个服务端流式调用,
+// 发布是一个普通调用。主题由'.'分隔, 订阅的模式中'*'匹配一段, '>'匹配末尾的一段或多段。
+package pubsub
+
+import (
+	"GeeRPC"
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Policy 订阅者的缓冲区满时的处理方式
+type Policy int
+
+const (
+	// Drop 丢弃新消息, 发布方不受影响
+	Drop Policy = iota + 1
+	// Disconnect 结束该订阅, 订阅方收到 ResourceExhausted
+	Disconnect
+	// Block 发布方等待订阅者腾出空间, 直到发布调用的ctx结束或超过 Config.BlockTimeout,
+	// 超时后按 Disconnect 处理。只能通过 Config 设置, 订阅方不能选择
+	Block
+)
+
+func (p Policy) String() string {
+	switch p {
+	case Drop:
+		return "drop"
+	case Disconnect:
+		return "disconnect"
+	case Block:
+		return "block"
+	}
+	return "default"
+}
+
+const (
+	defaultBuffer       = 64
+	defaultBlockTimeout = time.Second
+	// maxBuffer 单个订阅者最多缓存的消息数
+	maxBuffer = 4096
+)
+
+// Config PubSub的默认配置, 订阅时可以覆盖Buffer以及选择 Drop 或 Disconnect
+type Config struct {
+	// Buffer 每个订阅者缓存的消息数, 默认64
+	Buffer int
+	// Policy 缓冲区满时的处理方式, 默认 Drop
+	Policy Policy
+	// BlockTimeout Block 策略下发布方等待一个订阅者的最长时间, 默认1s
+	BlockTimeout time.Duration
+}
+
+// Message 订阅者收到的消息
+type Message struct {
+	Topic string
+	Data  []byte
+}
+
+// PublishArgs PubSub.Publish 的参数
+type PublishArgs struct {
+	Topic string
+	Data  []byte
+}
+
+// SubscribeArgs PubSub.Subscribe 的参数, Buffer和Policy为零值时使用 Config 中的值
+//
+// 停止读取的订阅者不能让所有发布方阻塞, 因此Policy为 Block 时被忽略, 同样使用 Config 中的值。
+type SubscribeArgs struct {
+	Pattern string
+	Buffer  int
+	Policy  Policy
+}
+
+// PubSub 发布/订阅服务, 通过 server.Register 注册后服务名为 "PubSub"
+type PubSub struct {
+	cfg  Config
+	mu   sync.RWMutex
+	subs map[*subscriber]struct{}
+	// dropped Drop策略下丢弃的消息数
+	dropped uint64
+}
+
+// subscriber 一个进行中的订阅
+type subscriber struct {
+	pattern string
+	policy  Policy
+	ch      chan Message
+	// done 订阅结束时被关闭, 阻塞的发布方随之返回
+	done chan struct{}
+	// kicked Disconnect策略下缓冲区满时被关闭
+	kicked chan struct{}
+	kick   sync.Once
+}
+
+// New 创建PubSub
+func New(cfg Config) *PubSub {
+	if cfg.Buffer <= 0 {
+		cfg.Buffer = defaultBuffer
+	}
+	if cfg.Policy == 0 {
+		cfg.Policy = Drop
+	}
+	if cfg.BlockTimeout <= 0 {
+		cfg.BlockTimeout = defaultBlockTimeout
+	}
+	return &PubSub{cfg: cfg, subs: make(map[*subscriber]struct{})}
+}
+
+// Register 创建PubSub并注册到server
+func Register(server *GeeRPC.Server, cfg Config) (*PubSub, error) {
+	ps := New(cfg)
+	if err := server.Register(ps); err != nil {
+		return nil, err
+	}
+	return ps, nil
+}
+
+// Publish 把消息发给所有匹配的订阅者, delivered为成功放入缓冲区的订阅者数
+func (ps *PubSub) Publish(ctx context.Context, args PublishArgs, delivered *int) error {
+	n, err := ps.Deliver(ctx, args.Topic, args.Data)
+	*delivered = n
+	return err
+}
+
+// Subscribe 订阅匹配pattern的主题, 直到调用方取消或因 Disconnect 策略被断开
+func (ps *PubSub) Subscribe(args SubscribeArgs, stream GeeRPC.ServerStream[Message]) error {
+	if !validPattern(args.Pattern) {
+		return GeeRPC.Errorf(GeeRPC.InvalidArgument, "pubsub: invalid pattern %q", args.Pattern)
+	}
+	sub := ps.add(args)
+	defer ps.remove(sub)
+	ctx := stream.Context()
+	for {
+		select {
+		case m := <-sub.ch:
+			if err := stream.Send(m); err != nil {
+				return err
+			}
+		case <-sub.kicked:
+			return GeeRPC.Errorf(GeeRPC.ResourceExhausted, "pubsub: slow consumer on %q, buffer of %d is full", sub.pattern, cap(sub.ch))
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Deliver 在进程内发布消息, 与 PubSub.Publish 相同
+func (ps *PubSub) Deliver(ctx context.Context, topic string, data []byte) (int, error) {
+	if !validTopic(topic) {
+		return 0, GeeRPC.Errorf(GeeRPC.InvalidArgument, "pubsub: invalid topic %q", topic)
+	}
+	m := Message{Topic: topic, Data: data}
+	n := 0
+	for _, sub := range ps.match(topic) {
+		switch sub.policy {
+		case Block:
+			select {
+			case sub.ch <- m:
+				n++
+				continue
+			case <-sub.kicked: // 已被断开, 不再等待
+				continue
+			default:
+			}
+			timer := time.NewTimer(ps.cfg.BlockTimeout)
+			select {
+			case sub.ch <- m:
+				n++
+			case <-sub.done:
+			case <-timer.C: // 订阅者停止读取, 断开它而不是让发布方一直等待
+				sub.kick.Do(func() { close(sub.kicked) })
+			case <-ctx.Done():
+				timer.Stop()
+				return n, ctx.Err()
+			}
+			timer.Stop()
+		case Disconnect:
+			select {
+			case sub.ch <- m:
+				n++
+			default:
+				sub.kick.Do(func() { close(sub.kicked) })
+			}
+		default:
+			select {
+			case sub.ch <- m:
+				n++
+			default:
+				atomic.AddUint64(&ps.dropped, 1)
+			}
+		}
+	}
+	return n, nil
+}
+
+// Dropped 返回因订阅者的缓冲区已满而丢弃的消息数
+func (ps *PubSub) Dropped() uint64 {
+	return atomic.LoadUint64(&ps.dropped)
+}
+
+// Subscribers 返回匹配topic的订阅者数
+func (ps *PubSub) Subscribers(topic string) int {
+	return len(ps.match(topic))
+}
+
+func (ps *PubSub) add(args SubscribeArgs) *subscriber {
+	buffer, policy := args.Buffer, args.Policy
+	if buffer <= 0 {
+		buffer = ps.cfg.Buffer
+	}
+	if buffer > maxBuffer {
+		buffer = maxBuffer
+	}
+	if policy == 0 || policy == Block {
+		policy = ps.cfg.Policy
+	}
+	sub := &subscriber{
+		pattern: args.Pattern,
+		policy:  policy,
+		ch:      make(chan Message, buffer),
+		done:    make(chan struct{}),
+		kicked:  make(chan struct{}),
+	}
+	ps.mu.Lock()
+	ps.subs[sub] = struct{}{}
+	ps.mu.Unlock()
+	return sub
+}
+
+func (ps *PubSub) remove(sub *subscriber) {
+	ps.mu.Lock()
+	delete(ps.subs, sub)
+	ps.mu.Unlock()
+	close(sub.done)
+}
+
+// match 返回模式匹配topic的订阅者
+func (ps *PubSub) match(topic string) []*subscriber {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	var subs []*subscriber
+	for sub := range ps.subs {
+		if Match(sub.pattern, topic) {
+			subs = append(subs, sub)
+		}
+	}
+	return subs
+}
+
+// Match 判断主题topic是否匹配订阅模式pattern
+//
+// 两者都由'.'分隔成段, 模式中的'*'匹配任意一段, 位于末尾的'>'匹配剩余的一段或多段。
+func Match(pattern, topic string) bool {
+	ps, ts := strings.Split(pattern, "."), strings.Split(topic, ".")
+	for i, p := range ps {
+		if p == ">" {
+			return i < len(ts)
+		}
+		if i >= len(ts) || (p != "*" && p != ts[i]) {
+			return false
+		}
+	}
+	return len(ps) == len(ts)
+}
+
+// validTopic 主题由非空的段组成, 不能包含通配符
+func validTopic(topic string) bool {
+	for _, t := range strings.Split(topic, ".") {
+		if t == "" || strings.ContainsAny(t, "*>") {
+			return false
+		}
+	}
+	return true
+}
+
+// validPattern 通配符必须占据整段, '>'只能出现在末尾
+func validPattern(pattern string) bool {
+	tokens := strings.Split(pattern, ".")
+	for i, t := range tokens {
+		switch {
+		case t == "":
+			return false
+		case t == ">":
+			if i != len(tokens)-1 {
+				return false
+			}
+		case t != "*" && strings.ContainsAny(t, "*>"):
+			return false
+		}
+	}
+	return true
+}
+
+// Subscription 客户端的一个订阅
+type Subscription struct {
+	r *GeeRPC.StreamReader[Message]
+}
+
+// Subscribe 通过client订阅匹配pattern的主题, 服务名为 "PubSub"
+func Subscribe(ctx context.Context, client *GeeRPC.Client, args SubscribeArgs) (*Subscription, error) {
+	r, err := GeeRPC.NewStreamReader[Message](ctx, client, "PubSub.Subscribe", args)
+	if err != nil {
+		return nil, err
+	}
+	return &Subscription{r: r}, nil
+}
+
+// Next 等待下一条消息, 订阅结束后返回其原因
+func (s *Subscription) Next() (Message, error) {
+	return s.r.Recv()
+}
+
+// Close 取消订阅
+func (s *Subscription) Close() {
+	s.r.Close()
+}
+
+// Publish 通过client发布消息, 返回收到消息的订阅者数
+func Publish(ctx context.Context, client *GeeRPC.Client, topic string, data []byte) (int, error) {
+	var n int
+	err := client.Call(ctx, "PubSub.Publish", PublishArgs{Topic: topic, Data: data}, &n)
+	return n, err
+}
@@ -0,0 +1,170 @@
+package pubsub
+
+import (
+	"GeeRPC"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// _assert 断言,如果cond为false，则panic
+func _assert(cond bool, msg string, v ...interface{}) {
+	if !cond {
+		panic(fmt.Sprintf("assert failed! "+msg, v...))
+	}
+}
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		pattern, topic string
+		want           bool
+	}{
+		{"orders.eu", "orders.eu", true},
+		{"orders.eu", "orders.us", false},
+		{"orders.*", "orders.eu", true},
+		{"orders.*", "orders.eu.paris", false},
+		{"orders.>", "orders.eu.paris", true},
+		{"orders.>", "orders", false},
+		{"*.eu", "orders.eu", true},
+		{">", "orders", true},
+	}
+	for _, c := range cases {
+		_assert(Match(c.pattern, c.topic) == c.want, "Match(%q, %q) should be %v", c.pattern, c.topic, c.want)
+	}
+	_assert(!validPattern("orders.>.eu") && !validPattern("orders.e*") && !validPattern("orders..eu"), "expect invalid patterns")
+	_assert(!validTopic("orders.*") && validTopic("orders.eu"), "expect wildcards to be rejected in topics")
+}
+
+// startTestServer 以opts启动注册了PubSub的服务端并返回连接到它的客户端
+func startTestServer(t *testing.T, cfg Config, opts ...GeeRPC.ServerOption) (*PubSub, *GeeRPC.Client) {
+	server := GeeRPC.NewServer(opts...)
+	ps, err := Register(server, cfg)
+	_assert(err == nil, "register failed: %v", err)
+	l, _ := net.Listen("tcp", ":0")
+	t.Cleanup(func() { _ = l.Close() })
+	go server.Accept(l)
+	client, err := GeeRPC.Dial("tcp", l.Addr().String())
+	_assert(err == nil, "dial failed: %v", err)
+	t.Cleanup(func() { _ = client.Close() })
+	return ps, client
+}
+
+// waitSubscribers 订阅在服务端处理后才生效, 等待订阅者数达到n
+func waitSubscribers(ps *PubSub, topic string, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for ps.Subscribers(topic) != n && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	_assert(ps.Subscribers(topic) == n, "expect %d subscribers on %s, got %d", n, topic, ps.Subscribers(topic))
+}
+
+func TestPubSub(t *testing.T) {
+	t.Parallel()
+	ps, client := startTestServer(t, Config{})
+	ctx := context.Background()
+
+	one, err := Subscribe(ctx, client, SubscribeArgs{Pattern: "orders.*"})
+	_assert(err == nil, "subscribe failed: %v", err)
+	all, err := Subscribe(ctx, client, SubscribeArgs{Pattern: "orders.>"})
+	_assert(err == nil, "subscribe failed: %v", err)
+	waitSubscribers(ps, "orders.eu", 2)
+
+	n, err := Publish(ctx, client, "orders.eu", []byte("a"))
+	_assert(err == nil && n == 2, "expect 2 subscribers, got %d, %v", n, err)
+	n, err = Publish(ctx, client, "orders.eu.paris", []byte("b"))
+	_assert(err == nil && n == 1, "expect 1 subscriber, got %d, %v", n, err)
+	_, err = Publish(ctx, client, "orders.*", nil)
+	_assert(GeeRPC.CodeOf(err) == GeeRPC.InvalidArgument, "expect InvalidArgument for a wildcard topic, got %v", err)
+
+	m, err := one.Next()
+	_assert(err == nil && m.Topic == "orders.eu" && string(m.Data) == "a", "unexpected message %+v, %v", m, err)
+	for _, want := range []string{"a", "b"} {
+		m, err = all.Next()
+		_assert(err == nil && string(m.Data) == want, "expect %s, got %+v, %v", want, m, err)
+	}
+
+	// 取消订阅后不再投递
+	one.Close()
+	waitSubscribers(ps, "orders.eu", 1)
+	all.Close()
+	waitSubscribers(ps, "orders.eu", 0)
+
+	bad, err := Subscribe(ctx, client, SubscribeArgs{Pattern: "orders.>.eu"})
+	_assert(err == nil, "subscribe failed: %v", err)
+	_, err = bad.Next()
+	_assert(GeeRPC.CodeOf(err) == GeeRPC.InvalidArgument, "expect InvalidArgument for a bad pattern, got %v", err)
+}
+
+func TestPubSub_slowConsumer(t *testing.T) {
+	t.Parallel()
+	ps, client := startTestServer(t, Config{Buffer: 1})
+	ctx := context.Background()
+
+	// 不读取的订阅者会占满流控窗口和缓冲区
+	drop, err := Subscribe(ctx, client, SubscribeArgs{Pattern: "drop"})
+	_assert(err == nil, "subscribe failed: %v", err)
+	defer drop.Close()
+	kick, err := Subscribe(ctx, client, SubscribeArgs{Pattern: "kick", Policy: Disconnect})
+	_assert(err == nil, "subscribe failed: %v", err)
+	// 订阅方不能选择Block, 按Config中的Drop处理
+	block, err := Subscribe(ctx, client, SubscribeArgs{Pattern: "block", Policy: Block})
+	_assert(err == nil, "subscribe failed: %v", err)
+	defer block.Close()
+	for _, topic := range []string{"drop", "kick", "block"} {
+		waitSubscribers(ps, topic, 1)
+	}
+
+	for i := 0; i < 100; i++ {
+		_, _ = ps.Deliver(ctx, "drop", nil)
+		_, _ = ps.Deliver(ctx, "kick", nil)
+	}
+	_assert(ps.Dropped() > 0, "expect messages to be dropped")
+	for err == nil {
+		_, err = kick.Next()
+	}
+	_assert(GeeRPC.CodeOf(err) == GeeRPC.ResourceExhausted, "expect ResourceExhausted for a slow consumer, got %v", err)
+
+	dropped := ps.Dropped()
+	timeout, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	for i := 0; i < 100; i++ {
+		_, err = ps.Deliver(timeout, "block", nil)
+		_assert(err == nil, "expect a subscriber asking for Block not to block the publisher, got %v", err)
+	}
+	_assert(ps.Dropped() > dropped, "expect messages to the subscriber asking for Block to be dropped")
+}
+
+// TestPubSub_block 测试服务端配置的Block策略: 发布方等待, 超过BlockTimeout后断开订阅者
+func TestPubSub_block(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ps, client := startTestServer(t, Config{Buffer: 1, Policy: Block, BlockTimeout: time.Hour})
+	sub, err := Subscribe(ctx, client, SubscribeArgs{Pattern: "block"})
+	_assert(err == nil, "subscribe failed: %v", err)
+	defer sub.Close()
+	waitSubscribers(ps, "block", 1)
+	timeout, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	for err = nil; err == nil; {
+		_, err = ps.Deliver(timeout, "block", nil)
+	}
+	_assert(errors.Is(err, context.DeadlineExceeded), "expect the publisher to block, got %v", err)
+
+	ps, client = startTestServer(t, Config{Buffer: 1, Policy: Block, BlockTimeout: 20 * time.Millisecond})
+	sub, err = Subscribe(ctx, client, SubscribeArgs{Pattern: "block"})
+	_assert(err == nil, "subscribe failed: %v", err)
+	waitSubscribers(ps, "block", 1)
+	start := time.Now()
+	for i := 0; i < 100; i++ { // 超过流控窗口和缓冲区
+		_, err = ps.Deliver(ctx, "block", nil)
+		_assert(err == nil, "deliver failed: %v", err)
+	}
+	_assert(time.Since(start) < time.Second, "expect publishers to stop waiting once the subscriber is disconnected, took %s", time.Since(start))
+	for err == nil {
+		_, err = sub.Next()
+	}
+	_assert(GeeRPC.CodeOf(err) == GeeRPC.ResourceExhausted, "expect a stalled subscriber to be disconnected after BlockTimeout, got %v", err)
+}
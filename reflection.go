@@ -0,0 +1,221 @@
+package GeeRPC
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ReflectionService 每个Server都注册的反射服务的名称, 方法见 Reflection
+const ReflectionService = "GeeRPC.Reflection"
+
+// Reflection 内置的反射服务, 返回Server上注册的服务、方法以及参数和返回值的结构,
+// 使通用的工具(如命令行客户端)不需要编译进服务的类型就能发现和调用方法
+//
+//	var names []string
+//	client.Call(ctx, "GeeRPC.Reflection.List", "", &names)
+type Reflection struct {
+	server *Server
+}
+
+// ServiceSchema 一个服务的描述
+type ServiceSchema struct {
+	Name    string
+	Methods []MethodSchema
+}
+
+// MethodSchema 一个方法的描述, 只有与方法种类有关的类型不为nil
+type MethodSchema struct {
+	Name string
+	// Stream 流式方法的种类: "server"、"client"、"bidi", 普通方法为空
+	Stream string
+	// Arg 参数类型, 客户端流和双向流为nil
+	Arg *TypeSchema
+	// Reply 返回值类型(含指针), 服务端流和双向流为nil
+	Reply *TypeSchema
+	// Send 服务端流和双向流中服务端发送的消息类型
+	Send *TypeSchema
+	// Recv 客户端流和双向流中客户端发送的消息类型
+	Recv *TypeSchema
+}
+
+// TypeSchema 一个Go类型的描述
+type TypeSchema struct {
+	// Name 类型的Go写法, 如 "main.Args"、"*int"、"[]string"
+	Name string
+	// Kind reflect.Kind 的名称, 如 "struct"、"int"、"slice"、"map"、"ptr"
+	Kind string
+	// Elem 指针、切片、数组的元素类型和map的值类型
+	Elem *TypeSchema
+	// Key map的键类型
+	Key *TypeSchema
+	// Len 数组的长度
+	Len int
+	// Fields 结构体的导出字段; 递归引用自身的结构体只在最外层展开字段
+	Fields []FieldSchema
+}
+
+// FieldSchema 结构体的一个导出字段
+type FieldSchema struct {
+	Name string
+	// Tag 字段的完整tag, 如 `json:"num1"`
+	Tag  string
+	Type *TypeSchema
+}
+
+// List 返回名称以prefix开头的服务名, prefix为空时返回所有服务, 按名称排序
+func (r *Reflection) List(prefix string, reply *[]string) error {
+	names := []string{}
+	r.server.serviceMap.Range(func(namei, _ interface{}) bool {
+		if name := namei.(string); strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+		return true
+	})
+	sort.Strings(names)
+	*reply = names
+	return nil
+}
+
+// Describe 返回服务的所有方法, 按方法名排序
+func (r *Reflection) Describe(serviceName string, reply *ServiceSchema) error {
+	svci, ok := r.server.serviceMap.Load(serviceName)
+	if !ok {
+		return Errorf(NotFound, "rpc reflection: can't find service %s", serviceName)
+	}
+	svc := svci.(*service)
+	reply.Name = svc.name
+	reply.Methods = make([]MethodSchema, 0, len(svc.method))
+	for _, name := range svc.methodNames() {
+		reply.Methods = append(reply.Methods, methodSchema(name, svc.method[name]))
+	}
+	return nil
+}
+
+// DescribeMethod 返回 "Service.Method" 的描述
+func (r *Reflection) DescribeMethod(serviceMethod string, reply *MethodSchema) error {
+	_, mtype, err := r.server.findService(serviceMethod)
+	if err != nil {
+		return Errorf(NotFound, "%v", err)
+	}
+	*reply = methodSchema(serviceMethod[strings.LastIndex(serviceMethod, ".")+1:], mtype)
+	return nil
+}
+
+// methodSchema 按方法的种类描述参数、返回值和流消息的类型
+func methodSchema(name string, m *methodType) MethodSchema {
+	ms := MethodSchema{Name: name, Stream: streamKindNames[m.stream]}
+	switch m.stream {
+	case streamNone:
+		ms.Arg, ms.Reply = typeSchema(m.ArgType), typeSchema(m.ReplyType)
+	case streamServer:
+		ms.Arg, ms.Send = typeSchema(m.ArgType), typeSchema(m.SendType)
+	case streamClient:
+		ms.Recv, ms.Reply = typeSchema(m.RecvType), typeSchema(m.ReplyType)
+	case streamBidi:
+		ms.Send, ms.Recv = typeSchema(m.SendType), typeSchema(m.RecvType)
+	}
+	return ms
+}
+
+// typeSchema 递归描述t
+func typeSchema(t reflect.Type) *TypeSchema {
+	return describeType(t, make(map[reflect.Type]bool))
+}
+
+// describeType expanding记录正在展开字段的结构体, 用于截断递归类型
+func describeType(t reflect.Type, expanding map[reflect.Type]bool) *TypeSchema {
+	ts := &TypeSchema{Name: t.String(), Kind: t.Kind().String()}
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice:
+		ts.Elem = describeType(t.Elem(), expanding)
+	case reflect.Array:
+		ts.Elem, ts.Len = describeType(t.Elem(), expanding), t.Len()
+	case reflect.Map:
+		ts.Key, ts.Elem = describeType(t.Key(), expanding), describeType(t.Elem(), expanding)
+	case reflect.Struct:
+		if expanding[t] {
+			return ts
+		}
+		expanding[t] = true
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" { // 未导出的字段不会被编码
+				continue
+			}
+			ts.Fields = append(ts.Fields, FieldSchema{Name: f.Name, Tag: string(f.Tag), Type: describeType(f.Type, expanding)})
+		}
+		delete(expanding, t)
+	}
+	return ts
+}
+
+// basicTypes 按 TypeSchema.Kind 对应的基本类型
+var basicTypes = map[string]reflect.Type{}
+
+func init() {
+	for _, v := range []interface{}{
+		false, int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0), uintptr(0),
+		float32(0), float64(0), complex64(0), complex128(0), "",
+	} {
+		t := reflect.TypeOf(v)
+		basicTypes[t.Kind().String()] = t
+	}
+}
+
+// Build 构造一个与ts结构相同的类型, 结构体的字段名和tag与原类型一致
+//
+// gob按字段名匹配结构体, JSON按tag匹配, 因此构造的类型可以在没有原类型时收发消息。
+// 递归类型、接口和chan、func等不能编码的类型返回错误。
+func (ts *TypeSchema) Build() (reflect.Type, error) {
+	return ts.build(make(map[string]bool))
+}
+
+// build building记录正在构造的结构体, 递归类型无法用 reflect.StructOf 构造
+func (ts *TypeSchema) build(building map[string]bool) (reflect.Type, error) {
+	if t, ok := basicTypes[ts.Kind]; ok {
+		return t, nil
+	}
+	switch ts.Kind {
+	case "ptr", "slice", "array":
+		elem, err := ts.Elem.build(building)
+		if err != nil {
+			return nil, err
+		}
+		switch ts.Kind {
+		case "ptr":
+			return reflect.PointerTo(elem), nil
+		case "slice":
+			return reflect.SliceOf(elem), nil
+		}
+		return reflect.ArrayOf(ts.Len, elem), nil
+	case "map":
+		key, err := ts.Key.build(building)
+		if err != nil {
+			return nil, err
+		}
+		elem, err := ts.Elem.build(building)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.MapOf(key, elem), nil
+	case "struct":
+		if building[ts.Name] {
+			return nil, fmt.Errorf("rpc reflection: recursive type %s is not supported", ts.Name)
+		}
+		building[ts.Name] = true
+		defer delete(building, ts.Name)
+		fields := make([]reflect.StructField, 0, len(ts.Fields))
+		for _, f := range ts.Fields {
+			ft, err := f.Type.build(building)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, reflect.StructField{Name: f.Name, Type: ft, Tag: reflect.StructTag(f.Tag)})
+		}
+		return reflect.StructOf(fields), nil
+	}
+	return nil, fmt.Errorf("rpc reflection: type %s of kind %s is not supported", ts.Name, ts.Kind)
+}
@@ -0,0 +1,82 @@
+package GeeRPC
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Tagged 用于测试字段tag和递归类型的描述
+type Tagged struct {
+	Name     string `json:"name"`
+	Children []*Tagged
+	Labels   map[string]int
+	hidden   int
+}
+
+func TestTypeSchema(t *testing.T) {
+	ts := typeSchema(reflect.TypeOf(Tagged{}))
+	_assert(ts.Name == "GeeRPC.Tagged" && ts.Kind == "struct" && len(ts.Fields) == 3, "unexpected schema %+v", ts)
+	name := ts.Fields[0]
+	_assert(name.Name == "Name" && name.Tag == `json:"name"` && name.Type.Kind == "string", "unexpected field %+v", name)
+	children := ts.Fields[1].Type
+	_assert(children.Kind == "slice" && children.Elem.Kind == "ptr" && children.Elem.Elem.Name == "GeeRPC.Tagged", "unexpected field %+v", children)
+	_assert(children.Elem.Elem.Fields == nil, "recursive type should not be expanded again")
+	labels := ts.Fields[2].Type
+	_assert(labels.Kind == "map" && labels.Key.Kind == "string" && labels.Elem.Kind == "int", "unexpected field %+v", labels)
+	arr := typeSchema(reflect.TypeOf([2]bool{}))
+	_assert(arr.Kind == "array" && arr.Len == 2 && arr.Elem.Kind == "bool", "unexpected schema %+v", arr)
+}
+
+func TestTypeSchema_Build(t *testing.T) {
+	typ, err := typeSchema(reflect.TypeOf(map[string][]*Args{})).Build()
+	_assert(err == nil && typ.Kind() == reflect.Map && typ.Elem().Elem().Elem().Kind() == reflect.Struct, "unexpected type %v, %v", typ, err)
+	args := typ.Elem().Elem().Elem()
+	_assert(args.NumField() == 2 && args.Field(1).Name == "Num2" && args.Field(1).Type.Kind() == reflect.Int, "unexpected struct %v", args)
+	typ, err = typeSchema(reflect.TypeOf([2]bool{})).Build()
+	_assert(err == nil && typ == reflect.TypeOf([2]bool{}), "unexpected type %v, %v", typ, err)
+	_, err = typeSchema(reflect.TypeOf(Tagged{})).Build()
+	_assert(err != nil && strings.Contains(err.Error(), "recursive type"), "expect a recursive type to be refused, got %v", err)
+	_, err = typeSchema(reflect.TypeOf(func() {})).Build()
+	_assert(err != nil, "expect a func type to be refused")
+}
+
+// TestReflection 通过RPC列出服务并描述方法
+func TestReflection(t *testing.T) {
+	t.Parallel()
+	server := NewServer()
+	_ = server.Register(new(Foo))
+	_ = server.Register(new(Counter))
+	l, _ := net.Listen("tcp", ":0")
+	defer func() { _ = l.Close() }()
+	go server.Accept(l)
+	client, err := Dial("tcp", l.Addr().String())
+	_assert(err == nil, "dial failed: %v", err)
+	defer func() { _ = client.Close() }()
+	ctx := context.Background()
+
+	var names []string
+	err = client.Call(ctx, ReflectionService+".List", "", &names)
+	_assert(err == nil && reflect.DeepEqual(names, []string{"Counter", "Foo", ReflectionService}), "unexpected services %v, %v", names, err)
+	err = client.Call(ctx, ReflectionService+".List", "F", &names)
+	_assert(err == nil && reflect.DeepEqual(names, []string{"Foo"}), "unexpected services %v, %v", names, err)
+
+	var foo ServiceSchema
+	err = client.Call(ctx, ReflectionService+".Describe", "Foo", &foo)
+	_assert(err == nil && foo.Name == "Foo" && len(foo.Methods) == 1, "unexpected schema %+v, %v", foo, err)
+	sum := foo.Methods[0]
+	_assert(sum.Name == "Sum" && sum.Stream == "" && sum.Arg.Name == "GeeRPC.Args" && len(sum.Arg.Fields) == 2 &&
+		sum.Reply.Kind == "ptr" && sum.Reply.Elem.Kind == "int" && sum.Send == nil && sum.Recv == nil, "unexpected method %+v", sum)
+
+	var count MethodSchema
+	err = client.Call(ctx, ReflectionService+".DescribeMethod", "Counter.Count", &count)
+	_assert(err == nil && count.Stream == "server" && count.Arg.Kind == "int" && count.Send.Kind == "int" && count.Reply == nil,
+		"unexpected method %+v, %v", count, err)
+
+	err = client.Call(ctx, ReflectionService+".Describe", "Missing", &foo)
+	_assert(CodeOf(err) == NotFound, "expect NotFound, got %v", err)
+	err = client.Call(ctx, ReflectionService+".DescribeMethod", "Foo.Missing", &count)
+	_assert(CodeOf(err) == NotFound, "expect NotFound, got %v", err)
+}
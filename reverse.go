@@ -0,0 +1,100 @@
+package GeeRPC
+
+import (
+	"GeeRPC/codec"
+	"context"
+	"errors"
+	"sync"
+)
+
+// reverseKey ctx中可以调用客户端的Client
+type reverseKey struct{}
+
+// ReverseClientFromContext 返回调用方所在连接上的反向Client, 用它可以调用客户端通过 Client.ServeCallback 注册的方法
+//
+// 反向调用复用客户端已经建立的连接, 因此服务端不需要能连到客户端(如客户端在NAT之后)。
+// 返回的Client可以在服务方法返回后保存下来用于推送, 连接断开后调用返回 ErrShutdown。
+// 多路复用的连接不支持反向调用, 此时返回nil。
+func ReverseClientFromContext(ctx context.Context) *Client {
+	client, _ := ctx.Value(reverseKey{}).(*Client)
+	return client
+}
+
+// ServeCallback 由server处理服务端在该连接上发起的调用
+//
+// server不需要监听端口, 只需注册供服务端调用的方法。反向调用只支持普通方法, 不支持流式方法。
+func (client *Client) ServeCallback(server *Server) {
+	client.mu.Lock()
+	client.callback = server
+	client.mu.Unlock()
+}
+
+// serveCallback 读取服务端发起的一个调用并在新的goroutine中处理, 响应同样带 FlagReverse
+func (client *Client) serveCallback(h *codec.Header) error {
+	client.mu.Lock()
+	server := client.callback
+	client.mu.Unlock()
+	if server == nil {
+		if err := client.cc.ReadBody(nil); err != nil {
+			return err
+		}
+		setHeaderError(h, Errorf(Unimplemented, "rpc client: no callback server for %s", h.ServiceMethod))
+		return client.writeFrame(h, invalidRequest)
+	}
+	req, err := server.readRequestBody(client.cc, h)
+	if err == nil && req.mtype.stream != streamNone {
+		err = Errorf(Unimplemented, "rpc client: streaming callback %s is not supported", h.ServiceMethod)
+	}
+	if err == nil {
+		req.ctx = context.WithValue(context.Background(), incomingMetadataKey{}, Metadata(h.Metadata))
+		err = server.admit(req)
+	}
+	if err != nil {
+		setHeaderError(h, err)
+		return server.sendResponse(client.cc, h, invalidRequest, &client.sending)
+	}
+	wg := new(sync.WaitGroup) // 反向调用之间互相独立, 不需要等待
+	wg.Add(1)
+	go server.handleRequest(client.cc, req, &client.sending, wg, 0)
+	return nil
+}
+
+// reverseCodec 服务端发起调用时使用的编解码器, 与该连接上的响应共用发送锁
+//
+// 反向调用的响应由服务端的读循环交给 Client.handleResponse, 因此不从连接读取。
+type reverseCodec struct {
+	cc      codec.Codec
+	sending *sync.Mutex
+}
+
+var errReverseRead = errors.New("rpc server: reverse client does not read from the connection")
+
+// newReverseClient 创建在服务端的连接上调用客户端方法的Client
+func newReverseClient(cc codec.Codec, sending *sync.Mutex) *Client {
+	return &Client{
+		seq:     1,
+		cc:      &reverseCodec{cc: cc, sending: sending},
+		opt:     DefaultOption,
+		pending: make(map[uint64]*Call),
+	}
+}
+
+func (c *reverseCodec) ReadHeader(*codec.Header) error {
+	return errReverseRead
+}
+
+func (c *reverseCodec) ReadBody(interface{}) error {
+	return errReverseRead
+}
+
+func (c *reverseCodec) Write(h *codec.Header, body interface{}) error {
+	c.sending.Lock()
+	defer c.sending.Unlock()
+	h.Flags |= codec.FlagReverse
+	return c.cc.Write(h, body)
+}
+
+// Close 连接属于服务端, 由serveCodec关闭
+func (c *reverseCodec) Close() error {
+	return nil
+}
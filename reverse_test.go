@@ -0,0 +1,116 @@
+package GeeRPC
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Watcher 客户端注册的回调
+type Watcher struct {
+	changes chan string
+}
+
+func (w *Watcher) Changed(key string, reply *string) error {
+	w.changes <- key
+	*reply = "ack " + key
+	return nil
+}
+
+// Hub 服务端保存订阅者的连接, 之后通过它们推送
+type Hub struct {
+	mu          sync.Mutex
+	subscribers []*Client
+}
+
+func (h *Hub) Subscribe(ctx context.Context, _ string, ok *bool) error {
+	rc := ReverseClientFromContext(ctx)
+	if rc == nil {
+		return Errorf(Unimplemented, "reverse calls are not supported on this connection")
+	}
+	h.mu.Lock()
+	h.subscribers = append(h.subscribers, rc)
+	h.mu.Unlock()
+	*ok = true
+	return nil
+}
+
+// Touch 在处理调用的同时回调调用方
+func (h *Hub) Touch(ctx context.Context, key string, reply *string) error {
+	return ReverseClientFromContext(ctx).Call(ctx, "Watcher.Changed", key, reply)
+}
+
+func (h *Hub) broadcast(key string) []error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var errs []error
+	for _, rc := range h.subscribers {
+		var reply string
+		errs = append(errs, rc.Call(context.Background(), "Watcher.Changed", key, &reply))
+	}
+	return errs
+}
+
+func TestClient_ServeCallback(t *testing.T) {
+	t.Parallel()
+	hub := new(Hub)
+	server := NewServer()
+	_ = server.Register(hub)
+	l, _ := net.Listen("tcp", ":0")
+	defer func() { _ = l.Close() }()
+	go server.Accept(l)
+
+	client, err := Dial("tcp", l.Addr().String())
+	_assert(err == nil, "dial failed: %v", err)
+	defer func() { _ = client.Close() }()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 没有回调服务时, 反向调用返回Unimplemented
+	var reply string
+	err = client.Call(ctx, "Hub.Touch", "a", &reply)
+	_assert(CodeOf(err) == Unimplemented, "expect Unimplemented without a callback server, got %v", err)
+
+	watcher := &Watcher{changes: make(chan string, 4)}
+	callbacks := NewServer()
+	_ = callbacks.Register(watcher)
+	client.ServeCallback(callbacks)
+
+	// 处理调用的过程中回调调用方
+	err = client.Call(ctx, "Hub.Touch", "b", &reply)
+	_assert(err == nil && reply == "ack b", "expect the callback reply, got %q, %v", reply, err)
+	_assert(<-watcher.changes == "b", "expect the watcher to see b")
+
+	// 服务方法返回后保存连接, 之后主动推送
+	var ok bool
+	err = client.Call(ctx, "Hub.Subscribe", "", &ok)
+	_assert(err == nil && ok, "subscribe failed: %v", err)
+	errs := hub.broadcast("c")
+	_assert(len(errs) == 1 && errs[0] == nil, "broadcast failed: %v", errs)
+	_assert(<-watcher.changes == "c", "expect the watcher to see c")
+
+	// 客户端断开后推送失败
+	_ = client.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for errs = hub.broadcast("d"); errs[0] == nil && time.Now().Before(deadline); errs = hub.broadcast("d") {
+		time.Sleep(10 * time.Millisecond)
+	}
+	_assert(errs[0] != nil, "expect the push to fail after the client closed")
+}
+
+func TestReverseClientFromContext_multiplex(t *testing.T) {
+	t.Parallel()
+	server := NewServer()
+	_ = server.Register(new(Hub))
+	l, _ := net.Listen("tcp", ":0")
+	defer func() { _ = l.Close() }()
+	go server.Accept(l)
+	client, err := Dial("tcp", l.Addr().String(), &Option{Multiplex: true})
+	_assert(err == nil, "dial failed: %v", err)
+	defer func() { _ = client.Close() }()
+	var ok bool
+	err = client.Call(context.Background(), "Hub.Subscribe", "", &ok)
+	_assert(CodeOf(err) == Unimplemented, "expect no reverse client on a multiplexed connection, got %v", err)
+}
@@ -2,11 +2,13 @@ package GeeRPC
 
 import (
 	"GeeRPC/codec"
+	"bufio"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"net/http"
 	"reflect"
@@ -33,6 +35,44 @@ type Option struct {
 	ConnectTimeout time.Duration // 0 means no limit
 	// HandleTimeout 处理超时时间
 	HandleTimeout time.Duration // 0 means no limit
+	// TLSConfig XDial使用 "tls@addr" 时的TLS配置, 不发送到服务端
+	TLSConfig *tls.Config `json:"-"`
+	// Credentials 每次调用附带的凭证, 不发送到服务端
+	Credentials Credentials `json:"-"`
+	// Multiplex 在连接上多路复用, 每个调用使用独立的流, 大的消息不会阻塞其他调用
+	Multiplex bool
+	// Compression 压缩算法, 如 codec.Gzip, 空表示不压缩; 服务端不支持时拒绝连接
+	Compression string
+	// CompressThreshold 消息体小于该字节数时不压缩, 0表示 codec.DefaultCompressThreshold
+	CompressThreshold int
+	// MaxRequestSize 客户端发送的请求体的最大字节数, 超出时调用以ResourceExhausted失败, 0表示不限制; 不发送到服务端
+	MaxRequestSize int `json:"-"`
+	// MaxReplySize 客户端接收的响应体的最大字节数, 在解码之前检查, 0表示不限制; 不发送到服务端
+	MaxReplySize int `json:"-"`
+	// Metrics 记录客户端的调用和连接指标, nil表示不记录; 不发送到服务端
+	Metrics *Metrics `json:"-"`
+	// Tracer 为客户端的每个调用创建span, nil表示不追踪; 不发送到服务端
+	Tracer *Tracer `json:"-"`
+	// Logger 客户端的日志, nil表示使用log的默认Logger; 不发送到服务端
+	Logger Logger `json:"-"`
+	// AccessLogRate 成功调用的访问日志采样率(0到1), 失败的调用总是记录, 0表示不记录; 不发送到服务端
+	AccessLogRate float64 `json:"-"`
+}
+
+// newCodecFunc 按编解码器类型和压缩算法返回创建编解码器的函数
+func (opt *Option) newCodecFunc() (codec.NewCodecFunc, error) {
+	f := codec.NewCodecFuncMap[opt.CodecType]
+	if f == nil {
+		return nil, fmt.Errorf("invalid codec type %s", opt.CodecType)
+	}
+	if opt.Compression == "" {
+		return f, nil
+	}
+	c := codec.GetCompressor(opt.Compression)
+	if c == nil {
+		return nil, fmt.Errorf("unsupported compression %s", opt.Compression)
+	}
+	return codec.WithCompression(f, c, opt.CompressThreshold), nil
 }
 
 var DefaultOption = &Option{
@@ -45,10 +85,46 @@ var DefaultOption = &Option{
 type Server struct {
 	// serviceMap is the registry of service
 	serviceMap sync.Map
+	// regMu 串行化服务的注册, 服务注册后只读, RegisterFunc 复制后整体替换
+	regMu sync.Mutex
+	// limiter 限流, nil表示不限制
+	limiter *limiter
+	// shedder 自适应降载, nil表示不开启
+	shedder *shedder
+	// pool 执行请求的工作池, nil表示每个请求一个goroutine
+	pool *workerPool
+	// interceptors 服务端拦截器
+	interceptors []ServerInterceptor
+	// tlsConfig Accept接收的连接使用TLS, nil表示明文TCP
+	tlsConfig *tls.Config
+	// maxRequestSize, maxReplySize 请求体和响应体的最大字节数, 0表示不限制
+	maxRequestSize, maxReplySize int
+	// metrics 调用和连接指标, nil表示不记录
+	metrics *Metrics
+	// metricsPath HandleHTTP 导出metrics的路径
+	metricsPath string
+	// tracer 为每个调用创建服务端span, nil表示不追踪
+	tracer *Tracer
+	// logger 服务端的日志, nil表示使用log的默认Logger
+	logger Logger
+	// accessLogRate 成功调用的访问日志采样率, 0表示不记录访问日志
+	accessLogRate float64
+	// connSeq 最近分配的连接编号
+	connSeq uint64
+	// conns 正在服务的连接, key为连接编号
+	conns sync.Map
 }
 
-func NewServer() *Server {
-	return &Server{}
+// ServerOption Server的可选配置
+type ServerOption func(*Server)
+
+func NewServer(opts ...ServerOption) *Server {
+	server := &Server{}
+	for _, opt := range opts {
+		opt(server)
+	}
+	_ = server.RegisterName(ReflectionService, &Reflection{server: server})
+	return server
 }
 
 var DefaultServer = NewServer()
@@ -59,10 +135,26 @@ func Register(rcvr interface{}) error {
 
 // Register publishes in the server the set of methods of the receiver value
 func (server *Server) Register(rcvr interface{}) error {
-	s := newService(rcvr) // 创建服务
+	return server.register(newService(rcvr))
+}
+
+// RegisterName 与 Register 相同, 但以name而不是接收者的类型名作为服务名, name可以包含"."
+func (server *Server) RegisterName(name string, rcvr interface{}) error {
+	if name == "" {
+		return errors.New("rpc: no service name for type " + reflect.TypeOf(rcvr).String())
+	}
+	return server.register(newNamedService(name, rcvr))
+}
+
+func (server *Server) register(s *service) error {
+	server.regMu.Lock()
+	defer server.regMu.Unlock()
 	if _, dup := server.serviceMap.LoadOrStore(s.name, s); dup {
 		return fmt.Errorf("rpc: service already defined: %s", s.name)
 	}
+	for _, name := range s.methodNames() {
+		server.log().Debug("rpc server: register", "method", s.name+"."+name)
+	}
 	return nil
 }
 
@@ -94,10 +186,13 @@ func (server *Server) Accept(lis net.Listener) {
 	for {
 		conn, err := lis.Accept()
 		if err != nil {
-			log.Println("RPC Server Accept Error:", err)
+			server.log().Error("rpc server: accept error", "error", err)
 			return
 		}
-		log.Printf("接收到客户端连接 {Local Addr: %s; Remote Addr: %s\n ", conn.LocalAddr().String(), conn.RemoteAddr().String())
+		server.log().Debug("rpc server: accepted connection", "local", conn.LocalAddr(), "remote", conn.RemoteAddr())
+		if server.tlsConfig != nil {
+			conn = tls.Server(conn, server.tlsConfig)
+		}
 		go server.ServeConn(conn)
 	}
 }
@@ -109,50 +204,185 @@ func Accept(lis net.Listener) {
 // ServeConn 服务端处理连接
 func (server *Server) ServeConn(conn io.ReadWriteCloser) {
 	defer func() { conn.Close() }()
+	if tlsConn, ok := conn.(*tls.Conn); ok { // 先完成握手, 以便获取客户端证书
+		_ = tlsConn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+		err := tlsConn.Handshake()
+		_ = tlsConn.SetDeadline(time.Time{})
+		if err != nil {
+			server.log().Warn("rpc server: tls handshake error", "remote", remoteAddr(conn), "error", err)
+			return
+		}
+	}
+	ctx := context.WithValue(context.Background(), peerKey{}, newPeer(conn))
+	remote := remoteAddr(conn)
+	conn = server.metrics.meterConn(sideServer, conn)
+	conn, traffic := countTraffic(conn)
 	var opt Option
-	if err := json.NewDecoder(conn).Decode(&opt); err != nil { // TODO EOF error
-		log.Println("RPC Server option error: ", err)
+	dec := json.NewDecoder(conn)
+	if err := dec.Decode(&opt); err != nil { // TODO EOF error
+		server.log().Warn("rpc server: option error", "remote", remote, "error", err)
 		return
 	}
 	if opt.MagicNumber != MagicNumber {
-		log.Printf("RPC Server invaild magic number: %x\n", opt.MagicNumber)
+		server.log().Warn("rpc server: invalid magic number", "remote", remote, "magic", fmt.Sprintf("%x", opt.MagicNumber))
 		return
 	}
-	f := codec.NewCodecFuncMap[opt.CodecType]
-	if f == nil {
-		log.Printf("RPC Server invaild codec type %s\n", opt.CodecType)
+	f, err := opt.newCodecFunc()
+	if err != nil {
+		server.log().Warn("rpc server: option error", "remote", remote, "error", err)
+		return
 	}
-	server.ServerCodec(f(conn), &opt)
+	sc, ctx := server.trackConn(ctx, conn, remote, &opt, traffic)
+	defer server.untrackConn(sc)
+	// json解码器可能已经多读了紧随Option之后的请求数据, 需要先交给编解码器
+	r := bufio.NewReader(io.MultiReader(dec.Buffered(), conn))
+	if b, err := r.Peek(1); err == nil && b[0] == '\n' { // 跳过json.Encoder写入的换行符
+		_, _ = r.ReadByte()
+	}
+	if opt.Multiplex {
+		server.serveMux(ctx, &bufferedConn{Reader: r, conn: conn}, f, &opt)
+		return
+	}
+	cc := f(&bufferedConn{Reader: r, conn: conn})
+	if err := server.limitCodec(cc); err != nil {
+		server.log().Warn("rpc server: codec error", "remote", remote, "error", err)
+		_ = cc.Close()
+		return
+	}
+	server.serveCodec(ctx, cc, &opt)
+}
+
+// bufferedConn 先读取已缓冲的数据, 再读取底层连接
+type bufferedConn struct {
+	io.Reader
+	conn io.ReadWriteCloser
+}
+
+func (c *bufferedConn) Write(p []byte) (int, error) {
+	return c.conn.Write(p)
+}
+
+func (c *bufferedConn) Close() error {
+	return c.conn.Close()
 }
 
 var invalidRequest = struct{}{}
 
 func (server *Server) ServerCodec(cc codec.Codec, opt *Option) {
+	server.serveCodec(context.Background(), cc, opt)
+}
+
+// serveCodec 处理一个连接上的请求, ctx携带连接的调用方信息
+func (server *Server) serveCodec(ctx context.Context, cc codec.Codec, opt *Option) {
 	sending := new(sync.Mutex) // make sure to send a complete response
 	wg := new(sync.WaitGroup)  // wait until all request are handled
+	var queue *connQueue       // 工作池模式下该连接的请求队列
+	if sc := connFromContext(ctx); sc != nil {
+		queue = sc.queue
+	} else if server.pool != nil {
+		queue = server.pool.newQueue()
+	}
+	streams := newStreamCalls() // 该连接上进行中的流式调用
+	var reverse *Client         // 调用客户端注册的方法, 多路复用时每个流只有一次调用, 不支持
+	if !opt.Multiplex {
+		reverse = newReverseClient(cc, sending)
+		ctx = context.WithValue(ctx, reverseKey{}, reverse)
+	}
 	for {
 		req, err := server.readRequest(cc)
+		if err == nil && req.h.Flags&codec.FlagReverse != 0 && reverse != nil { // 反向调用的响应
+			if err = reverse.handleResponse(req.h, cc.ReadBody); err != nil {
+				break
+			}
+			continue
+		}
+		if err == nil && req.h.Flags != 0 { // 交给进行中的流式调用
+			if err = streams.handle(cc, req.h); err != nil {
+				break
+			}
+			continue
+		}
 		if err != nil {
 			if req == nil {
 				break // it's not possible to recover, so close the connection
 			}
-			req.h.Error = err.Error()
+			setHeaderError(req.h, err)
 			server.sendResponse(cc, req.h, invalidRequest, sending)
 			continue
 		}
+		req.ctx = context.WithValue(ctx, incomingMetadataKey{}, Metadata(req.h.Metadata))
+		if err = server.admit(req); err != nil { // 超出限制时直接拒绝, 不创建goroutine
+			server.reject(cc, req, err, sending)
+			continue
+		}
+		if req.stream != nil {
+			streams.add(req)
+		}
 		wg.Add(1)
-		go server.handleRequest(cc, req, sending, wg, opt.HandleTimeout)
+		if server.pool == nil {
+			go server.handleRequest(cc, req, sending, wg, opt.HandleTimeout)
+			continue
+		}
+		if err = server.pool.submit(queue, func() { server.handleRequest(cc, req, sending, wg, opt.HandleTimeout) }); err != nil {
+			wg.Done()
+			if req.release != nil {
+				req.release()
+			}
+			if req.stream != nil {
+				req.stream.end()
+			}
+			server.reject(cc, req, err, sending)
+		}
+	}
+	streams.cancelAll() // 连接断开后流式调用无法再发送
+	if reverse != nil {
+		reverse.terminateCalls(ErrShutdown)
 	}
 	wg.Wait()
 	_ = cc.Close()
 }
 
+// admit 按降载和限流配置判断是否接收请求
+func (server *Server) admit(req *request) (err error) {
+	if server.shedder != nil {
+		if err = server.shedder.admit(req.h.Metadata); err != nil {
+			return err
+		}
+	}
+	if server.limiter != nil {
+		req.release, err = server.limiter.acquire(req.h.ServiceMethod, req.h.Metadata)
+	}
+	return err
+}
+
+// reject 以err拒绝已读取的请求, 和处理过的请求一样记录指标、追踪和访问日志
+func (server *Server) reject(cc codec.Codec, req *request, err error, sending *sync.Mutex) {
+	if end := server.metrics.begin(sideServer, req.h.ServiceMethod); end != nil {
+		defer end(err)
+	}
+	if span := server.startSpan(req); span != nil {
+		defer server.endSpan(span, req, err)
+	}
+	if server.accessLogRate > 0 {
+		defer server.logAccess(req, err)
+	}
+	req.mtype.record(time.Since(req.start), err)
+	setHeaderError(req.h, err)
+	server.sendResponse(cc, req.h, invalidRequest, sending)
+}
+
 // request stores all information of a call
 type request struct {
 	h            *codec.Header // header of request
 	argv, replyv reflect.Value // argv and replyv of request
 	mtype        *methodType   // type of request
 	svc          *service      // service of request
+	release      func()        // 释放限流名额, 没有限流时为nil
+	argSize      int64         // 请求体在连接上的字节数, 用于追踪
+	replySize    int64         // 响应体在连接上的字节数, 用于追踪
+	start        time.Time     // 请求读取完成的时间, 用于计算排队时间
+	ctx          context.Context
+	stream       *Stream // 流式方法的流, 普通方法为nil
 }
 
 func (server *Server) readRequest(cc codec.Codec) (*request, error) {
@@ -160,22 +390,51 @@ func (server *Server) readRequest(cc codec.Codec) (*request, error) {
 	if err != nil {
 		return nil, err
 	}
-	req := &request{h: h}
+	if h.Flags != 0 { // 进行中的流式调用的消息或反向调用的响应, 消息体由serveCodec读取
+		return &request{h: h}, nil
+	}
+	return server.readRequestBody(cc, h)
+}
+
+// readRequestBody 查找h对应的服务方法并读取请求体
+func (server *Server) readRequestBody(cc codec.Codec, h *codec.Header) (req *request, err error) {
+	req = &request{h: h}
 	req.svc, req.mtype, err = server.findService(h.ServiceMethod)
 	if err != nil {
+		_ = cc.ReadBody(nil) // 丢弃请求体, 否则下一个请求头会读到它
 		return req, err
 	}
-	req.argv = req.mtype.newArgv()
-	req.replyv = req.mtype.newReplyv()
+	if req.mtype.stream != streamNone {
+		req.stream = req.mtype.newStream()
+	}
+	switch req.mtype.stream {
+	case streamNone:
+		req.argv, req.replyv = req.mtype.newArgv(), req.mtype.newReplyv()
+	case streamServer:
+		req.argv, req.replyv = req.mtype.newArgv(), req.mtype.newStreamv(req.stream)
+	case streamClient:
+		req.argv, req.replyv = req.mtype.newStreamv(req.stream), req.mtype.newReplyv()
+	case streamBidi:
+		req.argv = req.mtype.newStreamv(req.stream)
+	}
+	if req.mtype.RecvType != nil { // 参数由之后的消息发送, 请求体为空
+		if err = cc.ReadBody(nil); err != nil {
+			return req, err
+		}
+		req.start = time.Now()
+		return req, nil
+	}
 
 	argvi := req.argv.Interface()
 	if req.argv.Type().Kind() != reflect.Ptr {
 		argvi = req.argv.Addr().Interface() // 如果不是指针类型，那么取地址
 	}
 	if err = cc.ReadBody(argvi); err != nil {
-		log.Println("rpc server: read argv err:", err)
-		return req, err
+		server.log().Warn("rpc server: read argv error", "method", h.ServiceMethod, "seq", h.Seq, "error", err)
+		return req, sizeError(err)
 	}
+	req.argSize = readSize(cc)
+	req.start = time.Now()
 	return req, nil
 }
 
@@ -183,51 +442,149 @@ func (server *Server) readRequestHeader(cc codec.Codec) (*codec.Header, error) {
 	var h codec.Header
 	if err := cc.ReadHeader(&h); err != nil {
 		if err != io.EOF && err != io.ErrUnexpectedEOF {
-			log.Println("rpc server: read header error:", err)
+			server.log().Warn("rpc server: read header error", "error", err)
 		}
 		return nil, err
 	}
 	return &h, nil
 }
 
-func (server *Server) sendResponse(cc codec.Codec, h *codec.Header, body interface{}, sending *sync.Mutex) {
+func (server *Server) sendResponse(cc codec.Codec, h *codec.Header, body interface{}, sending *sync.Mutex) error {
+	sending.Lock()
+	defer sending.Unlock()
+	return server.writeResponse(cc, h, body)
+}
+
+// sendReply 发送req的最终响应, 并记录响应体的字节数
+func (server *Server) sendReply(cc codec.Codec, req *request, body interface{}, sending *sync.Mutex) {
 	sending.Lock()
 	defer sending.Unlock()
-	if err := cc.Write(h, body); err != nil {
-		log.Println("rpc server: write response error:", err)
+	if server.writeResponse(cc, req.h, body) == nil {
+		req.replySize = writeSize(cc)
 	}
 }
 
+// writeResponse 写入响应, 调用方持有sending
+func (server *Server) writeResponse(cc codec.Codec, h *codec.Header, body interface{}) error {
+	err := cc.Write(h, body)
+	if errors.Is(err, codec.ErrMessageTooLarge) && !isStreamMsg(h) { // 没有发出任何数据, 改为发送错误
+		eh := *h
+		setHeaderError(&eh, sizeError(err))
+		err = cc.Write(&eh, invalidRequest)
+	}
+	if err != nil {
+		server.log().Error("rpc server: write response error", "method", h.ServiceMethod, "seq", h.Seq, "error", err)
+		return sizeError(err)
+	}
+	return nil
+}
+
 func (server *Server) handleRequest(cc codec.Codec, req *request, sending *sync.Mutex, wg *sync.WaitGroup, timeout time.Duration) {
 	defer wg.Done()
-	called := make(chan struct{}) // call 方法是否被调用
-	sent := make(chan struct{})   // call 方法是否被发送
+	if timeout == 0 { // 没有超时限制时直接在当前goroutine中处理
+		server.process(cc, req, sending, nil)
+		return
+	}
+	ctx, cancel := context.WithTimeout(req.ctx, timeout) // 超时后通知服务方法
+	defer cancel()
+	req.ctx = ctx
+	// 带缓冲, 超时返回后处理请求的goroutine不会阻塞
+	called := make(chan struct{}, 1) // call 方法是否被调用
+	sent := make(chan struct{}, 1)   // call 方法是否被发送
 	go func() {
-		err := req.svc.call(req.mtype, req.argv, req.replyv)
-		called <- struct{}{}
-		if err != nil {
-			req.h.Error = err.Error()
-			server.sendResponse(cc, req.h, invalidRequest, sending)
-			sent <- struct{}{}
-			return
-		}
-		server.sendResponse(cc, req.h, req.replyv.Interface(), sending)
+		server.process(cc, req, sending, called)
 		sent <- struct{}{}
 	}()
-	if timeout == 0 {
-		<-called
-		<-sent
-		return
-	}
 	select {
 	case <-time.After(timeout):
-		req.h.Error = fmt.Sprintf("rpc server: request handle timeout: expect within %s", timeout)
+		if req.stream != nil { // 结束响应之后不能再发送消息
+			req.stream.end()
+		}
+		setHeaderError(req.h, Errorf(DeadlineExceeded, "rpc server: request handle timeout: expect within %s", timeout))
 		server.sendResponse(cc, req.h, invalidRequest, sending)
+		if server.pool != nil { // 服务方法返回前继续占用worker, 执行的请求数不超过Workers
+			<-sent
+		}
 	case <-called:
 		<-sent
 	}
 }
 
+// process 调用服务方法并发送响应, called不为nil时在方法返回后通知
+func (server *Server) process(cc codec.Codec, req *request, sending *sync.Mutex, called chan<- struct{}) {
+	if req.release != nil { // 请求真正处理完成后才释放名额
+		defer req.release()
+	}
+	var err error
+	if end := server.metrics.begin(sideServer, req.h.ServiceMethod); end != nil {
+		defer func() { end(err) }()
+	}
+	if span := server.startSpan(req); span != nil {
+		defer func() { server.endSpan(span, req, err) }()
+	}
+	if server.accessLogRate > 0 {
+		defer func() { server.logAccess(req, err) }()
+	}
+	defer func(start time.Time) { req.mtype.record(time.Since(start), err) }(time.Now())
+	if sc := connFromContext(req.ctx); sc != nil {
+		sc.begin(req)
+		defer sc.end(req)
+	}
+	if server.shedder != nil { // 排队太久的请求不再执行
+		err = server.shedder.observe(time.Since(req.start), req.h.Metadata)
+	}
+	if err == nil {
+		if req.stream != nil {
+			server.openStream(cc, req, sending)
+		}
+		err = server.invoke(req)
+	}
+	if called != nil {
+		called <- struct{}{}
+	}
+	if req.stream != nil { // 流式方法结束时的响应头带结束标记
+		req.stream.end()
+		req.h.Flags = codec.FlagStream | codec.FlagEndStream
+	}
+	if req.stream != nil && err == nil && req.mtype.stream != streamClient { // 只有客户端流有响应体
+		server.sendReply(cc, req, invalidRequest, sending)
+		return
+	}
+	if err != nil {
+		setHeaderError(req.h, err)
+		server.sendReply(cc, req, invalidRequest, sending)
+		return
+	}
+	server.sendReply(cc, req, req.replyv.Interface(), sending)
+}
+
+// openStream 准备流式方法的流, 每条消息以不带结束标记的响应头发送
+func (server *Server) openStream(cc codec.Codec, req *request, sending *sync.Mutex) {
+	req.stream.ctx = req.ctx
+	req.stream.write = func(flags uint32, body interface{}) error {
+		h := &codec.Header{ServiceMethod: req.h.ServiceMethod, Seq: req.h.Seq, Flags: flags}
+		return server.sendResponse(cc, h, body, sending)
+	}
+}
+
+// invoke 经过拦截器调用服务方法
+func (server *Server) invoke(req *request) error {
+	handler := func(ctx context.Context) error {
+		return req.svc.call(ctx, req.mtype, req.argv, req.replyv)
+	}
+	if len(server.interceptors) == 0 {
+		return handler(req.ctx)
+	}
+	info := &ServerInfo{
+		ServiceMethod: req.h.ServiceMethod,
+		Args:          req.argv.Interface(),
+	}
+	if req.replyv.IsValid() { // 双向流方法没有响应参数
+		info.Reply = req.replyv.Interface()
+	}
+	return chain(server.interceptors, info, handler)(req.ctx)
+}
+
 // ServeHTTP implements an http.Handler that answers RPC requests.
 func (server *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	if req.Method != "CONNECT" {
@@ -238,7 +595,7 @@ func (server *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 	conn, _, err := w.(http.Hijacker).Hijack() // 获取底层的网络连接, 用于后续的RPC通信
 	if err != nil {
-		log.Println("rpc hijacking", req.RemoteAddr, ":", err.Error())
+		server.log().Error("rpc server: hijacking error", "remote", req.RemoteAddr, "error", err)
 		return
 	}
 	// 通知客户端连接建立成功
@@ -250,7 +607,11 @@ func (server *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 func (server *Server) HandleHTTP() {
 	http.Handle(defaultRPCPath, server)
 	http.Handle(defaultDebugPath, debugHTTP{server})
-	log.Println("rpc server debug path:", defaultDebugPath)
+	server.log().Info("rpc server: debug path", "path", defaultDebugPath)
+	if server.metrics != nil {
+		http.Handle(server.metricsPath, server.metrics)
+		server.log().Info("rpc server: metrics path", "path", server.metricsPath)
+	}
 }
 
 // HandleHTTP 在rpcPath上注册一个HTTP处理程序以处理RPC消息
@@ -5,12 +5,15 @@
 // 2. 方法必须有两个参数, 都是指针类型
 // 3. 方法的第二个参数是指针类型, 并且返回值类型是error
 // 4. 方法返回值只有error
+// 5. 方法可以在参数之前接收一个 context.Context, 用于获取调用方信息和取消信号
 package GeeRPC
 
 import (
-	"log"
+	"context"
 	"reflect"
+	"sort"
 	"sync/atomic"
+	"time"
 	"unicode"
 	"unicode/utf8"
 )
@@ -25,13 +28,55 @@ type methodType struct {
 	ReplyType reflect.Type
 	// numCalls	调用次数
 	numCalls uint64
+	// numErrors 返回错误的调用次数
+	numErrors uint64
+	// numRecorded 记录了耗时的请求数, 包括被降载拒绝而没有调用的请求
+	numRecorded uint64
+	// latencyNanos, maxLatencyNanos 处理请求的总耗时和最大耗时(纳秒)
+	latencyNanos, maxLatencyNanos uint64
+	// withContext 方法的第一个参数是否为 context.Context
+	withContext bool
+	// stream 流式方法的种类, 普通方法为 streamNone
+	stream streamKind
+	// SendType 服务端流和双向流中服务端发送的消息类型
+	SendType reflect.Type
+	// RecvType 客户端流和双向流中客户端发送的消息类型
+	RecvType reflect.Type
+	// fn 通过 RegisterFunc 注册的方法, 不为nil时直接调用而不经过反射
+	fn func(ctx context.Context, argv, replyv reflect.Value) error
 }
 
+// streamKind 流式方法的种类
+type streamKind int
+
+const (
+	streamNone   streamKind = iota
+	streamServer            // 服务端流, 最后一个参数为 ServerStream
+	streamClient            // 客户端流, 第一个参数为 RecvStream
+	streamBidi              // 双向流, 唯一的参数为 BidiStream
+)
+
 // NumCalls 调用次数
 func (m *methodType) NumCalls() uint64 {
 	return atomic.LoadUint64(&m.numCalls) // 原子操作, 读取调用次数
 }
 
+// record 记录一次调用的耗时和结果
+func (m *methodType) record(d time.Duration, err error) {
+	if err != nil {
+		atomic.AddUint64(&m.numErrors, 1)
+	}
+	n := uint64(d)
+	atomic.AddUint64(&m.numRecorded, 1)
+	atomic.AddUint64(&m.latencyNanos, n)
+	for {
+		max := atomic.LoadUint64(&m.maxLatencyNanos)
+		if n <= max || atomic.CompareAndSwapUint64(&m.maxLatencyNanos, max, n) {
+			return
+		}
+	}
+}
+
 // newArgv 创建参数类型
 func (m *methodType) newArgv() reflect.Value {
 	var argv reflect.Value
@@ -75,14 +120,20 @@ type service struct {
 // rcvr		服务实例
 // 返回值		服务
 func newService(rcvr interface{}) *service {
-	s := new(service)                               // 创建服务
-	s.rcvr = reflect.ValueOf(rcvr)                  // 获取服务实例
-	s.name = reflect.Indirect(s.rcvr).Type().Name() // 获取服务名称
-	s.typ = reflect.TypeOf(rcvr)                    // 获取服务类型
-	if !isExported(s.name) {                        // 判断服务名称是否是导出的
-		panic("rpc server: " + s.name + " is not a valid service name")
-	}
-	s.registerMethods() // 注册服务方法
+	name := reflect.Indirect(reflect.ValueOf(rcvr)).Type().Name() // 获取服务名称
+	if !isExported(name) {                                        // 判断服务名称是否是导出的
+		panic("rpc server: " + name + " is not a valid service name")
+	}
+	return newNamedService(name, rcvr)
+}
+
+// newNamedService 以name为服务名创建服务, 不要求接收者的类型是导出的
+func newNamedService(name string, rcvr interface{}) *service {
+	s := new(service)              // 创建服务
+	s.rcvr = reflect.ValueOf(rcvr) // 获取服务实例
+	s.name = name
+	s.typ = reflect.TypeOf(rcvr) // 获取服务类型
+	s.registerMethods()          // 注册服务方法
 	return s
 }
 
@@ -93,35 +144,86 @@ func (s *service) registerMethods() {
 	for i := 0; i < s.typ.NumMethod(); i++ {
 		method := s.typ.Method(i) // 获取服务方法
 		mType := method.Type      // 获取服务方法类型
-		// 判断服务方法参数个数是否为3个, 且返回值个数是否为1个
-		if mType.NumIn() != 3 || mType.NumOut() != 1 {
-			continue
+		// 第一个参数可以是 context.Context, 其后才是参数(双向流方法只有一个参数)
+		withContext := mType.NumIn() >= 3 && mType.In(1) == typeOfContext
+		first := 1
+		if withContext {
+			first = 2
 		}
-		// 判断服务方法返回值类型是否为error
-		if mType.Out(0) != reflect.TypeOf((*error)(nil)).Elem() {
+		// 判断服务方法返回值个数是否为1个, 且类型是否为error
+		if mType.NumOut() != 1 || mType.Out(0) != typeOfError {
 			continue
 		}
-		argType, replyType := mType.In(1), mType.In(2) // 获取服务方法参数类型和返回值类型
-		// 判断服务方法参数类型是否为导出的, 且返回值类型是否为导出的
-		if !isExportedOrBuiltinType(argType) || !isExportedOrBuiltinType(replyType) {
+		mt := newMethodType(method, first)
+		if mt == nil {
 			continue
 		}
+		mt.withContext = withContext
 		// 将服务方法注册到服务方法中
-		s.method[method.Name] = &methodType{
-			method:    method,
-			ArgType:   argType,
-			ReplyType: replyType,
+		s.method[method.Name] = mt
+	}
+}
+
+// methodNames 按名称排序的服务方法名
+func (s *service) methodNames() []string {
+	names := make([]string, 0, len(s.method))
+	for name := range s.method {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newMethodType 按参数判断方法的种类, first为第一个参数(不含context)的下标, 不是服务方法时返回nil
+func newMethodType(method reflect.Method, first int) *methodType {
+	mType := method.Type
+	if mType.NumIn() == first+1 { // 唯一的参数是双向流
+		argType := mType.In(first)
+		send, recv, ok := streamTypes(argType)
+		if !ok || send == nil || recv == nil || !isExportedOrBuiltinType(send) || !isExportedOrBuiltinType(recv) {
+			return nil
 		}
-		log.Printf("rpc server: register %s.%s\n", s.name, method.Name)
+		return &methodType{method: method, ArgType: argType, stream: streamBidi, SendType: send, RecvType: recv}
+	}
+	// 其余的方法有2个参数(不含context)
+	if mType.NumIn() != first+2 {
+		return nil
+	}
+	m := &methodType{method: method, ArgType: mType.In(first), ReplyType: mType.In(first + 1)}
+	checkArg, checkReply := m.ArgType, m.ReplyType // 流类型检查的是消息类型
+	if send, recv, ok := streamTypes(m.ReplyType); ok && recv == nil {
+		m.stream, m.SendType, checkReply = streamServer, send, send
+	} else if send, recv, ok := streamTypes(m.ArgType); ok && send == nil {
+		m.stream, m.RecvType, checkArg = streamClient, recv, recv
 	}
+	// 判断服务方法参数类型是否为导出的, 且返回值类型是否为导出的
+	if !isExportedOrBuiltinType(checkArg) || !isExportedOrBuiltinType(checkReply) {
+		return nil
+	}
+	return m
 }
 
+var (
+	typeOfError   = reflect.TypeOf((*error)(nil)).Elem()
+	typeOfContext = reflect.TypeOf((*context.Context)(nil)).Elem()
+)
+
 // call 调用服务方法
-func (s *service) call(m *methodType, argv, replyv reflect.Value) error {
+func (s *service) call(ctx context.Context, m *methodType, argv, replyv reflect.Value) error {
 	atomic.AddUint64(&m.numCalls, 1) // 原子操作, 调用次数加1
-	function := m.method.Func        // 获取服务方法
+	if m.fn != nil {
+		return m.fn(ctx, argv, replyv)
+	}
+	function := m.method.Func // 获取服务方法
 	// 调用服务方法
-	returnValues := function.Call([]reflect.Value{s.rcvr, argv, replyv})
+	in := []reflect.Value{s.rcvr, argv, replyv}
+	if m.withContext {
+		in = []reflect.Value{s.rcvr, reflect.ValueOf(ctx), argv, replyv}
+	}
+	if !replyv.IsValid() { // 双向流方法只有一个参数
+		in = in[:len(in)-1]
+	}
+	returnValues := function.Call(in)
 	// 判断服务方法返回值是否为error
 	if errInter := returnValues[0].Interface(); errInter != nil {
 		return errInter.(error)
@@ -1,7 +1,9 @@
 package GeeRPC
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"reflect"
 	"testing"
 )
@@ -28,6 +30,34 @@ func _assert(cond bool, msg string, v ...interface{}) {
 	}
 }
 
+// testServer 测试用的Server, 监听随机端口
+type testServer struct {
+	*Server
+	addr string
+	tb   testing.TB
+}
+
+// startTestServer 以opts启动Server并注册测试共用的无状态服务, 测试结束时关闭监听
+func startTestServer(tb testing.TB, opts ...ServerOption) *testServer {
+	server := NewServer(opts...)
+	for _, rcvr := range []interface{}{new(Foo), new(Repeat), new(Sized), new(Counter), new(Sleeper)} {
+		_assert(server.Register(rcvr) == nil, "register %T failed", rcvr)
+	}
+	l, err := net.Listen("tcp", ":0")
+	_assert(err == nil, "listen failed: %v", err)
+	tb.Cleanup(func() { _ = l.Close() })
+	go server.Accept(l)
+	return &testServer{Server: server, addr: l.Addr().String(), tb: tb}
+}
+
+// dial 连接到ts, 测试结束时关闭客户端
+func (ts *testServer) dial(opts ...*Option) *Client {
+	client, err := Dial("tcp", ts.addr, opts...)
+	_assert(err == nil, "dial failed: %v", err)
+	ts.tb.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
 // TestNewService 测试NewService
 func TestNewService(t *testing.T) {
 	var foo Foo
@@ -46,6 +76,30 @@ func TestCall(t *testing.T) {
 	argv := mType.newArgv()
 	replyv := mType.newReplyv()
 	argv.Set(reflect.ValueOf(Args{Num1: 1, Num2: 2}))
-	err := s.call(mType, argv, replyv)
+	err := s.call(context.Background(), mType, argv, replyv)
 	_assert(err == nil && *replyv.Interface().(*int) == 3, "TestCall failed!")
 }
+
+// Baz 方法第一个参数为 context.Context
+type Baz int
+
+func (b Baz) Sum(ctx context.Context, args Args, reply *int) error {
+	if ctx == nil {
+		return fmt.Errorf("nil context")
+	}
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+// TestNewService_context 测试带context的方法
+func TestNewService_context(t *testing.T) {
+	var baz Baz
+	s := newService(&baz)
+	mType := s.method["Sum"]
+	_assert(mType != nil && mType.withContext, "expect a context-aware method")
+	argv := mType.newArgv()
+	replyv := mType.newReplyv()
+	argv.Set(reflect.ValueOf(Args{Num1: 1, Num2: 2}))
+	err := s.call(context.Background(), mType, argv, replyv)
+	_assert(err == nil && *replyv.Interface().(*int) == 3, "TestNewService_context failed!")
+}
@@ -0,0 +1,120 @@
+package GeeRPC
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Shedding 自适应降载配置
+//
+// 参考CoDel: 统计每个观察窗口内请求在 service.call 之前排队时间的最小值,
+// 最小值仍超过Target说明请求在持续堆积, 此时按优先级从低到高拒绝新的请求,
+// 并直接拒绝已经排队超过Target的请求。过载持续的窗口越多, 被拒绝的优先级越高。
+type Shedding struct {
+	// Target 目标排队延迟, 默认5ms
+	Target time.Duration
+	// Interval 观察窗口, 默认100ms
+	Interval time.Duration
+	// PriorityKey 元数据中优先级的键, 默认 "priority", 值为整数, 越大越重要, 缺省为0
+	PriorityKey string
+	// MaxPriority 优先级不低于该值的请求从不被拒绝, 默认10
+	MaxPriority int
+}
+
+// WithShedding 为Server开启自适应降载
+func WithShedding(s Shedding) ServerOption {
+	return func(server *Server) {
+		server.shedder = newShedder(s)
+	}
+}
+
+// shedder 实现Shedding
+type shedder struct {
+	cfg Shedding
+	mu  sync.Mutex
+	// intervalStart 当前观察窗口的开始时间
+	intervalStart time.Time
+	// minDelay 当前窗口内的最小排队延迟, 没有样本时为-1
+	minDelay time.Duration
+	// overloaded 上一个窗口是否过载
+	overloaded bool
+	// cutoff 过载时优先级低于cutoff的请求被拒绝
+	cutoff int
+}
+
+func newShedder(s Shedding) *shedder {
+	if s.Target <= 0 {
+		s.Target = 5 * time.Millisecond
+	}
+	if s.Interval <= 0 {
+		s.Interval = 100 * time.Millisecond
+	}
+	if s.PriorityKey == "" {
+		s.PriorityKey = "priority"
+	}
+	if s.MaxPriority <= 0 {
+		s.MaxPriority = 10
+	}
+	return &shedder{cfg: s, intervalStart: time.Now(), minDelay: -1}
+}
+
+// priority 从元数据中读取优先级
+func (s *shedder) priority(md map[string]string) int {
+	p, _ := strconv.Atoi(md[s.cfg.PriorityKey])
+	return p
+}
+
+// rollover 窗口结束时更新过载状态, 调用方持有锁
+func (s *shedder) rollover(now time.Time) {
+	elapsed := now.Sub(s.intervalStart)
+	if elapsed < s.cfg.Interval {
+		return
+	}
+	// 窗口内没有请求开始执行时视为不过载: 过载时新的请求大多在admit中被拒绝, 不会留下样本,
+	// 若沿用过载状态, cutoff会一直升高, 负载消失后也不再恢复。仍在排队的请求执行时会重新触发过载
+	s.overloaded = s.minDelay > s.cfg.Target
+	if s.overloaded {
+		if s.cutoff < s.cfg.MaxPriority {
+			s.cutoff++
+		}
+	} else if s.cutoff > 0 {
+		s.cutoff--
+	}
+	// 距上次更新已过去多个窗口, 之后的窗口都没有样本
+	if idle := int(elapsed/s.cfg.Interval) - 1; idle > 0 {
+		s.overloaded = false
+		if s.cutoff -= idle; s.cutoff < 0 {
+			s.cutoff = 0
+		}
+	}
+	s.intervalStart = now
+	s.minDelay = -1
+}
+
+// admit 判断是否接收新的请求
+func (s *shedder) admit(md map[string]string) error {
+	p := s.priority(md)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rollover(time.Now())
+	if s.overloaded && p < s.cutoff && p < s.cfg.MaxPriority {
+		return Errorf(ResourceExhausted, "rpc server: overloaded, shedding requests with priority below %d", s.cutoff)
+	}
+	return nil
+}
+
+// observe 在 service.call 之前记录请求的排队时间, 返回错误时请求不应再执行
+func (s *shedder) observe(waited time.Duration, md map[string]string) error {
+	p := s.priority(md)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.minDelay < 0 || waited < s.minDelay {
+		s.minDelay = waited
+	}
+	s.rollover(time.Now())
+	if s.overloaded && waited > s.cfg.Target && p < s.cfg.MaxPriority {
+		return Errorf(ResourceExhausted, "rpc server: overloaded, request queued for %s", waited)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package GeeRPC
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestShedder 测试排队延迟持续超过目标时按优先级降载
+func TestShedder(t *testing.T) {
+	s := newShedder(Shedding{Target: 5 * time.Millisecond, Interval: 10 * time.Millisecond})
+	low, high, critical := Metadata{}, Metadata{"priority": "5"}, Metadata{"priority": "10"}
+
+	_assert(s.observe(20*time.Millisecond, low) == nil, "expect no shedding before the first interval ends")
+	time.Sleep(15 * time.Millisecond)
+	_assert(s.observe(20*time.Millisecond, low) != nil, "expect a stale request to be dropped once overloaded")
+	_assert(CodeOf(s.admit(low)) == ResourceExhausted, "expect low priority to be shed")
+	_assert(s.admit(high) == nil, "expect higher priority to be admitted")
+	_assert(s.observe(20*time.Millisecond, critical) == nil, "expect critical requests never to be dropped")
+
+	// 排队延迟恢复正常后不再降载
+	time.Sleep(15 * time.Millisecond)
+	_assert(s.observe(time.Millisecond, low) == nil, "expect short waits to run")
+	time.Sleep(15 * time.Millisecond)
+	_assert(s.admit(low) == nil, "expect shedding to stop when queueing delay is back under target")
+}
+
+func TestServer_shedding(t *testing.T) {
+	t.Parallel()
+	server := startTestServer(t, WithShedding(Shedding{Interval: time.Hour}))
+	client := server.dial()
+
+	var sum int
+	err := client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &sum)
+	_assert(err == nil && sum == 3, "expect calls to pass while not overloaded, got %v", err)
+
+	server.shedder.mu.Lock()
+	server.shedder.overloaded, server.shedder.cutoff = true, 1
+	server.shedder.mu.Unlock()
+	err = client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &sum)
+	_assert(CodeOf(err) == ResourceExhausted, "expect default priority to be shed, got %v", err)
+	ctx := WithMetadata(context.Background(), Metadata{"priority": "1"})
+	err = client.Call(ctx, "Foo.Sum", Args{Num1: 1, Num2: 2}, &sum)
+	_assert(err == nil, "expect priority from metadata to be admitted, got %v", err)
+}
+
+// Sleeper 按参数的毫秒数休眠
+type Sleeper int
+
+func (s Sleeper) Sleep(ms int, reply *int) error {
+	time.Sleep(time.Duration(ms) * time.Millisecond)
+	return nil
+}
+
+// TestServer_sheddingRecovers 测试过载时请求被拒绝, 负载消失几个窗口后默认优先级的请求重新被接收
+func TestServer_sheddingRecovers(t *testing.T) {
+	t.Parallel()
+	client := startTestServer(t, WithShedding(Shedding{Target: 5 * time.Millisecond, Interval: 20 * time.Millisecond}), WithWorkerPool(WorkerPool{Workers: 1})).dial()
+
+	// 4个并发调用共用1个worker, 排队时间持续超过Target
+	var wg sync.WaitGroup
+	var shed int32
+	stop := time.Now().Add(300 * time.Millisecond)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(stop) {
+				var reply int
+				if err := client.Call(context.Background(), "Sleeper.Sleep", 10, &reply); CodeOf(err) == ResourceExhausted {
+					atomic.AddInt32(&shed, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	_assert(atomic.LoadInt32(&shed) > 0, "expect requests to be shed under sustained load")
+
+	time.Sleep(100 * time.Millisecond)
+	var sum int
+	err := client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &sum)
+	_assert(err == nil && sum == 3, "expect default priority to be admitted after the load stops, got %v", err)
+}
@@ -0,0 +1,37 @@
+package GeeRPC
+
+import (
+	"GeeRPC/codec"
+	"errors"
+)
+
+// WithMaxMessageSize 限制服务端读取的请求体和发送的响应体的字节数, 不大于0时不限制
+//
+// 大小在解码之前检查: 超限的请求体被跳过, 该请求以ResourceExhausted失败, 连接继续使用;
+// 超限的响应不会发出, 客户端收到ResourceExhausted。只有消息头等无法跳过的数据超限时才关闭连接,
+// JSON编解码器的请求体超限时也无法跳过。编解码器没有实现 codec.SizeLimiter 的连接被拒绝。
+// 客户端的限制见 Option.MaxRequestSize 和 Option.MaxReplySize, 编解码器不支持时 Dial 返回错误, 多路复用时调用失败。
+func WithMaxMessageSize(maxRequest, maxReply int) ServerOption {
+	return func(server *Server) {
+		server.maxRequestSize = maxRequest
+		server.maxReplySize = maxReply
+	}
+}
+
+// limitCodec 为服务端的编解码器设置 WithMaxMessageSize 的限制, 编解码器不支持时返回错误
+func (server *Server) limitCodec(cc codec.Codec) error {
+	return codec.SetMaxMessageSize(cc, server.maxRequestSize, server.maxReplySize)
+}
+
+// limitCodec 为客户端的编解码器设置 Option.MaxReplySize 和 Option.MaxRequestSize 的限制, 编解码器不支持时返回错误
+func (opt *Option) limitCodec(cc codec.Codec) error {
+	return codec.SetMaxMessageSize(cc, opt.MaxReplySize, opt.MaxRequestSize)
+}
+
+// sizeError 把编解码器的 codec.ErrMessageTooLarge 转换为ResourceExhausted, 其他错误原样返回
+func sizeError(err error) error {
+	if err != nil && errors.Is(err, codec.ErrMessageTooLarge) {
+		return Errorf(ResourceExhausted, "%v", err)
+	}
+	return err
+}
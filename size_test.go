@@ -0,0 +1,189 @@
+package GeeRPC
+
+import (
+	"GeeRPC/codec"
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Payload 带类型定义的消息, 用于检查跳过超限消息后gob的类型信息仍然同步
+type Payload struct {
+	Data []byte
+}
+
+// Sized 按参数返回指定大小的响应
+type Sized int
+
+func (s Sized) Echo(args Payload, reply *Payload) error {
+	*reply = args
+	return nil
+}
+
+func (s Sized) Make(n int, reply *Payload) error {
+	reply.Data = make([]byte, n)
+	return nil
+}
+
+// callSized 调用Sized.Echo, 返回响应的长度
+func callSized(client *Client, method string, args interface{}) (int, error) {
+	var reply Payload
+	err := client.Call(context.Background(), method, args, &reply)
+	return len(reply.Data), err
+}
+
+func testMaxMessageSize(t *testing.T, opt *Option) {
+	addr := startTestServer(t, WithMaxMessageSize(1000, 2000)).addr
+	client, err := Dial("tcp", addr, opt)
+	_assert(err == nil, "dial failed: %v", err)
+	defer func() { _ = client.Close() }()
+
+	// 第一次调用就超限, 之后的调用仍要用到随它发送的类型定义
+	_, err = callSized(client, "Sized.Echo", Payload{Data: make([]byte, 4000)})
+	_assert(CodeOf(err) == ResourceExhausted, "expect ResourceExhausted for big request, got %v", err)
+	n, err := callSized(client, "Sized.Echo", Payload{Data: make([]byte, 10)})
+	_assert(err == nil && n == 10, "connection should survive a big request: %d, %v", n, err)
+
+	_, err = callSized(client, "Sized.Make", 4000)
+	_assert(CodeOf(err) == ResourceExhausted, "expect ResourceExhausted for big reply, got %v", err)
+	n, err = callSized(client, "Sized.Make", 1500)
+	_assert(err == nil && n == 1500, "connection should survive a big reply: %d, %v", n, err)
+}
+
+func TestWithMaxMessageSize(t *testing.T) {
+	t.Parallel()
+	t.Run("plain", func(t *testing.T) { testMaxMessageSize(t, nil) })
+	t.Run("multiplex", func(t *testing.T) { testMaxMessageSize(t, &Option{Multiplex: true}) })
+}
+
+// TestMaxMessageSize_json 测试JSON编解码器的大小限制, 超限的请求体无法跳过, 连接随后关闭
+func TestMaxMessageSize_json(t *testing.T) {
+	t.Parallel()
+	addr := startTestServer(t, WithMaxMessageSize(1000, 2000)).addr
+	client, err := Dial("tcp", addr, &Option{CodecType: codec.JsonType})
+	_assert(err == nil, "dial failed: %v", err)
+	defer func() { _ = client.Close() }()
+
+	_, err = callSized(client, "Sized.Make", 4000)
+	_assert(CodeOf(err) == ResourceExhausted, "expect ResourceExhausted for big reply, got %v", err)
+	n, err := callSized(client, "Sized.Make", 1000)
+	_assert(err == nil && n == 1000, "connection should survive a big reply: %d, %v", n, err)
+
+	_, err = callSized(client, "Sized.Echo", Payload{Data: make([]byte, 4000)})
+	_assert(CodeOf(err) == ResourceExhausted, "expect ResourceExhausted for big request, got %v", err)
+	waitFor(func() bool { return !client.IsAvailable() })
+	_assert(!client.IsAvailable(), "expect the server to close the connection after a big request")
+
+	client, err = Dial("tcp", addr, &Option{CodecType: codec.JsonType, MaxReplySize: 500})
+	_assert(err == nil, "dial failed: %v", err)
+	defer func() { _ = client.Close() }()
+	_, err = callSized(client, "Sized.Make", 1000)
+	_assert(CodeOf(err) == ResourceExhausted, "expect ResourceExhausted for a reply over the client limit, got %v", err)
+}
+
+// unlimitedType 不支持大小限制的编解码器
+const unlimitedType codec.Type = "application/x-unlimited"
+
+// unlimitedCodec 隐藏了gob编解码器的 SetMaxMessageSize
+type unlimitedCodec struct{ codec.Codec }
+
+func init() {
+	codec.NewCodecFuncMap[unlimitedType] = func(conn io.ReadWriteCloser) codec.Codec {
+		return unlimitedCodec{codec.NewGobCodec(conn)}
+	}
+}
+
+// TestMaxMessageSize_unsupported 测试配置了限制时拒绝不支持大小限制的编解码器
+func TestMaxMessageSize_unsupported(t *testing.T) {
+	t.Parallel()
+	addr := startTestServer(t).addr
+	_, err := Dial("tcp", addr, &Option{CodecType: unlimitedType, MaxReplySize: 1000})
+	_assert(errors.Is(err, codec.ErrSizeLimitUnsupported), "expect the client to refuse the codec, got %v", err)
+	client, err := Dial("tcp", addr, &Option{CodecType: unlimitedType})
+	_assert(err == nil, "dial failed: %v", err)
+	n, err := callSized(client, "Sized.Make", 10)
+	_assert(err == nil && n == 10, "expect the codec to work without limits: %d, %v", n, err)
+	_ = client.Close()
+
+	addr = startTestServer(t, WithMaxMessageSize(1000, 0)).addr
+	for _, opt := range []*Option{{CodecType: unlimitedType}, {CodecType: unlimitedType, Multiplex: true}} {
+		client, err = Dial("tcp", addr, opt)
+		_assert(err == nil, "dial failed: %v", err)
+		_, err = callSized(client, "Sized.Make", 10)
+		_assert(err != nil, "expect the server to refuse the codec, multiplex=%v", opt.Multiplex)
+		_ = client.Close()
+	}
+}
+
+func TestOption_MaxMessageSize(t *testing.T) {
+	t.Parallel()
+	addr := startTestServer(t).addr
+	opt := &Option{MaxRequestSize: 1000, MaxReplySize: 2000}
+	client, err := Dial("tcp", addr, opt)
+	_assert(err == nil, "dial failed: %v", err)
+	defer func() { _ = client.Close() }()
+
+	_, err = callSized(client, "Sized.Echo", Payload{Data: make([]byte, 4000)})
+	_assert(CodeOf(err) == ResourceExhausted, "expect ResourceExhausted before sending, got %v", err)
+	_, err = callSized(client, "Sized.Make", 4000)
+	_assert(CodeOf(err) == ResourceExhausted, "expect ResourceExhausted for big reply, got %v", err)
+	n, err := callSized(client, "Sized.Echo", Payload{Data: make([]byte, 500)})
+	_assert(err == nil && n == 500, "connection should survive: %d, %v", n, err)
+}
+
+func TestMaxMessageSize_compression(t *testing.T) {
+	t.Parallel()
+	// 压缩后很小的响应体解压后仍然受限制
+	addr := startTestServer(t).addr
+	client, err := Dial("tcp", addr, &Option{Compression: "gzip", MaxReplySize: 3000})
+	_assert(err == nil, "dial failed: %v", err)
+	defer func() { _ = client.Close() }()
+	var reply []byte
+	err = client.Call(context.Background(), "Repeat.Bytes", 1000, &reply)
+	_assert(CodeOf(err) == ResourceExhausted, "expect ResourceExhausted after decompression, got %v", err)
+	err = client.Call(context.Background(), "Repeat.Bytes", 200, &reply)
+	_assert(err == nil && len(reply) == 1400, "connection should survive: %d, %v", len(reply), err)
+
+	addr = startTestServer(t, WithMaxMessageSize(0, 2000)).addr
+	client2, err := Dial("tcp", addr, &Option{Compression: "gzip"})
+	_assert(err == nil, "dial failed: %v", err)
+	defer func() { _ = client2.Close() }()
+	err = client2.Call(context.Background(), "Repeat.Bytes", 1000, &reply)
+	_assert(CodeOf(err) == ResourceExhausted && strings.Contains(err.Error(), "exceeds the limit of 2000"), "expect reply size checked before compression, got %v", err)
+}
+
+// TestMaxMessageSize_typeDefinitions 测试不断发送类型定义的连接会被关闭, 而不是无限缓存
+func TestMaxMessageSize_typeDefinitions(t *testing.T) {
+	addr := startTestServer(t, WithMaxMessageSize(1000, 0)).addr
+	var first, second bytes.Buffer
+	enc := gob.NewEncoder(&first)
+	_ = enc.Encode(Payload{})
+	enc = gob.NewEncoder(&second)
+	_ = enc.Encode(Payload{})
+	second.Reset()
+	_ = enc.Encode(Payload{})
+	typedef := first.Bytes()[:first.Len()-second.Len()]
+
+	conn, err := net.Dial("tcp", addr)
+	_assert(err == nil, "dial failed: %v", err)
+	defer func() { _ = conn.Close() }()
+	_assert(json.NewEncoder(conn).Encode(DefaultOption) == nil, "write option failed")
+	go func() {
+		for i := 0; i < 100000; i++ {
+			if _, err := conn.Write(typedef); err != nil {
+				return
+			}
+		}
+	}()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	var ne net.Error
+	_assert(err != nil && !(errors.As(err, &ne) && ne.Timeout()), "expect the server to close the connection, got %v", err)
+}
@@ -0,0 +1,93 @@
+package GeeRPC
+
+import (
+	"GeeRPC/codec"
+	"errors"
+	"fmt"
+)
+
+// Code RPC错误码, 取值与gRPC一致
+type Code uint32
+
+const (
+	OK                 Code = 0
+	Canceled           Code = 1
+	Unknown            Code = 2
+	InvalidArgument    Code = 3
+	DeadlineExceeded   Code = 4
+	NotFound           Code = 5
+	AlreadyExists      Code = 6
+	PermissionDenied   Code = 7
+	ResourceExhausted  Code = 8
+	FailedPrecondition Code = 9
+	Aborted            Code = 10
+	OutOfRange         Code = 11
+	Unimplemented      Code = 12
+	Internal           Code = 13
+	Unavailable        Code = 14
+	DataLoss           Code = 15
+	Unauthenticated    Code = 16
+)
+
+var codeNames = [...]string{
+	"OK", "Canceled", "Unknown", "InvalidArgument", "DeadlineExceeded", "NotFound",
+	"AlreadyExists", "PermissionDenied", "ResourceExhausted", "FailedPrecondition",
+	"Aborted", "OutOfRange", "Unimplemented", "Internal", "Unavailable", "DataLoss",
+	"Unauthenticated",
+}
+
+func (c Code) String() string {
+	if int(c) < len(codeNames) {
+		return codeNames[c]
+	}
+	return fmt.Sprintf("Code(%d)", uint32(c))
+}
+
+// StatusError 带错误码的错误
+type StatusError struct {
+	Code    Code
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("rpc error: code = %s desc = %s", e.Code, e.Message)
+}
+
+// Errorf 创建带错误码的错误
+func Errorf(c Code, format string, a ...interface{}) error {
+	return &StatusError{Code: c, Message: fmt.Sprintf(format, a...)}
+}
+
+// CodeOf 返回err的错误码, nil返回OK, 不带错误码的错误返回Unknown
+func CodeOf(err error) Code {
+	if err == nil {
+		return OK
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Code
+	}
+	return Unknown
+}
+
+// setHeaderError 将err写入响应头, 带错误码的错误同时写入错误码
+func setHeaderError(h *codec.Header, err error) {
+	var se *StatusError
+	if !errors.As(err, &se) {
+		h.Error = err.Error()
+		return
+	}
+	h.Code = uint32(se.Code)
+	h.Error = se.Message
+	if h.Error == "" { // 空的Error表示调用成功
+		h.Error = se.Code.String()
+	}
+}
+
+// headerError 从响应头中还原错误
+func headerError(h *codec.Header) error {
+	if h.Code == uint32(OK) {
+		return errors.New(h.Error)
+	}
+	return &StatusError{Code: Code(h.Code), Message: h.Error}
+}
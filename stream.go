@@ -0,0 +1,328 @@
+package GeeRPC
+
+import (
+	"GeeRPC/codec"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// streamWindow 流的每个方向上未被接收方消费的最大消息数
+//
+// 发送方每发一条消息消耗一个额度, 额度用完后阻塞; 接收方每消费半个窗口就把额度归还给发送方,
+// 因此一个读得慢的流不会阻塞同一连接上的其他调用。
+const streamWindow = 16
+
+// Stream 流式调用中服务端一侧的流, 由GeeRPC创建, 通过 ServerStream 等类型传给服务方法
+type Stream struct {
+	ctx context.Context
+	// mu 保护ended, 并保证结束响应之后不再发送
+	mu sync.Mutex
+	// ended 服务方法已经返回, 不能再发送
+	ended bool
+	// write 以给定的标记向客户端发送一条消息
+	write func(flags uint32, body interface{}) error
+	// cancel 取消ctx, 并从连接的流式调用中移除
+	cancel func()
+	// credits 还可以发送的消息数
+	credits chan struct{}
+	// recvType 客户端消息的类型, 客户端不发送消息时为nil
+	recvType reflect.Type
+	// inbox 收到但服务方法尚未读取的消息, 客户端半关闭后被关闭
+	inbox chan reflect.Value
+	// recvClosed inbox已关闭, 只在连接的读循环中访问
+	recvClosed bool
+	// recvErr inbox因读取客户端的消息出错而关闭时, RecvMsg返回该错误而不是io.EOF
+	recvErr error
+	// consumed 服务方法读取后尚未归还额度的消息数
+	consumed int
+}
+
+var errStreamEnded = errors.New("rpc server: stream already ended")
+
+// newStream 为流式方法创建服务端一侧的流
+func (m *methodType) newStream() *Stream {
+	s := &Stream{credits: make(chan struct{}, streamWindow), recvType: m.RecvType}
+	for i := 0; i < streamWindow; i++ {
+		s.credits <- struct{}{}
+	}
+	if m.RecvType != nil {
+		s.inbox = make(chan reflect.Value, streamWindow)
+	}
+	return s
+}
+
+// Context 调用的ctx, 客户端取消或处理超时后被取消
+func (s *Stream) Context() context.Context {
+	return s.ctx
+}
+
+// SendMsg 向客户端发送一条消息, 客户端来不及接收时阻塞, 调用被取消后返回ctx的错误
+func (s *Stream) SendMsg(m interface{}) error {
+	select {
+	case <-s.credits:
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return errStreamEnded
+	}
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	err := s.write(codec.FlagStream, m)
+	if CodeOf(err) == ResourceExhausted { // 超限的消息没有发出, 额度仍然可用
+		s.grant(1)
+	}
+	return err
+}
+
+// RecvMsg 读取客户端的下一条消息到指针m, 客户端半关闭后返回io.EOF, 调用被取消后返回ctx的错误,
+// 客户端的消息超过大小限制时返回ResourceExhausted
+func (s *Stream) RecvMsg(m interface{}) error {
+	if s.inbox == nil {
+		return io.EOF
+	}
+	select {
+	case v, ok := <-s.inbox:
+		if !ok {
+			if s.recvErr != nil {
+				return s.recvErr
+			}
+			return io.EOF
+		}
+		reflect.ValueOf(m).Elem().Set(v)
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+	if s.consumed++; s.consumed < streamWindow/2 {
+		return nil
+	}
+	n := s.consumed
+	s.consumed = 0
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return nil
+	}
+	return s.write(codec.FlagWindow, uint32(n))
+}
+
+// end 服务方法返回后调用, 之后的SendMsg返回错误
+func (s *Stream) end() {
+	s.mu.Lock()
+	s.ended = true
+	s.mu.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
+// grant 客户端归还了n个发送额度
+func (s *Stream) grant(n int) {
+	for i := 0; i < n; i++ {
+		select {
+		case s.credits <- struct{}{}:
+		default: // 额度不会超过窗口, 多余的忽略
+			return
+		}
+	}
+}
+
+// deliver 把客户端的一条消息交给服务方法, 客户端超出窗口时返回false
+func (s *Stream) deliver(v reflect.Value) bool {
+	if s.recvClosed {
+		return true
+	}
+	select {
+	case s.inbox <- v:
+		return true
+	default:
+		return false
+	}
+}
+
+// closeRecv 客户端半关闭, 服务方法读完已收到的消息后得到io.EOF
+func (s *Stream) closeRecv() {
+	if s.inbox != nil && !s.recvClosed {
+		s.recvClosed = true
+		close(s.inbox)
+	}
+}
+
+// streamCalls 一个连接上进行中的流式调用, 用于把客户端的消息、额度和取消交给对应的流
+type streamCalls struct {
+	mu      sync.Mutex
+	streams map[uint64]*Stream
+}
+
+func newStreamCalls() *streamCalls {
+	return &streamCalls{streams: make(map[uint64]*Stream)}
+}
+
+// add 为流式请求创建可取消的ctx, 服务方法返回后自动移除
+func (c *streamCalls) add(req *request) {
+	ctx, cancel := context.WithCancel(req.ctx)
+	seq, s := req.h.Seq, req.stream
+	c.mu.Lock()
+	c.streams[seq] = s
+	c.mu.Unlock()
+	req.ctx = ctx
+	s.cancel = func() {
+		c.mu.Lock()
+		if c.streams[seq] == s {
+			delete(c.streams, seq)
+		}
+		c.mu.Unlock()
+		cancel()
+	}
+}
+
+func (c *streamCalls) get(seq uint64) *Stream {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.streams[seq]
+}
+
+// cancelAll 取消所有进行中的流式调用
+func (c *streamCalls) cancelAll() {
+	c.mu.Lock()
+	streams := make([]*Stream, 0, len(c.streams))
+	for _, s := range c.streams {
+		streams = append(streams, s)
+	}
+	c.mu.Unlock()
+	for _, s := range streams {
+		s.cancel()
+	}
+}
+
+// handle 处理客户端发来的流式消息、半关闭、额度和取消, 返回错误时连接无法继续读取
+func (c *streamCalls) handle(cc codec.Codec, h *codec.Header) error {
+	s := c.get(h.Seq)
+	switch {
+	case h.Flags&codec.FlagCancel != 0:
+		if s != nil {
+			s.cancel()
+		}
+		return cc.ReadBody(nil)
+	case h.Flags&codec.FlagWindow != 0:
+		var n uint32
+		if err := cc.ReadBody(&n); err != nil {
+			return err
+		}
+		if s != nil {
+			s.grant(int(n))
+		}
+		return nil
+	case h.Flags&codec.FlagEndStream != 0:
+		if s != nil {
+			s.closeRecv()
+		}
+		return cc.ReadBody(nil)
+	case s == nil || s.inbox == nil: // 调用已经结束
+		return cc.ReadBody(nil)
+	}
+	v := reflect.New(s.recvType)
+	if err := cc.ReadBody(v.Interface()); err != nil {
+		if !errors.Is(err, codec.ErrMessageTooLarge) {
+			return err
+		}
+		if !s.recvClosed { // 超限的消息已被跳过, 服务方法读完之前的消息后得到该错误
+			s.recvErr = sizeError(err)
+			s.closeRecv()
+		}
+		return nil
+	}
+	if !s.deliver(v.Elem()) { // 客户端不遵守流控, 结束该调用
+		s.cancel()
+	}
+	return nil
+}
+
+// ServerStream 服务端流式方法的参数, 方法的签名为
+//
+//	func (t *T) MethodName(argType T1, stream GeeRPC.ServerStream[T2]) error
+//
+// 方法通过Send发送任意多条T2, 返回后客户端以io.EOF(或返回的错误)结束接收。
+type ServerStream[R any] struct {
+	*Stream
+}
+
+// Send 向客户端发送一条消息
+func (s ServerStream[R]) Send(r R) error {
+	return s.SendMsg(r)
+}
+
+// RecvStream 客户端流式方法的参数, 方法的签名为
+//
+//	func (t *T) MethodName(stream GeeRPC.RecvStream[T1], replyType *T2) error
+//
+// 方法通过Recv读取客户端发送的T1直到io.EOF, 返回后replyType作为唯一的响应发给客户端。
+type RecvStream[A any] struct {
+	*Stream
+}
+
+// Recv 读取客户端的下一条消息, 客户端半关闭后返回io.EOF
+func (s RecvStream[A]) Recv() (A, error) {
+	var a A
+	err := s.RecvMsg(&a)
+	return a, err
+}
+
+// BidiStream 双向流式方法的参数, 方法的签名为
+//
+//	func (t *T) MethodName(stream GeeRPC.BidiStream[T1, T2]) error
+//
+// 方法可以交替地Recv客户端的T1、Send T2, 两个方向各自独立地流控和结束。
+type BidiStream[A, R any] struct {
+	*Stream
+}
+
+// Recv 读取客户端的下一条消息, 客户端半关闭后返回io.EOF
+func (s BidiStream[A, R]) Recv() (A, error) {
+	var a A
+	err := s.RecvMsg(&a)
+	return a, err
+}
+
+// Send 向客户端发送一条消息
+func (s BidiStream[A, R]) Send(r R) error {
+	return s.SendMsg(r)
+}
+
+var typeOfStream = reflect.TypeOf((*Stream)(nil))
+
+// streamTypes 判断t是否为ServerStream等流类型, 返回其Send的参数类型和Recv的返回值类型, 没有对应方法时为nil
+func streamTypes(t reflect.Type) (send, recv reflect.Type, ok bool) {
+	if t.Kind() != reflect.Struct || t.NumField() != 1 || !t.Field(0).Anonymous || t.Field(0).Type != typeOfStream {
+		return nil, nil, false
+	}
+	if m, ok := t.MethodByName("Send"); ok && m.Type.NumIn() == 2 {
+		send = m.Type.In(1)
+	}
+	if m, ok := t.MethodByName("Recv"); ok && m.Type.NumIn() == 1 && m.Type.NumOut() == 2 {
+		recv = m.Type.Out(0)
+	}
+	return send, recv, send != nil || recv != nil
+}
+
+// newStreamv 创建传给服务方法的流参数
+func (m *methodType) newStreamv(s *Stream) reflect.Value {
+	t := m.ReplyType // 服务端流的流在第2个参数
+	if m.stream != streamServer {
+		t = m.ArgType
+	}
+	v := reflect.New(t).Elem()
+	v.Field(0).Set(reflect.ValueOf(s))
+	return v
+}
+
+// isStreamMsg 判断h是否为流式调用中间的消息
+func isStreamMsg(h *codec.Header) bool {
+	return h.Flags&codec.FlagStream != 0 && h.Flags&codec.FlagEndStream == 0
+}
@@ -0,0 +1,224 @@
+package GeeRPC
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Counter 服务端流式方法
+type Counter int
+
+// Count 依次发送1到n, n为负数时返回错误
+func (c Counter) Count(n int, stream ServerStream[int]) error {
+	if n < 0 {
+		return Errorf(InvalidArgument, "negative count %d", n)
+	}
+	for i := 1; i <= n; i++ {
+		if err := stream.Send(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Forever 一直发送直到调用被取消
+func (c Counter) Forever(start int, stream ServerStream[int]) error {
+	for i := start; ; i++ {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		default:
+		}
+		if err := stream.Send(i); err != nil {
+			return err
+		}
+	}
+}
+
+// Sum 累加客户端发送的所有数
+func (c Counter) Sum(stream RecvStream[int], total *int) error {
+	for {
+		n, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		*total += n
+	}
+}
+
+// Echo 原样返回客户端发送的每条消息, 收到"stop"时提前结束
+func (c Counter) Echo(ctx context.Context, stream BidiStream[string, string]) error {
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg == "stop" {
+			return Errorf(Aborted, "stopped by client")
+		}
+		if err = stream.Send(msg); err != nil {
+			return err
+		}
+	}
+}
+
+func TestNewService_stream(t *testing.T) {
+	s := newService(new(Counter))
+	mType := s.method["Count"]
+	_assert(mType != nil && mType.stream == streamServer, "expect Count to be a server-streaming method")
+	_assert(mType.SendType.Kind() == reflect.Int, "expect int messages, got %v", mType.SendType)
+	mType = s.method["Sum"]
+	_assert(mType != nil && mType.stream == streamClient && mType.RecvType.Kind() == reflect.Int, "expect Sum to be a client-streaming method")
+	mType = s.method["Echo"]
+	_assert(mType != nil && mType.stream == streamBidi && mType.RecvType.Kind() == reflect.String && mType.SendType.Kind() == reflect.String,
+		"expect Echo to be a bidirectional streaming method")
+}
+
+func testServerStream(t *testing.T, opt *Option) {
+	client := startTestServer(t).dial(opt)
+	ctx := context.Background()
+
+	stream, err := NewStreamReader[int](ctx, client, "Counter.Count", 100)
+	_assert(err == nil, "open stream failed: %v", err)
+	for i := 1; i <= 100; i++ {
+		n, err := stream.Recv()
+		_assert(err == nil && n == i, "expect %d, got %d, %v", i, n, err)
+	}
+	_, err = stream.Recv()
+	_assert(err == io.EOF, "expect io.EOF at the end of the stream, got %v", err)
+
+	// 方法返回的错误在消息之后到达
+	stream, err = NewStreamReader[int](ctx, client, "Counter.Count", -1)
+	_assert(err == nil, "open stream failed: %v", err)
+	_, err = stream.Recv()
+	_assert(CodeOf(err) == InvalidArgument, "expect InvalidArgument, got %v", err)
+
+	// 取消后Recv结束, 同一连接上的其他调用不受影响
+	ctx2, cancel := context.WithCancel(ctx)
+	forever, err := NewStreamReader[int](ctx2, client, "Counter.Forever", 0)
+	_assert(err == nil, "open stream failed: %v", err)
+	n, err := forever.Recv()
+	_assert(err == nil && n == 0, "expect 0, got %d, %v", n, err)
+	cancel()
+	deadline := time.After(5 * time.Second)
+	for err == nil {
+		select {
+		case <-deadline:
+			t.Fatal("stream did not end after cancel")
+		default:
+		}
+		_, err = forever.Recv()
+	}
+	_assert(errors.Is(err, ErrCanceled), "expect ErrCanceled, got %v", err)
+	var sum int
+	err = client.Call(ctx, "Foo.Missing", Args{Num1: 1, Num2: 2}, &sum)
+	_assert(err != nil, "expect an error for an unknown method")
+	stream, err = NewStreamReader[int](ctx, client, "Counter.Count", 3)
+	_assert(err == nil, "open stream failed: %v", err)
+	defer stream.Close()
+	n, err = stream.Recv()
+	_assert(err == nil && n == 1, "expect 1 after a canceled stream, got %d, %v", n, err)
+}
+
+func TestServerStream(t *testing.T) {
+	t.Parallel()
+	testServerStream(t, nil)
+}
+
+func TestServerStream_multiplex(t *testing.T) {
+	t.Parallel()
+	testServerStream(t, &Option{Multiplex: true})
+}
+
+func testClientStream(t *testing.T, opt *Option) {
+	client := startTestServer(t).dial(opt)
+	ctx := context.Background()
+
+	// 消息数超过窗口, 发送方需要等待额度
+	w, err := NewStreamWriter[int, int](ctx, client, "Counter.Sum")
+	_assert(err == nil, "open stream failed: %v", err)
+	for i := 1; i <= 100; i++ {
+		_assert(w.Send(i) == nil, "send %d failed", i)
+	}
+	total, err := w.CloseAndRecv()
+	_assert(err == nil && total == 5050, "expect 5050, got %d, %v", total, err)
+
+	// 半关闭后仍能读完服务端的消息
+	b, err := NewBidiClient[string, string](ctx, client, "Counter.Echo")
+	_assert(err == nil, "open stream failed: %v", err)
+	for _, msg := range []string{"a", "b", "c"} {
+		_assert(b.Send(msg) == nil, "send %s failed", msg)
+	}
+	_assert(b.CloseSend() == nil, "close send failed")
+	for _, want := range []string{"a", "b", "c"} {
+		got, err := b.Recv()
+		_assert(err == nil && got == want, "expect %s, got %s, %v", want, got, err)
+	}
+	_, err = b.Recv()
+	_assert(err == io.EOF, "expect io.EOF after half-close, got %v", err)
+
+	// 双向同时进行, 消息数超过两个方向的窗口
+	b, err = NewBidiClient[string, string](ctx, client, "Counter.Echo")
+	_assert(err == nil, "open stream failed: %v", err)
+	go func() {
+		for i := 0; i < 100; i++ {
+			_ = b.Send(strconv.Itoa(i))
+		}
+		_ = b.Send("stop")
+	}()
+	for i := 0; i < 100; i++ {
+		got, err := b.Recv()
+		_assert(err == nil && got == strconv.Itoa(i), "expect %d, got %s, %v", i, got, err)
+	}
+	_, err = b.Recv()
+	_assert(CodeOf(err) == Aborted, "expect Aborted, got %v", err)
+
+	// 服务端结束后Send返回io.EOF
+	_assert(b.Send("late") == io.EOF, "expect io.EOF when sending on an ended stream")
+}
+
+func TestClientStream(t *testing.T) {
+	t.Parallel()
+	testClientStream(t, nil)
+}
+
+func TestClientStream_multiplex(t *testing.T) {
+	t.Parallel()
+	testClientStream(t, &Option{Multiplex: true})
+}
+
+func TestStream_flowControl(t *testing.T) {
+	t.Parallel()
+	client := startTestServer(t).dial()
+	ctx := context.Background()
+
+	// 不读取的流只占用自己的窗口, 不影响同一连接上的其他调用
+	idle, err := NewStreamReader[int](ctx, client, "Counter.Forever", 0)
+	_assert(err == nil, "open stream failed: %v", err)
+	defer idle.Close()
+	time.Sleep(50 * time.Millisecond)
+	var sum int
+	err = client.Call(ctx, "Foo.Sum", Args{Num1: 1, Num2: 2}, &sum)
+	_assert(err == nil && sum == 3, "expect 3 while another stream is idle, got %d, %v", sum, err)
+
+	// 取消写到一半的客户端流, 服务端的Recv随之结束
+	w, err := NewStreamWriter[int, int](ctx, client, "Counter.Sum")
+	_assert(err == nil, "open stream failed: %v", err)
+	_assert(w.Send(1) == nil, "send failed")
+	w.Close()
+	_, err = w.CloseAndRecv()
+	_assert(errors.Is(err, ErrCanceled), "expect ErrCanceled, got %v", err)
+	err = client.Call(ctx, "Foo.Sum", Args{Num1: 2, Num2: 2}, &sum)
+	_assert(err == nil && sum == 4, "expect 4 after a canceled stream, got %d, %v", sum, err)
+}
@@ -0,0 +1,56 @@
+package GeeRPC
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"time"
+)
+
+// tlsHandshakeTimeout 服务端等待TLS握手完成的时间
+const tlsHandshakeTimeout = 10 * time.Second
+
+// WithTLS Accept接收的连接使用TLS
+//
+// config.ClientAuth 为 tls.RequireAndVerifyClientCert 时即为双向TLS,
+// 经过验证的客户端证书标识可以通过 PeerFromContext 获取。
+func WithTLS(config *tls.Config) ServerOption {
+	return func(server *Server) {
+		server.tlsConfig = config
+	}
+}
+
+// MutualTLSConfig 返回双向TLS的服务端配置, 客户端证书必须由clientCAs签发
+func MutualTLSConfig(cert tls.Certificate, clientCAs *x509.CertPool) *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+// newTLSClientFunc 返回先完成TLS握手再创建Client的newClientFunc
+func newTLSClientFunc(address string, config *tls.Config) newClientFunc {
+	if config == nil {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" { // 默认使用地址中的主机名校验服务端证书
+		config = config.Clone()
+		if host, _, err := net.SplitHostPort(address); err == nil {
+			config.ServerName = host
+		}
+	}
+	return func(conn net.Conn, opt *Option) (*Client, error) {
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.Handshake(); err != nil {
+			return nil, err
+		}
+		return NewClient(tlsConn, opt)
+	}
+}
+
+// DialTLS 通过TLS连接服务端, config为nil时使用系统根证书校验服务端
+func DialTLS(network, address string, config *tls.Config, opts ...*Option) (*Client, error) {
+	return dialTimeout(newTLSClientFunc(address, config), network, address, opts...)
+}
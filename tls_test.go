@@ -0,0 +1,120 @@
+package GeeRPC
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// testCA 测试用的内存CA
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA() *testCA {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "GeeRPC Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue 签发证书, 服务端证书对127.0.0.1有效
+func (ca *testCA) issue(commonName string, usage x509.ExtKeyUsage) tls.Certificate {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// Whoami 返回调用方的证书标识
+type Whoami int
+
+func (w Whoami) Name(ctx context.Context, arg int, reply *string) error {
+	if p, ok := PeerFromContext(ctx); ok {
+		*reply = p.Identity
+	}
+	return nil
+}
+
+func TestTLS_mutual(t *testing.T) {
+	t.Parallel()
+	ca := newTestCA()
+	var intercepted string
+	server := NewServer(
+		WithTLS(MutualTLSConfig(ca.issue("server", x509.ExtKeyUsageServerAuth), ca.pool)),
+		WithInterceptor(func(ctx context.Context, info *ServerInfo, next Handler) error {
+			p, _ := PeerFromContext(ctx)
+			intercepted = p.Identity
+			return next(ctx)
+		}),
+	)
+	var w Whoami
+	_ = server.Register(&w)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer func() { _ = l.Close() }()
+	go server.Accept(l)
+
+	clientConfig := &tls.Config{
+		RootCAs:      ca.pool,
+		Certificates: []tls.Certificate{ca.issue("alice", x509.ExtKeyUsageClientAuth)},
+	}
+	t.Run("DialTLS", func(t *testing.T) {
+		client, err := DialTLS("tcp", l.Addr().String(), clientConfig)
+		_assert(err == nil, "dial failed: %v", err)
+		defer func() { _ = client.Close() }()
+		var name string
+		err = client.Call(context.Background(), "Whoami.Name", 0, &name)
+		_assert(err == nil && name == "alice", "expect peer identity alice, got %q %v", name, err)
+		_assert(intercepted == "alice", "expect interceptor to see alice, got %q", intercepted)
+	})
+	t.Run("XDial", func(t *testing.T) {
+		client, err := XDial("tls@"+l.Addr().String(), &Option{TLSConfig: clientConfig})
+		_assert(err == nil, "dial failed: %v", err)
+		defer func() { _ = client.Close() }()
+		var name string
+		err = client.Call(context.Background(), "Whoami.Name", 0, &name)
+		_assert(err == nil && name == "alice", "expect peer identity alice, got %q %v", name, err)
+	})
+	t.Run("no client certificate", func(t *testing.T) {
+		client, err := DialTLS("tcp", l.Addr().String(), &tls.Config{RootCAs: ca.pool})
+		if err == nil { // TLS 1.3 中客户端证书在握手完成后才被服务端拒绝
+			var name string
+			err = client.Call(context.Background(), "Whoami.Name", 0, &name)
+			_ = client.Close()
+		}
+		_assert(err != nil, "expect the server to reject a client without certificate")
+	})
+	t.Run("untrusted server", func(t *testing.T) {
+		_, err := DialTLS("tcp", l.Addr().String(), &tls.Config{RootCAs: newTestCA().pool})
+		_assert(err != nil, "expect an untrusted server certificate to fail")
+	})
+}
@@ -0,0 +1,286 @@
+package GeeRPC
+
+import (
+	"GeeRPC/codec"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TraceparentKey 元数据中W3C Trace Context的键
+const TraceparentKey = "traceparent"
+
+// TraceID 16字节的追踪标识, 与W3C Trace Context和OpenTelemetry一致
+type TraceID [16]byte
+
+// SpanID 8字节的span标识
+type SpanID [8]byte
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+func (id SpanID) String() string  { return hex.EncodeToString(id[:]) }
+
+// SpanContext 跨进程传播的span标识
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	// Sampled 为false时只传播, 不导出
+	Sampled bool
+}
+
+// IsValid TraceID和SpanID都不为全零
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Traceparent 按W3C Trace Context格式编码, 如 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent 解析W3C traceparent, 格式不正确或标识为全零时返回错误
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(s, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 ||
+		(parts[0] == "00" && len(parts) != 4) {
+		return sc, fmt.Errorf("rpc: invalid traceparent %q", s)
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, fmt.Errorf("rpc: invalid traceparent %q", s)
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, fmt.Errorf("rpc: invalid traceparent %q", s)
+	}
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return sc, fmt.Errorf("rpc: invalid traceparent %q", s)
+	}
+	if !sc.IsValid() {
+		return sc, fmt.Errorf("rpc: invalid traceparent %q", s)
+	}
+	sc.Sampled = flags[0]&1 != 0
+	return sc, nil
+}
+
+// SpanKind span所在的一侧
+type SpanKind int
+
+const (
+	SpanKindClient SpanKind = iota + 1
+	SpanKindServer
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case SpanKindClient:
+		return "client"
+	case SpanKindServer:
+		return "server"
+	}
+	return "unspecified"
+}
+
+// Span 一次调用在客户端或服务端的记录, 结束后交给 SpanExporter
+//
+// 属性名参考OpenTelemetry的RPC语义约定, 如 rpc.service、rpc.method、network.peer.address。
+type Span struct {
+	SpanContext
+	// Parent 父span, 没有时为零值
+	Parent SpanID
+	// Name 服务方法, 如 "Foo.Sum"
+	Name  string
+	Kind  SpanKind
+	Start time.Time
+	End   time.Time
+	// Attributes 调用的属性, 包括请求和响应的大小
+	Attributes map[string]string
+	// Code 调用的错误码, 成功时为OK
+	Code Code
+	// Message 调用失败时的错误信息
+	Message string
+}
+
+// SpanExporter 接收结束的span, 实现需要支持并发调用
+type SpanExporter interface {
+	ExportSpan(s *Span)
+}
+
+// Tracer 为调用创建span, 通过 WithTracer 和 Option.Tracer 分别用于服务端和客户端
+type Tracer struct {
+	exporter SpanExporter
+}
+
+// NewTracer 创建把span导出到exporter的Tracer
+func NewTracer(exporter SpanExporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+// WithTracer 为Server的每个调用创建服务端span, 父span来自请求元数据中的traceparent
+//
+// 服务方法的ctx携带该span, 在服务方法中用同一个ctx发起的调用成为它的子span。
+func WithTracer(t *Tracer) ServerOption {
+	return func(server *Server) {
+		server.tracer = t
+	}
+}
+
+type spanKey struct{}
+
+// ContextWithSpan 返回携带s的ctx, 用该ctx发起的调用成为s的子span
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+// SpanFromContext 返回ctx中的span, 不存在时返回nil
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// start 创建parent的子span, parent无效时开始新的追踪; t为nil时返回nil
+func (t *Tracer) start(parent SpanContext, kind SpanKind, serviceMethod string) *Span {
+	if t == nil {
+		return nil
+	}
+	s := &Span{Name: serviceMethod, Kind: kind, Start: time.Now(), Attributes: make(map[string]string)}
+	if parent.IsValid() {
+		s.TraceID, s.Parent, s.Sampled = parent.TraceID, parent.SpanID, parent.Sampled
+	} else {
+		_, _ = rand.Read(s.TraceID[:])
+		s.Sampled = true
+	}
+	_, _ = rand.Read(s.SpanID[:])
+	s.Attributes["rpc.system"] = "geerpc"
+	if dot := strings.LastIndex(serviceMethod, "."); dot >= 0 {
+		s.Attributes["rpc.service"], s.Attributes["rpc.method"] = serviceMethod[:dot], serviceMethod[dot+1:]
+	}
+	return s
+}
+
+// end 以err结束span并导出
+func (t *Tracer) end(s *Span, err error) {
+	s.End = time.Now()
+	s.Code = CodeOf(err)
+	if err != nil {
+		s.Message = err.Error()
+	}
+	if s.Sampled && t.exporter != nil {
+		t.exporter.ExportSpan(s)
+	}
+}
+
+// setSize 记录消息体在连接上的字节数, 只用于采样的span; n为0表示编解码器没有统计, 不记录
+func (s *Span) setSize(key string, n int64) {
+	if !s.Sampled || n <= 0 {
+		return
+	}
+	s.Attributes[key] = strconv.FormatInt(n, 10)
+}
+
+// readSize 返回cc最近一次读取的消息体的字节数, 编解码器没有实现 codec.BodySizer 时返回0
+func readSize(cc codec.Codec) int64 {
+	if s, ok := cc.(codec.BodySizer); ok {
+		return int64(s.ReadSize())
+	}
+	return 0
+}
+
+// writeSize 返回cc最近一次写入的消息体的字节数, 编解码器没有实现 codec.BodySizer 时返回0
+func writeSize(cc codec.Codec) int64 {
+	if s, ok := cc.(codec.BodySizer); ok {
+		return int64(s.WriteSize())
+	}
+	return 0
+}
+
+// InMemoryExporter 把span保存在内存中, 用于测试
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+// ExportSpan 实现 SpanExporter
+func (e *InMemoryExporter) ExportSpan(s *Span) {
+	e.mu.Lock()
+	e.spans = append(e.spans, s)
+	e.mu.Unlock()
+}
+
+// Spans 返回已导出的span, 按结束的先后排列
+func (e *InMemoryExporter) Spans() []*Span {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*Span(nil), e.spans...)
+}
+
+// Reset 清空已导出的span
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	e.spans = nil
+	e.mu.Unlock()
+}
+
+// startSpan 为调用创建客户端span并把traceparent放入请求元数据, 调用结束时由 Call.record 结束span
+//
+// 客户端没有配置Tracer时, ctx中的span仍然被传播, 追踪不会在这里中断。
+func (client *Client) startSpan(ctx context.Context, call *Call) {
+	var sc SpanContext
+	if parent := SpanFromContext(ctx); parent != nil {
+		sc = parent.SpanContext
+	}
+	tracer := client.opt.Tracer
+	if span := tracer.start(sc, SpanKindClient, call.ServiceMethod); span != nil {
+		sc = span.SpanContext
+		if client.remote != "" {
+			span.Attributes["network.peer.address"] = client.remote
+		}
+		observe := call.observe
+		call.observe = func(err error) {
+			span.setSize("rpc.request.size", atomic.LoadInt64(&call.sent))
+			if err == nil {
+				span.setSize("rpc.response.size", atomic.LoadInt64(&call.received))
+			}
+			tracer.end(span, err)
+			if observe != nil {
+				observe(err)
+			}
+		}
+	}
+	if sc.IsValid() {
+		call.Metadata = call.Metadata.merge(Metadata{TraceparentKey: sc.Traceparent()})
+	}
+}
+
+// startSpan 为请求创建服务端span并放入请求的ctx, 没有配置Tracer时返回nil
+func (server *Server) startSpan(req *request) *Span {
+	if server.tracer == nil {
+		return nil
+	}
+	parent, _ := ParseTraceparent(req.h.Metadata[TraceparentKey]) // 无效时开始新的追踪
+	span := server.tracer.start(parent, SpanKindServer, req.h.ServiceMethod)
+	if p, ok := PeerFromContext(req.ctx); ok && p.Addr != nil {
+		span.Attributes["network.peer.address"] = p.Addr.String()
+	}
+	span.setSize("rpc.request.size", req.argSize)
+	req.ctx = ContextWithSpan(req.ctx, span)
+	return span
+}
+
+// endSpan 以err结束服务端span
+func (server *Server) endSpan(span *Span, req *request, err error) {
+	if err == nil && (req.mtype.stream == streamNone || req.mtype.stream == streamClient) {
+		span.setSize("rpc.response.size", req.replySize)
+	}
+	server.tracer.end(span, err)
+}
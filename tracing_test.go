@@ -0,0 +1,118 @@
+package GeeRPC
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceparent(tp)
+	_assert(err == nil && sc.Sampled, "parse failed: %v", err)
+	_assert(sc.TraceID.String() == "4bf92f3577b34da6a3ce929d0e0e4736" && sc.SpanID.String() == "00f067aa0ba902b7", "unexpected ids %v", sc)
+	_assert(sc.Traceparent() == tp, "round trip failed: %s", sc.Traceparent())
+	for _, s := range []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-xyf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		_, err := ParseTraceparent(s)
+		_assert(err != nil, "expect error for %q", s)
+	}
+}
+
+// waitSpans 等待exp中至少有n个span, 服务端的span在响应发出后才结束
+func waitSpans(exp *InMemoryExporter, n int) []*Span {
+	deadline := time.Now().Add(time.Second)
+	for len(exp.Spans()) < n && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	return exp.Spans()
+}
+
+// spanOf 返回spans中kind一侧的span
+func spanOf(spans []*Span, kind SpanKind) *Span {
+	for _, s := range spans {
+		if s.Kind == kind {
+			return s
+		}
+	}
+	return nil
+}
+
+func TestTracer(t *testing.T) {
+	t.Parallel()
+	exp := new(InMemoryExporter)
+	tracer := NewTracer(exp)
+	server := NewServer(WithTracer(tracer))
+	_ = server.Register(new(Foo))
+	_ = server.Register(new(Failing))
+	l, _ := net.Listen("tcp", ":0")
+	defer func() { _ = l.Close() }()
+	go server.Accept(l)
+	client, err := Dial("tcp", l.Addr().String(), &Option{Tracer: tracer})
+	_assert(err == nil, "dial failed: %v", err)
+	defer func() { _ = client.Close() }()
+
+	parent, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := ContextWithSpan(context.Background(), &Span{SpanContext: parent})
+	var reply int
+	_assert(client.Call(ctx, "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply) == nil && reply == 3, "Foo.Sum failed")
+	spans := waitSpans(exp, 2)
+	_assert(len(spans) == 2, "expect 2 spans, got %d", len(spans))
+	cs, ss := spanOf(spans, SpanKindClient), spanOf(spans, SpanKindServer)
+	_assert(cs != nil && ss != nil, "expect a client and a server span")
+	_assert(cs.TraceID == parent.TraceID && ss.TraceID == parent.TraceID, "spans should join the parent trace")
+	_assert(cs.Parent == parent.SpanID && ss.Parent == cs.SpanID, "unexpected span tree")
+	_assert(cs.Name == "Foo.Sum" && ss.Attributes["rpc.service"] == "Foo" && ss.Attributes["rpc.method"] == "Sum", "unexpected names: %s %v", cs.Name, ss.Attributes)
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	_assert(strings.HasSuffix(cs.Attributes["network.peer.address"], ":"+port), "unexpected client peer %q", cs.Attributes["network.peer.address"])
+	_assert(ss.Attributes["network.peer.address"] != "", "expect server peer address")
+	_assert(cs.Attributes["rpc.request.size"] != "" && ss.Attributes["rpc.response.size"] != "", "expect sizes: %v %v", cs.Attributes, ss.Attributes)
+	_assert(cs.Attributes["rpc.request.size"] == ss.Attributes["rpc.request.size"] && cs.Attributes["rpc.response.size"] == ss.Attributes["rpc.response.size"],
+		"expect both sides to count the same bytes: %v %v", cs.Attributes, ss.Attributes)
+	_assert(cs.Code == OK && ss.Code == OK && !ss.End.Before(ss.Start), "unexpected status")
+
+	// 没有父span时开始新的追踪, 错误码记录在两侧
+	exp.Reset()
+	_ = client.Call(context.Background(), "Failing.Fail", int(NotFound), &reply)
+	spans = waitSpans(exp, 2)
+	cs, ss = spanOf(spans, SpanKindClient), spanOf(spans, SpanKindServer)
+	_assert(cs != nil && ss != nil && cs.TraceID != parent.TraceID && ss.TraceID == cs.TraceID, "expect a new trace")
+	_assert(cs.Code == NotFound && ss.Code == NotFound && ss.Message != "", "expect NotFound, got %v %v", cs.Code, ss.Code)
+
+	// 未采样的追踪只传播, 不导出
+	exp.Reset()
+	parent.Sampled = false
+	ctx = ContextWithSpan(context.Background(), &Span{SpanContext: parent})
+	_assert(client.Call(ctx, "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply) == nil, "Foo.Sum failed")
+	time.Sleep(20 * time.Millisecond)
+	_assert(len(exp.Spans()) == 0, "unsampled spans should not be exported")
+}
+
+// TestTracer_propagate 客户端没有Tracer时仍然传播ctx中的span
+func TestTracer_propagate(t *testing.T) {
+	t.Parallel()
+	exp := new(InMemoryExporter)
+	server := NewServer(WithTracer(NewTracer(exp)))
+	_ = server.Register(new(Foo))
+	l, _ := net.Listen("tcp", ":0")
+	defer func() { _ = l.Close() }()
+	go server.Accept(l)
+	client, err := Dial("tcp", l.Addr().String())
+	_assert(err == nil, "dial failed: %v", err)
+	defer func() { _ = client.Close() }()
+
+	parent, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	var reply int
+	_ = client.Call(ContextWithSpan(context.Background(), &Span{SpanContext: parent}), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	spans := waitSpans(exp, 1)
+	_assert(len(spans) == 1 && spans[0].TraceID == parent.TraceID && spans[0].Parent == parent.SpanID, "expect server span under the ctx span")
+}
@@ -0,0 +1,178 @@
+package GeeRPC
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ListenUnix 在path上监听Unix域套接字, 并将套接字文件权限设置为perm
+//
+// path上残留的套接字文件(没有进程在监听)会被删除, 其他类型的文件会返回错误。
+// 套接字先在path所在目录下权限为0700的临时目录中创建, 设置权限后再移动到path,
+// 其他用户不会在设置权限之前连接到它。关闭监听器时删除path。
+func ListenUnix(path string, perm os.FileMode) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("rpc server: %s exists and is not a socket", path)
+		}
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("rpc server: %s is already in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".geerpc-")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	tmp := filepath.Join(dir, "sock")
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	l.SetUnlinkOnClose(false) // 套接字文件移动后由unixListener删除
+	if err = os.Chmod(tmp, perm); err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+	return &unixListener{UnixListener: l, addr: &net.UnixAddr{Name: path, Net: "unix"}, unlink: true}, nil
+}
+
+// unixListener ListenUnix 返回的监听器, 地址为移动后的路径
+type unixListener struct {
+	*net.UnixListener
+	addr   *net.UnixAddr
+	mu     sync.Mutex
+	unlink bool
+}
+
+func (l *unixListener) Addr() net.Addr { return l.addr }
+
+// SetUnlinkOnClose 设置关闭时是否删除套接字文件, 默认删除
+func (l *unixListener) SetUnlinkOnClose(unlink bool) {
+	l.mu.Lock()
+	l.unlink = unlink
+	l.mu.Unlock()
+}
+
+func (l *unixListener) Close() error {
+	err := l.UnixListener.Close()
+	l.mu.Lock()
+	unlink := l.unlink
+	l.unlink = false
+	l.mu.Unlock()
+	if unlink {
+		_ = os.Remove(l.addr.Name)
+	}
+	return err
+}
+
+// inprocListeners 进程内监听器, key为名称
+var (
+	inprocMu        sync.Mutex
+	inprocListeners = make(map[string]*inprocListener)
+)
+
+// inprocAddr 进程内连接的地址
+type inprocAddr string
+
+func (a inprocAddr) Network() string { return "inproc" }
+func (a inprocAddr) String() string  { return string(a) }
+
+// inprocConn 基于net.Pipe的进程内连接, 带有可读的地址
+type inprocConn struct {
+	net.Conn
+	local, remote net.Addr
+}
+
+func (c *inprocConn) LocalAddr() net.Addr  { return c.local }
+func (c *inprocConn) RemoteAddr() net.Addr { return c.remote }
+
+// inprocListener 进程内监听器, 不占用端口
+type inprocListener struct {
+	name   string
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+var errInprocClosed = errors.New("rpc: inproc listener closed")
+
+// ListenInproc 以name监听进程内连接, 客户端使用 XDial("inproc@name") 或 Dial("inproc", name) 连接
+func ListenInproc(name string) (net.Listener, error) {
+	inprocMu.Lock()
+	defer inprocMu.Unlock()
+	if _, ok := inprocListeners[name]; ok {
+		return nil, fmt.Errorf("rpc server: inproc name %q is already in use", name)
+	}
+	l := &inprocListener{name: name, conns: make(chan net.Conn), closed: make(chan struct{})}
+	inprocListeners[name] = l
+	return l, nil
+}
+
+func (l *inprocListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, errInprocClosed
+	}
+}
+
+func (l *inprocListener) Close() error {
+	l.once.Do(func() {
+		inprocMu.Lock()
+		delete(inprocListeners, l.name)
+		inprocMu.Unlock()
+		close(l.closed)
+	})
+	return nil
+}
+
+func (l *inprocListener) Addr() net.Addr {
+	return inprocAddr(l.name)
+}
+
+// dialInproc 连接名为name的进程内监听器
+func dialInproc(name string, timeout time.Duration) (net.Conn, error) {
+	inprocMu.Lock()
+	l, ok := inprocListeners[name]
+	inprocMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("rpc client: no inproc listener named %q", name)
+	}
+	var expired <-chan time.Time
+	if timeout > 0 {
+		expired = time.After(timeout)
+	}
+	client, server := net.Pipe()
+	addr := inprocAddr(name)
+	select {
+	case l.conns <- &inprocConn{Conn: server, local: addr, remote: inprocAddr("client")}:
+		return &inprocConn{Conn: client, local: inprocAddr("client"), remote: addr}, nil
+	case <-l.closed:
+	case <-expired:
+	}
+	_ = client.Close()
+	_ = server.Close()
+	return nil, fmt.Errorf("rpc client: inproc dial %q failed", name)
+}
+
+// dialConn 建立连接, 除net.Dial支持的网络外还支持 "inproc"
+func dialConn(network, address string, timeout time.Duration) (net.Conn, error) {
+	if network == "inproc" {
+		return dialInproc(address, timeout)
+	}
+	return net.DialTimeout(network, address, timeout)
+}
@@ -0,0 +1,65 @@
+package GeeRPC
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenUnix(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "geerpc.sock")
+	l, err := ListenUnix(path, 0600)
+	_assert(err == nil, "listen failed: %v", err)
+	fi, _ := os.Stat(path)
+	_assert(fi.Mode().Perm() == 0600, "expect socket permissions 0600, got %v", fi.Mode().Perm())
+	_, err = ListenUnix(path, 0600)
+	_assert(err != nil, "expect a socket in use to be refused")
+
+	server := NewServer()
+	var foo Foo
+	_ = server.Register(&foo)
+	go server.Accept(l)
+	client, err := XDial("unix@" + path)
+	_assert(err == nil, "dial failed: %v", err)
+	var sum int
+	err = client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &sum)
+	_assert(err == nil && sum == 3, "call over unix socket failed: %v", err)
+	_ = client.Close()
+	_assert(l.Addr().String() == path, "expect the listener address to be %s, got %s", path, l.Addr())
+	l.(interface{ SetUnlinkOnClose(bool) }).SetUnlinkOnClose(false) // 关闭后留下套接字文件
+	_ = l.Close()
+
+	// 残留的套接字文件被替换
+	l, err = ListenUnix(path, 0660)
+	_assert(err == nil, "expect a stale socket to be replaced: %v", err)
+	fi, _ = os.Stat(path)
+	_assert(fi.Mode().Perm() == 0660, "expect socket permissions 0660, got %v", fi.Mode().Perm())
+	_ = l.Close()
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	_assert(len(entries) == 0, "expect the socket and the temporary directory to be removed, got %v", entries)
+}
+
+func TestListenInproc(t *testing.T) {
+	t.Parallel()
+	l, err := ListenInproc("test-inproc")
+	_assert(err == nil, "listen failed: %v", err)
+	_, err = ListenInproc("test-inproc")
+	_assert(err != nil, "expect a duplicate name to be refused")
+
+	server := NewServer()
+	var foo Foo
+	_ = server.Register(&foo)
+	go server.Accept(l)
+	client, err := XDial("inproc@test-inproc")
+	_assert(err == nil, "dial failed: %v", err)
+	var sum int
+	err = client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &sum)
+	_assert(err == nil && sum == 3, "call over inproc failed: %v", err)
+	_ = client.Close()
+
+	_ = l.Close()
+	_, err = XDial("inproc@test-inproc")
+	_assert(err != nil, "expect dialing a closed listener to fail")
+}
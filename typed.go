@@ -0,0 +1,64 @@
+package GeeRPC
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Invoke 以类型化的参数和返回值调用serviceMethod, 等价于 client.Call(ctx, serviceMethod, req, &resp)
+//
+//	sum, err := GeeRPC.Invoke[Args, int](ctx, client, "Foo.Sum", Args{Num1: 1, Num2: 2})
+func Invoke[Req, Resp any](ctx context.Context, client *Client, serviceMethod string, req Req) (Resp, error) {
+	var resp Resp
+	err := client.Call(ctx, serviceMethod, req, &resp)
+	return resp, err
+}
+
+// RegisterFunc 把fn注册为server上的方法serviceMethod, 格式为 "Service.Method"
+//
+// fn不需要是某个类型的方法, 也不经过 registerMethods 的反射检查, 调用时直接执行而不使用反射调用。
+// 服务不存在时创建, 已存在时(包括通过 Register 注册的服务)向其中添加方法, 方法已存在时返回错误。
+// fn的ctx与带 context.Context 的服务方法相同, 携带元数据、对端信息和取消信号。
+func RegisterFunc[Req, Resp any](server *Server, serviceMethod string, fn func(ctx context.Context, req Req) (Resp, error)) error {
+	dot := strings.LastIndex(serviceMethod, ".")
+	if dot <= 0 || dot == len(serviceMethod)-1 {
+		return errors.New("rpc: service/method ill-formed: " + serviceMethod)
+	}
+	m := &methodType{
+		ArgType:     reflect.TypeOf((*Req)(nil)).Elem(),
+		ReplyType:   reflect.TypeOf((*Resp)(nil)),
+		withContext: true,
+		fn: func(ctx context.Context, argv, replyv reflect.Value) error {
+			req, _ := argv.Interface().(Req) // Req为接口类型时argv可能为nil
+			resp, err := fn(ctx, req)
+			*replyv.Interface().(*Resp) = resp
+			return err
+		},
+	}
+	return server.addMethod(serviceMethod[:dot], serviceMethod[dot+1:], m)
+}
+
+// addMethod 向服务svcName添加方法name, 服务不存在时创建
+//
+// 正在处理的请求可能持有旧的服务, 因此复制方法表后替换整个服务, 不修改已注册的服务。
+func (server *Server) addMethod(svcName, name string, m *methodType) error {
+	server.regMu.Lock()
+	defer server.regMu.Unlock()
+	s := &service{name: svcName, method: map[string]*methodType{name: m}}
+	if v, ok := server.serviceMap.Load(svcName); ok {
+		old := v.(*service)
+		if old.method[name] != nil {
+			return fmt.Errorf("rpc: method already defined: %s.%s", svcName, name)
+		}
+		s.typ, s.rcvr = old.typ, old.rcvr
+		for k, v := range old.method {
+			s.method[k] = v
+		}
+	}
+	server.serviceMap.Store(svcName, s)
+	server.log().Debug("rpc server: register", "method", svcName+"."+name)
+	return nil
+}
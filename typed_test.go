@@ -0,0 +1,112 @@
+package GeeRPC
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRegisterFunc(t *testing.T) {
+	t.Parallel()
+	ts := startTestServer(t)
+	server := ts.Server
+	mul := func(_ context.Context, args Args) (int, error) {
+		if args.Num1 < 0 {
+			return 0, Errorf(InvalidArgument, "negative %d", args.Num1)
+		}
+		return args.Num1 * args.Num2, nil
+	}
+	_assert(RegisterFunc(server, "Math.Mul", mul) == nil, "register Math.Mul failed")
+	_assert(RegisterFunc(server, "Math.Who", func(ctx context.Context, _ int) (string, error) {
+		return IncomingMetadata(ctx)["user"], nil
+	}) == nil, "register Math.Who failed")
+	_assert(RegisterFunc(server, "Math.Split", func(_ context.Context, args *Args) ([]int, error) {
+		return []int{args.Num1, args.Num2}, nil
+	}) == nil, "register Math.Split failed")
+	// 向通过Register注册的服务添加方法
+	_assert(RegisterFunc(server, "Foo.Double", func(_ context.Context, n int) (int, error) { return 2 * n, nil }) == nil, "register Foo.Double failed")
+
+	err := RegisterFunc(server, "Foo.Sum", mul)
+	_assert(err != nil && strings.Contains(err.Error(), "already defined"), "expect a duplicate method to be refused, got %v", err)
+	for _, name := range []string{"Mul", ".Mul", "Math."} {
+		err = RegisterFunc(server, name, mul)
+		_assert(err != nil && strings.Contains(err.Error(), "ill-formed"), "expect %q to be refused, got %v", name, err)
+	}
+	err = server.Register(new(Foo))
+	_assert(err != nil && strings.Contains(err.Error(), "already defined"), "expect Foo to stay registered, got %v", err)
+
+	client := ts.dial()
+	ctx := context.Background()
+
+	product, err := Invoke[Args, int](ctx, client, "Math.Mul", Args{Num1: 2, Num2: 3})
+	_assert(err == nil && product == 6, "expect 6, got %d, %v", product, err)
+	_, err = Invoke[Args, int](ctx, client, "Math.Mul", Args{Num1: -1})
+	_assert(CodeOf(err) == InvalidArgument && strings.Contains(err.Error(), "negative -1"), "expect InvalidArgument, got %v", err)
+	who, err := Invoke[int, string](WithMetadata(ctx, Metadata{"user": "alice"}), client, "Math.Who", 0)
+	_assert(err == nil && who == "alice", "expect alice, got %q, %v", who, err)
+	parts, err := Invoke[*Args, []int](ctx, client, "Math.Split", &Args{Num1: 4, Num2: 5})
+	_assert(err == nil && reflect.DeepEqual(parts, []int{4, 5}), "expect [4 5], got %v, %v", parts, err)
+	sum, err := Invoke[Args, int](ctx, client, "Foo.Sum", Args{Num1: 1, Num2: 2})
+	_assert(err == nil && sum == 3, "expect 3, got %d, %v", sum, err)
+	double, err := Invoke[int, int](ctx, client, "Foo.Double", 21)
+	_assert(err == nil && double == 42, "expect 42, got %d, %v", double, err)
+
+	var schema MethodSchema
+	err = client.Call(ctx, ReflectionService+".DescribeMethod", "Math.Mul", &schema)
+	_assert(err == nil && schema.Arg.Name == "GeeRPC.Args" && schema.Reply.Name == "*int", "unexpected schema %+v, %v", schema, err)
+	_, mtype, _ := server.findService("Math.Mul")
+	_assert(mtype.NumCalls() == 2, "expect 2 calls of Math.Mul, got %d", mtype.NumCalls())
+}
+
+// TestRegisterFunc_concurrent 注册方法时同一服务上的调用不受影响
+func TestRegisterFunc_concurrent(t *testing.T) {
+	t.Parallel()
+	ts := startTestServer(t)
+	server := ts.Server
+	_ = RegisterFunc(server, "Math.Add", func(_ context.Context, args Args) (int, error) { return args.Num1 + args.Num2, nil })
+	client := ts.dial()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			sum, err := Invoke[Args, int](context.Background(), client, "Math.Add", Args{Num1: i, Num2: 1})
+			_assert(err == nil && sum == i+1, "expect %d, got %d, %v", i+1, sum, err)
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			_ = RegisterFunc(server, "Math.Id"+strings.Repeat("X", i), func(_ context.Context, n int) (int, error) { return n, nil })
+		}(i)
+	}
+	wg.Wait()
+	svc, _, err := server.findService("Math.Add")
+	_assert(err == nil && len(svc.method) == 21, "expect 21 methods, got %d, %v", len(svc.method), err)
+}
+
+// BenchmarkService_call 通过反射调用服务方法
+func BenchmarkService_call(b *testing.B) {
+	s := newService(new(Foo))
+	benchmarkCall(b, s, s.method["Sum"])
+}
+
+// BenchmarkService_callFunc 直接调用 RegisterFunc 注册的方法
+func BenchmarkService_callFunc(b *testing.B) {
+	server := NewServer()
+	_ = RegisterFunc(server, "Foo.Sum", func(_ context.Context, args Args) (int, error) { return args.Num1 + args.Num2, nil })
+	s, m, _ := server.findService("Foo.Sum")
+	benchmarkCall(b, s, m)
+}
+
+func benchmarkCall(b *testing.B, s *service, m *methodType) {
+	argv := m.newArgv()
+	argv.Set(reflect.ValueOf(Args{Num1: 1, Num2: 2}))
+	ctx := context.Background()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := s.call(ctx, m, argv, m.newReplyv()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
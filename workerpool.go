@@ -0,0 +1,148 @@
+package GeeRPC
+
+import "sync"
+
+// WorkerPool 工作池执行模式的配置
+//
+// 默认每个请求创建一个goroutine执行; 工作池模式下由固定数量的worker执行请求,
+// 等待执行的请求数有上限, 超出时以ResourceExhausted拒绝。
+// 每个连接有各自的队列(多路复用的连接上所有的流共用一个), worker在有请求的连接之间轮转,
+// 请求多的连接不会饿死其他连接。Server.StopWorkers 停止worker。
+type WorkerPool struct {
+	// Workers worker数量, 默认为1
+	Workers int
+	// QueueSize 整个Server等待执行的请求数上限, 默认为Workers的16倍
+	QueueSize int
+	// MaxQueuePerConn 单个连接等待执行的请求数上限, 默认为QueueSize
+	MaxQueuePerConn int
+}
+
+// WithWorkerPool 使用工作池执行请求
+//
+// 设置了HandleTimeout的连接, 每个请求仍会额外使用一个goroutine等待超时;
+// 超时的请求先返回错误, 但服务方法返回之前worker不会执行其他请求, 同时执行的服务方法不超过Workers。
+func WithWorkerPool(p WorkerPool) ServerOption {
+	return func(server *Server) {
+		server.pool = newWorkerPool(p)
+	}
+}
+
+// workerPool 实现WorkerPool
+type workerPool struct {
+	cfg  WorkerPool
+	mu   sync.Mutex
+	cond *sync.Cond
+	// ready 有请求等待执行的连接, worker按顺序轮转
+	ready []*connQueue
+	// queued 所有连接等待执行的请求数
+	queued int
+	// stopped 停止后不再接收请求, worker执行完已排队的请求后退出
+	stopped bool
+	// workers 等待worker退出
+	workers sync.WaitGroup
+}
+
+// connQueue 单个连接的请求队列
+type connQueue struct {
+	tasks []func()
+	// inReady 是否已在workerPool.ready中
+	inReady bool
+}
+
+func newWorkerPool(cfg WorkerPool) *workerPool {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = cfg.Workers * 16
+	}
+	if cfg.MaxQueuePerConn <= 0 || cfg.MaxQueuePerConn > cfg.QueueSize {
+		cfg.MaxQueuePerConn = cfg.QueueSize
+	}
+	p := &workerPool{cfg: cfg}
+	p.cond = sync.NewCond(&p.mu)
+	p.workers.Add(cfg.Workers)
+	for i := 0; i < cfg.Workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// stop 停止接收请求, 等待已排队的请求执行完和worker退出
+func (p *workerPool) stop() {
+	p.mu.Lock()
+	p.stopped = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+	p.workers.Wait()
+}
+
+// StopWorkers 停止 WithWorkerPool 启动的worker, 之后的请求以Unavailable拒绝
+//
+// 等待已排队的请求执行完后返回。没有使用工作池时什么也不做。
+func (server *Server) StopWorkers() {
+	if server.pool != nil {
+		server.pool.stop()
+	}
+}
+
+// newQueue 为一个连接创建请求队列
+func (p *workerPool) newQueue() *connQueue {
+	return &connQueue{}
+}
+
+// submit 将task加入q, 队列已满时返回ResourceExhausted
+func (p *workerPool) submit(q *connQueue, task func()) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped {
+		return Errorf(Unavailable, "rpc server: worker pool is stopped")
+	}
+	if p.queued >= p.cfg.QueueSize {
+		return Errorf(ResourceExhausted, "rpc server: worker pool queue is full (%d)", p.cfg.QueueSize)
+	}
+	if len(q.tasks) >= p.cfg.MaxQueuePerConn {
+		return Errorf(ResourceExhausted, "rpc server: too many queued requests on this connection (%d)", p.cfg.MaxQueuePerConn)
+	}
+	q.tasks = append(q.tasks, task)
+	p.queued++
+	if !q.inReady {
+		q.inReady = true
+		p.ready = append(p.ready, q)
+	}
+	p.cond.Signal()
+	return nil
+}
+
+// next 取出下一个要执行的task, 每次从不同的连接中取; 停止后没有task时返回nil
+func (p *workerPool) next() func() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.ready) == 0 {
+		if p.stopped {
+			return nil
+		}
+		p.cond.Wait()
+	}
+	q := p.ready[0]
+	p.ready[0] = nil
+	p.ready = p.ready[1:]
+	task := q.tasks[0]
+	q.tasks[0] = nil
+	q.tasks = q.tasks[1:]
+	if len(q.tasks) > 0 { // 还有请求, 排到队尾
+		p.ready = append(p.ready, q)
+	} else {
+		q.inReady = false
+	}
+	p.queued--
+	return task
+}
+
+// work worker的主循环
+func (p *workerPool) work() {
+	defer p.workers.Done()
+	for task := p.next(); task != nil; task = p.next() {
+		task()
+	}
+}
@@ -0,0 +1,168 @@
+package GeeRPC
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestWorkerPool_fairness 测试worker在连接之间轮转
+func TestWorkerPool_fairness(t *testing.T) {
+	p := newWorkerPool(WorkerPool{Workers: 1, QueueSize: 8})
+	block := make(chan struct{})
+	started := make(chan struct{})
+	a, b := p.newQueue(), p.newQueue()
+	_ = p.submit(a, func() { close(started); <-block }) // 占住唯一的worker
+	<-started
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	record := func(name string) func() {
+		wg.Add(1)
+		return func() {
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			wg.Done()
+		}
+	}
+	for i := 0; i < 3; i++ {
+		_assert(p.submit(a, record("a")) == nil, "submit failed")
+	}
+	_assert(p.submit(b, record("b")) == nil, "submit failed")
+	close(block)
+	wg.Wait()
+	_assert(len(order) == 4 && order[1] == "b", "expect b to run before a is drained, got %v", order)
+}
+
+// TestWorkerPool_bounded 测试队列已满时拒绝
+func TestWorkerPool_bounded(t *testing.T) {
+	p := newWorkerPool(WorkerPool{Workers: 1, QueueSize: 2, MaxQueuePerConn: 1})
+	block := make(chan struct{})
+	defer close(block)
+	started := make(chan struct{})
+	a, b, c := p.newQueue(), p.newQueue(), p.newQueue()
+	_ = p.submit(a, func() { close(started); <-block })
+	<-started
+
+	wait := func() { <-block }
+	_assert(p.submit(a, wait) == nil, "expect the first queued task to fit")
+	_assert(CodeOf(p.submit(a, wait)) == ResourceExhausted, "expect the per-connection cap")
+	_assert(p.submit(b, wait) == nil, "expect another connection to fit")
+	_assert(CodeOf(p.submit(c, wait)) == ResourceExhausted, "expect the server-wide cap")
+}
+
+// TestWorkerPool_stop 测试停止后worker执行完已排队的请求并退出, 之后的请求被拒绝
+func TestWorkerPool_stop(t *testing.T) {
+	p := newWorkerPool(WorkerPool{Workers: 2})
+	q := p.newQueue()
+	var ran int32
+	for i := 0; i < 4; i++ {
+		_ = p.submit(q, func() { atomic.AddInt32(&ran, 1) })
+	}
+	p.stop()
+	_assert(atomic.LoadInt32(&ran) == 4, "expect queued tasks to run before the workers exit, ran %d", ran)
+	_assert(CodeOf(p.submit(q, func() {})) == Unavailable, "expect Unavailable after stop")
+}
+
+// Busy 记录同时执行的调用数的最大值
+type Busy struct{ active, max int32 }
+
+func (b *Busy) Run(ms int, reply *int) error {
+	n := atomic.AddInt32(&b.active, 1)
+	for {
+		m := atomic.LoadInt32(&b.max)
+		if n <= m || atomic.CompareAndSwapInt32(&b.max, m, n) {
+			break
+		}
+	}
+	time.Sleep(time.Duration(ms) * time.Millisecond)
+	atomic.AddInt32(&b.active, -1)
+	return nil
+}
+
+// TestServer_workerPoolTimeout 测试请求超时后worker仍被占用, 同时执行的服务方法不超过Workers
+func TestServer_workerPoolTimeout(t *testing.T) {
+	t.Parallel()
+	ts := startTestServer(t, WithWorkerPool(WorkerPool{Workers: 1}))
+	busy := new(Busy)
+	_ = ts.Register(busy)
+	client := ts.dial(&Option{HandleTimeout: 20 * time.Millisecond})
+
+	calls := make([]*Call, 3)
+	for i := range calls {
+		calls[i] = client.Go("Busy.Run", 60, new(int), nil)
+	}
+	for _, call := range calls {
+		<-call.Done
+		_assert(CodeOf(call.Error) == DeadlineExceeded, "expect DeadlineExceeded, got %v", call.Error)
+	}
+	waitFor(func() bool { return atomic.LoadInt32(&busy.active) == 0 })
+	_assert(atomic.LoadInt32(&busy.max) == 1, "expect at most one execution with one worker, got %d", busy.max)
+	ts.StopWorkers()
+}
+
+// TestServer_workerPoolMultiplex 测试多路复用的连接上所有的流共用一个队列
+func TestServer_workerPoolMultiplex(t *testing.T) {
+	t.Parallel()
+	ts := startTestServer(t, WithWorkerPool(WorkerPool{Workers: 1, MaxQueuePerConn: 1}))
+	gate := &Gate{ch: make(chan struct{})}
+	_ = ts.Register(gate)
+	client := ts.dial(&Option{Multiplex: true})
+
+	var r int
+	blocked := client.Go("Gate.Wait", 1, &r, nil) // 占住唯一的worker
+	time.Sleep(50 * time.Millisecond)
+	queued := client.Go("Foo.Sum", Args{Num1: 1, Num2: 2}, new(int), nil)
+	time.Sleep(50 * time.Millisecond)
+	var sum int
+	err := client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &sum)
+	_assert(CodeOf(err) == ResourceExhausted, "expect the per-connection cap to cover all streams, got %v", err)
+	close(gate.ch)
+	<-blocked.Done
+	<-queued.Done
+	_assert(queued.Error == nil, "expect the queued call to succeed, got %v", queued.Error)
+}
+
+func TestServer_workerPool(t *testing.T) {
+	t.Parallel()
+	client := startTestServer(t, WithWorkerPool(WorkerPool{Workers: 2})).dial()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var sum int
+			err := client.Call(context.Background(), "Foo.Sum", Args{Num1: i, Num2: i}, &sum)
+			_assert(err == nil && sum == 2*i, "call failed: %v", err)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func benchmarkServer(b *testing.B, opts ...ServerOption) {
+	client := startTestServer(b, opts...).dial()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var sum int
+		for pb.Next() {
+			if err := client.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &sum); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkServer_goroutinePerRequest 每个请求一个goroutine
+func BenchmarkServer_goroutinePerRequest(b *testing.B) {
+	benchmarkServer(b)
+}
+
+// BenchmarkServer_workerPool 固定数量的worker执行请求
+func BenchmarkServer_workerPool(b *testing.B) {
+	benchmarkServer(b, WithWorkerPool(WorkerPool{Workers: 8, QueueSize: 1024}))
+}
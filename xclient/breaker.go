@@ -0,0 +1,289 @@
+package xclient
+
+import (
+	"GeeRPC"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// BreakerState 熔断器状态
+type BreakerState int
+
+const (
+	// StateClosed 关闭, 请求正常通过
+	StateClosed BreakerState = iota
+	// StateOpen 打开, 请求直接失败
+	StateOpen
+	// StateHalfOpen 半开, 放行少量探测请求
+	StateHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	default:
+		return "half-open"
+	}
+}
+
+// BreakerPolicy 熔断策略, 每个服务地址各自维护一个熔断器
+type BreakerPolicy struct {
+	// ConsecutiveFailures 连续失败次数达到该值时打开, 0表示不按连续失败打开
+	ConsecutiveFailures int
+	// ErrorRate 统计窗口内错误率达到该值(如0.5)时打开, 0表示不按错误率打开
+	ErrorRate float64
+	// MinRequests 按错误率判断前, 统计窗口内至少需要的请求数
+	MinRequests int
+	// Window 错误率的统计窗口, 默认10s
+	Window time.Duration
+	// OpenTimeout 打开多久后进入半开状态, 默认5s
+	OpenTimeout time.Duration
+	// HalfOpenRequests 半开状态下允许同时通过的探测请求数, 全部成功后关闭, 默认1
+	HalfOpenRequests int
+	// IsFailure 判断一次调用是否计为失败, 默认所有错误都计为失败
+	IsFailure func(err error) bool
+}
+
+// breaker 单个服务地址的熔断器
+type breaker struct {
+	policy BreakerPolicy
+	mu     sync.Mutex
+	state  BreakerState
+	// consecutive 连续失败次数
+	consecutive int
+	// windowStart 当前统计窗口的开始时间
+	windowStart time.Time
+	// requests, failures 当前统计窗口内的请求数和失败数
+	requests, failures int
+	// changed 最近一次状态变化的时间
+	changed time.Time
+	// probes 半开状态下已放行且未完成的探测请求数
+	probes int
+	// probeSuccesses 半开状态下成功的探测请求数
+	probeSuccesses int
+	// generation 每次状态变化加1, 之前的状态下放行的请求的结果不再计入
+	generation uint64
+}
+
+// admission 熔断器放行的一次请求, 结果通过done计入放行时的状态
+type admission struct {
+	b   *breaker
+	gen uint64
+}
+
+// done 记录请求的结果, 未开启熔断时什么也不做
+func (a admission) done(err error) {
+	if a.b != nil {
+		a.b.record(a.gen, err)
+	}
+}
+
+func newBreaker(p BreakerPolicy) *breaker {
+	now := time.Now()
+	return &breaker{policy: p, windowStart: now, changed: now}
+}
+
+// setState 切换状态并重置统计, 调用方持有锁
+func (b *breaker) setState(s BreakerState, now time.Time) {
+	b.state = s
+	b.changed = now
+	b.consecutive = 0
+	b.requests, b.failures = 0, 0
+	b.windowStart = now
+	b.probes, b.probeSuccesses = 0, 0
+	b.generation++
+}
+
+// currentState 返回当前状态, 打开超过OpenTimeout后进入半开, 调用方持有锁
+func (b *breaker) currentState(now time.Time) BreakerState {
+	if b.state == StateOpen && now.Sub(b.changed) >= b.policy.OpenTimeout {
+		b.setState(StateHalfOpen, now)
+	}
+	return b.state
+}
+
+// ready 判断是否可以放行请求, 不占用半开状态的探测名额
+func (b *breaker) ready() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.currentState(time.Now()) {
+	case StateOpen:
+		return false
+	case StateHalfOpen:
+		return b.probes < b.policy.HalfOpenRequests
+	default:
+		return true
+	}
+}
+
+// allow 放行一个请求, 半开状态下占用一个探测名额; 返回false时不能发出请求
+//
+// 请求结束后以返回的admission记录结果。
+func (b *breaker) allow() (admission, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.currentState(time.Now()) {
+	case StateOpen:
+		return admission{}, false
+	case StateHalfOpen:
+		if b.probes >= b.policy.HalfOpenRequests {
+			return admission{}, false
+		}
+		b.probes++
+	}
+	return admission{b: b, gen: b.generation}, true
+}
+
+// record 记录一次在状态gen下放行的请求的结果, 状态已经变化时忽略
+//
+// 例如关闭状态下放行的慢请求在半开状态下才成功, 它不是探测请求, 不能让熔断器关闭。
+func (b *breaker) record(gen uint64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if gen != b.generation {
+		return
+	}
+	if err == GeeRPC.ErrCanceled { // 被取消的请求不计入统计, 只归还探测名额
+		if b.state == StateHalfOpen && b.probes > 0 {
+			b.probes--
+		}
+		return
+	}
+	failed := err != nil && b.policy.IsFailure(err)
+	switch b.state {
+	case StateHalfOpen:
+		if failed {
+			b.setState(StateOpen, now)
+			return
+		}
+		if b.probes > 0 {
+			b.probes--
+		}
+		if b.probeSuccesses++; b.probeSuccesses >= b.policy.HalfOpenRequests {
+			b.setState(StateClosed, now)
+		}
+	case StateClosed:
+		if now.Sub(b.windowStart) >= b.policy.Window {
+			b.requests, b.failures = 0, 0
+			b.windowStart = now
+		}
+		b.requests++
+		if !failed {
+			b.consecutive = 0
+			return
+		}
+		b.failures++
+		b.consecutive++
+		p := b.policy
+		if (p.ConsecutiveFailures > 0 && b.consecutive >= p.ConsecutiveFailures) ||
+			(p.ErrorRate > 0 && b.requests >= p.MinRequests && float64(b.failures) >= p.ErrorRate*float64(b.requests)) {
+			b.setState(StateOpen, now)
+		}
+	}
+}
+
+// row 调试页面上的一行
+func (b *breaker) row(addr string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	return []string{
+		addr,
+		b.currentState(now).String(),
+		strconv.Itoa(b.consecutive),
+		fmt.Sprintf("%d/%d", b.failures, b.requests),
+		now.Sub(b.changed).Truncate(time.Millisecond).String(),
+	}
+}
+
+// SetBreakerPolicy 为每个服务地址开启熔断, p为nil时关闭
+//
+// 开启后负载均衡会跳过熔断器打开的地址, 所有地址都不可用时调用直接以Unavailable失败,
+// 各地址的熔断器状态展示在调试页面上。
+func (xc *XClient) SetBreakerPolicy(p *BreakerPolicy) {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	if p == nil {
+		xc.breakerPolicy = nil
+		xc.breakers = nil
+		GeeRPC.UnregisterDebugTable(xc)
+		return
+	}
+	policy := *p
+	if policy.Window <= 0 {
+		policy.Window = 10 * time.Second
+	}
+	if policy.OpenTimeout <= 0 {
+		policy.OpenTimeout = 5 * time.Second
+	}
+	if policy.HalfOpenRequests <= 0 {
+		policy.HalfOpenRequests = 1
+	}
+	if policy.IsFailure == nil {
+		policy.IsFailure = func(err error) bool { return true }
+	}
+	xc.breakerPolicy = &policy
+	xc.breakers = make(map[string]*breaker)
+	GeeRPC.RegisterDebugTable(xc)
+}
+
+// breaker 返回rpcAddr的熔断器, 未开启熔断时返回nil
+func (xc *XClient) breaker(rpcAddr string) *breaker {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	if xc.breakerPolicy == nil {
+		return nil
+	}
+	b, ok := xc.breakers[rpcAddr]
+	if !ok {
+		b = newBreaker(*xc.breakerPolicy)
+		xc.breakers[rpcAddr] = b
+	}
+	return b
+}
+
+// BreakerState 返回rpcAddr的熔断器状态, 未开启熔断时总是StateClosed
+func (xc *XClient) BreakerState(rpcAddr string) BreakerState {
+	b := xc.breaker(rpcAddr)
+	if b == nil {
+		return StateClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.currentState(time.Now())
+}
+
+// DebugTitle implements GeeRPC.DebugTable
+func (xc *XClient) DebugTitle() string {
+	return fmt.Sprintf("XClient %p circuit breakers", xc)
+}
+
+// DebugHeader implements GeeRPC.DebugTable
+func (xc *XClient) DebugHeader() []string {
+	return []string{"Address", "State", "Consecutive Failures", "Window Failures/Requests", "Since"}
+}
+
+// DebugRows implements GeeRPC.DebugTable
+func (xc *XClient) DebugRows() [][]string {
+	xc.mu.Lock()
+	addrs := make([]string, 0, len(xc.breakers))
+	breakers := make(map[string]*breaker, len(xc.breakers))
+	for addr, b := range xc.breakers {
+		addrs = append(addrs, addr)
+		breakers[addr] = b
+	}
+	xc.mu.Unlock()
+	sort.Strings(addrs)
+	rows := make([][]string, 0, len(addrs))
+	for _, addr := range addrs {
+		rows = append(rows, breakers[addr].row(addr))
+	}
+	return rows
+}
@@ -0,0 +1,119 @@
+package xclient
+
+import (
+	"GeeRPC"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestBreaker 测试熔断器的状态转换
+func TestBreaker(t *testing.T) {
+	b := newBreaker(BreakerPolicy{
+		ConsecutiveFailures: 3,
+		Window:              time.Minute,
+		OpenTimeout:         50 * time.Millisecond,
+		HalfOpenRequests:    1,
+		IsFailure:           func(error) bool { return true },
+	})
+	failure := errors.New("failure")
+	for i := 0; i < 3; i++ {
+		adm, ok := b.allow()
+		_assert(ok, "closed breaker should allow requests")
+		adm.done(failure)
+	}
+	_, ok := b.allow()
+	_assert(b.state == StateOpen && !ok, "expect open after 3 consecutive failures")
+
+	time.Sleep(60 * time.Millisecond)
+	probe, ok := b.allow()
+	_assert(ok, "expect a probe after OpenTimeout")
+	_, ok = b.allow()
+	_assert(b.state == StateHalfOpen && !ok, "expect a single probe in half-open state")
+	probe.done(failure)
+	_assert(b.state == StateOpen, "expect a failed probe to reopen the breaker")
+
+	time.Sleep(60 * time.Millisecond)
+	probe, ok = b.allow()
+	_assert(ok, "expect a probe after OpenTimeout")
+	probe.done(nil)
+	_assert(b.state == StateClosed, "expect a successful probe to close the breaker")
+}
+
+// TestBreaker_staleResult 测试之前的状态下放行的请求的结果不影响半开状态
+func TestBreaker_staleResult(t *testing.T) {
+	b := newBreaker(BreakerPolicy{
+		ConsecutiveFailures: 1,
+		Window:              time.Minute,
+		OpenTimeout:         20 * time.Millisecond,
+		HalfOpenRequests:    1,
+		IsFailure:           func(error) bool { return true },
+	})
+	slow, _ := b.allow()
+	failed, _ := b.allow()
+	failed.done(errors.New("failure"))
+	_assert(b.state == StateOpen, "expect open after a failure")
+
+	time.Sleep(30 * time.Millisecond)
+	probe, ok := b.allow()
+	_assert(ok && b.state == StateHalfOpen, "expect a probe after OpenTimeout")
+	slow.done(nil)
+	slow.done(GeeRPC.ErrCanceled)
+	_, ok = b.allow()
+	_assert(b.state == StateHalfOpen && !ok, "expect a stale success to neither close the breaker nor free the probe")
+	probe.done(nil)
+	_assert(b.state == StateClosed, "expect the probe to close the breaker")
+}
+
+// TestBreaker_errorRate 测试按错误率打开
+func TestBreaker_errorRate(t *testing.T) {
+	b := newBreaker(BreakerPolicy{
+		ErrorRate:   0.5,
+		MinRequests: 4,
+		Window:      time.Minute,
+		OpenTimeout: time.Minute,
+		IsFailure:   func(error) bool { return true },
+	})
+	failure := errors.New("failure")
+	for _, err := range []error{nil, failure, nil} {
+		adm, _ := b.allow()
+		adm.done(err)
+	}
+	_assert(b.state == StateClosed, "expect closed below MinRequests")
+	adm, _ := b.allow()
+	adm.done(failure)
+	_assert(b.state == StateOpen, "expect open at 50%% error rate")
+}
+
+// TestXClient_Breaker 测试负载均衡跳过熔断的实例, 全部熔断时以Unavailable快速失败
+func TestXClient_Breaker(t *testing.T) {
+	t.Parallel()
+	bad := &Replica{id: 1, failing: 1}
+	good := &Replica{id: 2}
+	badAddr, goodAddr := startTestServer(t, bad), startTestServer(t, good)
+	xc := NewXClient(NewMultiServerDiscovery([]string{badAddr, goodAddr}), RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetBreakerPolicy(&BreakerPolicy{ConsecutiveFailures: 2, OpenTimeout: time.Minute})
+
+	for i := 0; i < 10; i++ {
+		var reply int
+		_ = xc.Call(context.Background(), "Replica.Get", 0, &reply)
+	}
+	_assert(xc.BreakerState(badAddr) == StateOpen, "expect the failing replica to be open")
+	_assert(xc.BreakerState(goodAddr) == StateClosed, "expect the healthy replica to be closed")
+	_assert(atomic.LoadInt32(&bad.calls) == 2, "expect open endpoint to be skipped, got %d calls", bad.calls)
+
+	atomic.StoreInt32(&good.failing, 1)
+	for i := 0; i < 2; i++ {
+		var reply int
+		_ = xc.Call(context.Background(), "Replica.Get", 0, &reply)
+	}
+	var reply int
+	err := xc.Call(context.Background(), "Replica.Get", 0, &reply)
+	_assert(GeeRPC.CodeOf(err) == GeeRPC.Unavailable, "expect Unavailable, got %v", err)
+
+	rows := xc.DebugRows()
+	_assert(len(rows) == 2 && rows[0][1] == "open" && rows[1][1] == "open", "unexpected debug rows %v", rows)
+}
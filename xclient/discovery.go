@@ -0,0 +1,64 @@
+// Package xclient 支持负载均衡的客户端
+package xclient
+
+import (
+	"errors"
+	"sync"
+)
+
+// SelectMode 负载均衡策略
+type SelectMode int
+
+const (
+	// RandomSelect 随机选择
+	RandomSelect SelectMode = iota
+	// RoundRobinSelect 轮询选择
+	RoundRobinSelect
+)
+
+// Discovery 服务发现接口
+type Discovery interface {
+	// Refresh 从注册中心更新服务列表
+	Refresh() error
+	// Update 手动更新服务列表
+	Update(servers []string) error
+	// GetAll 返回所有的服务实例, 地址格式为 protocol@addr
+	GetAll() ([]string, error)
+}
+
+var errNoServers = errors.New("rpc discovery: no available servers")
+
+// MultiServersDiscovery 不需要注册中心, 由用户显式提供服务列表的服务发现
+type MultiServersDiscovery struct {
+	mu      sync.RWMutex
+	servers []string
+}
+
+var _ Discovery = (*MultiServersDiscovery)(nil)
+
+// NewMultiServerDiscovery 创建MultiServersDiscovery
+func NewMultiServerDiscovery(servers []string) *MultiServersDiscovery {
+	return &MultiServersDiscovery{servers: servers}
+}
+
+// Refresh 对MultiServersDiscovery没有意义
+func (d *MultiServersDiscovery) Refresh() error {
+	return nil
+}
+
+// Update 更新服务列表
+func (d *MultiServersDiscovery) Update(servers []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.servers = servers
+	return nil
+}
+
+// GetAll 返回服务列表的副本
+func (d *MultiServersDiscovery) GetAll() ([]string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	servers := make([]string, len(d.servers))
+	copy(servers, d.servers)
+	return servers, nil
+}
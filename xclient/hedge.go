@@ -0,0 +1,223 @@
+package xclient
+
+import (
+	"GeeRPC"
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HedgePolicy 对冲请求策略
+//
+// 首次请求在等待时间内没有返回时, 向另一个服务实例发出相同的请求,
+// 采用最先成功返回的结果, 并取消其余的请求。只适用于幂等的(如只读)方法。
+type HedgePolicy struct {
+	// Delay 首次请求发出后, 等待多久仍未返回时发出对冲请求
+	Delay time.Duration
+	// Percentile 大于0时(如0.95), 以该方法近期延迟的分位数作为等待时间, 样本不足时使用Delay
+	Percentile float64
+	// MaxHedges 每次调用最多额外发出的请求数, 默认为1
+	MaxHedges int
+	// MaxRatio 对冲请求数与调用总数之比的上限(如0.1表示额外负载不超过10%), 0表示不限制
+	MaxRatio float64
+}
+
+// HedgeStats 对冲请求的统计
+type HedgeStats struct {
+	// Requests 调用总数
+	Requests uint64
+	// Hedged 发出的对冲请求数
+	Hedged uint64
+	// Canceled 因其他请求先返回而被取消的请求数
+	Canceled uint64
+}
+
+const (
+	// latencySamples 计算分位数时保留的最近延迟样本数
+	latencySamples = 128
+	// minLatencySamples 使用分位数前至少需要的样本数
+	minLatencySamples = 16
+)
+
+// hedger 单个方法的对冲状态
+type hedger struct {
+	policy HedgePolicy
+	// mu 保护以下字段
+	mu sync.Mutex
+	// samples 最近成功调用的延迟, 环形缓冲区
+	samples []time.Duration
+	// next 下一个样本写入的位置
+	next  int
+	stats HedgeStats
+}
+
+func newHedger(p HedgePolicy) *hedger {
+	if p.MaxHedges <= 0 {
+		p.MaxHedges = 1
+	}
+	return &hedger{policy: p, samples: make([]time.Duration, 0, latencySamples)}
+}
+
+// delay 发出对冲请求前的等待时间
+func (h *hedger) delay() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.policy.Percentile <= 0 || len(h.samples) < minLatencySamples {
+		return h.policy.Delay
+	}
+	sorted := make([]time.Duration, len(h.samples))
+	copy(sorted, h.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := int(h.policy.Percentile * float64(len(sorted)))
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+// observe 记录一次成功调用的延迟
+func (h *hedger) observe(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.samples) < latencySamples {
+		h.samples = append(h.samples, d)
+		return
+	}
+	h.samples[h.next] = d
+	h.next = (h.next + 1) % latencySamples
+}
+
+// begin 记录一次调用
+func (h *hedger) begin() {
+	h.mu.Lock()
+	h.stats.Requests++
+	h.mu.Unlock()
+}
+
+// allowHedge 判断额外负载是否还在MaxRatio以内, 对冲请求发出后才由 hedged 计入
+func (h *hedger) allowHedge() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.policy.MaxRatio <= 0 || float64(h.stats.Hedged) < h.policy.MaxRatio*float64(h.stats.Requests)
+}
+
+// hedged 记录一次已发出的对冲请求
+func (h *hedger) hedged() {
+	h.mu.Lock()
+	h.stats.Hedged++
+	h.mu.Unlock()
+}
+
+func (h *hedger) canceled(n int) {
+	h.mu.Lock()
+	h.stats.Canceled += uint64(n)
+	h.mu.Unlock()
+}
+
+// SetHedgePolicy 为serviceMethod开启对冲请求, p为nil时关闭
+func (xc *XClient) SetHedgePolicy(serviceMethod string, p *HedgePolicy) {
+	if p == nil {
+		xc.hedges.Delete(serviceMethod)
+		return
+	}
+	xc.hedges.Store(serviceMethod, newHedger(*p))
+}
+
+// HedgeStats 返回serviceMethod的对冲统计, 未开启对冲时返回零值
+func (xc *XClient) HedgeStats(serviceMethod string) HedgeStats {
+	h, ok := xc.hedges.Load(serviceMethod)
+	if !ok {
+		return HedgeStats{}
+	}
+	hg := h.(*hedger)
+	hg.mu.Lock()
+	defer hg.mu.Unlock()
+	return hg.stats
+}
+
+// attempt 一次对冲调用中发往某个服务实例的请求
+type attempt struct {
+	adm    admission
+	client *GeeRPC.Client
+	call   *GeeRPC.Call
+	reply  reflect.Value
+	start  time.Time
+}
+
+// hedgedCall 基于 Client.Go 和 Call.Done 实现的对冲调用
+//
+// 每个请求使用独立的reply, 最先成功返回的结果被复制到reply中。
+func (xc *XClient) hedgedCall(ctx context.Context, h *hedger, serviceMethod string, args, reply interface{}) error {
+	replyType := reflect.TypeOf(reply)
+	if replyType == nil || replyType.Kind() != reflect.Ptr {
+		return errors.New("rpc xclient: hedged call needs a pointer reply")
+	}
+	h.begin()
+	done := make(chan *GeeRPC.Call, h.policy.MaxHedges+1) // 所有请求共用, 带缓冲保证不会阻塞接收响应的goroutine
+	attempts := make(map[*GeeRPC.Call]*attempt)
+	tried := make(map[string]bool)
+	launched := 0
+	launch := func() error {
+		rpcAddr, adm, err := xc.pick(tried) // 对冲请求发往另一个服务实例
+		if err != nil {
+			return err
+		}
+		tried[rpcAddr] = true
+		client, err := xc.dial(rpcAddr)
+		if err != nil {
+			adm.done(err)
+			return err
+		}
+		a := &attempt{adm: adm, client: client, reply: reflect.New(replyType.Elem()), start: time.Now()}
+		a.call = client.GoContext(ctx, serviceMethod, args, a.reply.Interface(), done)
+		attempts[a.call] = a
+		launched++
+		return nil
+	}
+	cancelAll := func() {
+		for _, a := range attempts {
+			a.client.Cancel(a.call)
+			a.adm.done(GeeRPC.ErrCanceled)
+		}
+		h.canceled(len(attempts))
+	}
+
+	if err := launch(); err != nil {
+		return err
+	}
+	timer := time.NewTimer(h.delay())
+	defer timer.Stop()
+	var lastErr error
+	for {
+		select {
+		case <-ctx.Done():
+			cancelAll()
+			return errors.New("rpc xclient: call failed: " + ctx.Err().Error())
+		case <-timer.C:
+			// 没有其他可用实例时launch失败, 不计入对冲请求, 继续等待已发出的请求
+			if launched <= h.policy.MaxHedges && h.allowHedge() && launch() == nil {
+				h.hedged()
+				if launched <= h.policy.MaxHedges {
+					timer.Reset(h.delay())
+				}
+			}
+		case call := <-done:
+			a := attempts[call]
+			delete(attempts, call)
+			a.adm.done(call.Error)
+			if call.Error == nil {
+				h.observe(time.Since(a.start))
+				cancelAll() // 取消落后的请求
+				reflect.ValueOf(reply).Elem().Set(a.reply.Elem())
+				return nil
+			}
+			lastErr = call.Error
+			if len(attempts) == 0 {
+				return lastErr
+			}
+		}
+	}
+}
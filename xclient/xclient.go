@@ -0,0 +1,160 @@
+package xclient
+
+import (
+	"GeeRPC"
+	"context"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// XClient 支持负载均衡的客户端, 按服务地址复用 GeeRPC.Client
+type XClient struct {
+	// d 服务发现
+	d Discovery
+	// mode 负载均衡策略
+	mode SelectMode
+	// opt 建立连接时使用的选项
+	opt *GeeRPC.Option
+	// mu 保护clients、r和index
+	mu sync.Mutex
+	// clients 已建立连接的客户端, key为服务地址
+	clients map[string]*GeeRPC.Client
+	// r 随机数生成器
+	r *rand.Rand
+	// index 轮询的位置
+	index int
+	// hedges 开启了对冲请求的方法, key为 Service.Method
+	hedges sync.Map
+	// breakerPolicy 熔断策略, nil表示未开启熔断
+	breakerPolicy *BreakerPolicy
+	// breakers 各服务地址的熔断器
+	breakers map[string]*breaker
+}
+
+var _ io.Closer = (*XClient)(nil)
+
+// NewXClient 创建XClient
+func NewXClient(d Discovery, mode SelectMode, opt *GeeRPC.Option) *XClient {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	return &XClient{
+		d:       d,
+		mode:    mode,
+		opt:     opt,
+		clients: make(map[string]*GeeRPC.Client),
+		r:       r,
+		index:   r.Intn(1 << 30), // 避免每次都从0开始
+	}
+}
+
+// Close 关闭所有已建立的连接
+func (xc *XClient) Close() error {
+	GeeRPC.UnregisterDebugTable(xc)
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	for key, client := range xc.clients {
+		// I have no idea how to deal with error, just ignore it.
+		_ = client.Close()
+		delete(xc.clients, key)
+	}
+	return nil
+}
+
+// pick 按负载均衡策略选择一个服务实例, exclude中的实例和熔断器打开的实例不会被选中
+//
+// 开启熔断时, 返回的实例已经占用了熔断器的放行名额, 调用结束后需要通过返回的admission记录结果。
+func (xc *XClient) pick(exclude map[string]bool) (string, admission, error) {
+	servers, err := xc.d.GetAll()
+	if err != nil {
+		return "", admission{}, err
+	}
+	skip := make(map[string]bool) // 被熔断器拒绝的实例
+	for {
+		var candidates []string
+		for _, s := range servers {
+			if exclude[s] || skip[s] {
+				continue
+			}
+			if b := xc.breaker(s); b != nil && !b.ready() {
+				skip[s] = true
+				continue
+			}
+			candidates = append(candidates, s)
+		}
+		if len(candidates) == 0 {
+			if len(skip) > 0 {
+				return "", admission{}, GeeRPC.Errorf(GeeRPC.Unavailable, "rpc xclient: circuit breaker is open for all servers")
+			}
+			return "", admission{}, errNoServers
+		}
+		s := xc.selectServer(candidates)
+		b := xc.breaker(s)
+		if b == nil {
+			return s, admission{}, nil
+		}
+		if adm, ok := b.allow(); ok {
+			return s, adm, nil
+		}
+		skip[s] = true // 半开状态的探测名额已被并发的请求占用
+	}
+}
+
+// selectServer 按负载均衡策略从candidates中选择一个
+func (xc *XClient) selectServer(candidates []string) string {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	n := len(candidates)
+	switch xc.mode {
+	case RoundRobinSelect:
+		s := candidates[xc.index%n]
+		xc.index = (xc.index + 1) % n
+		return s
+	default:
+		return candidates[xc.r.Intn(n)]
+	}
+}
+
+// dial 返回rpcAddr对应的客户端, 连接不可用时重新建立
+func (xc *XClient) dial(rpcAddr string) (*GeeRPC.Client, error) {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	client, ok := xc.clients[rpcAddr]
+	if ok && !client.IsAvailable() {
+		_ = client.Close()
+		delete(xc.clients, rpcAddr)
+		client = nil
+	}
+	if client == nil {
+		var err error
+		client, err = GeeRPC.XDial(rpcAddr, xc.opt)
+		if err != nil {
+			return nil, err
+		}
+		xc.clients[rpcAddr] = client
+	}
+	return client, nil
+}
+
+func (xc *XClient) call(rpcAddr string, adm admission, ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	client, err := xc.dial(rpcAddr)
+	if err == nil {
+		err = client.Call(ctx, serviceMethod, args, reply)
+	}
+	adm.done(err)
+	return err
+}
+
+// Call 调用指定的方法, 等待其完成并返回错误
+//
+// 对开启了对冲的方法 (见 SetHedgePolicy), 可能会向多个服务实例发出请求。
+func (xc *XClient) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	if h, ok := xc.hedges.Load(serviceMethod); ok {
+		return xc.hedgedCall(ctx, h.(*hedger), serviceMethod, args, reply)
+	}
+	rpcAddr, adm, err := xc.pick(nil)
+	if err != nil {
+		return err
+	}
+	return xc.call(rpcAddr, adm, ctx, serviceMethod, args, reply)
+}
@@ -0,0 +1,130 @@
+package xclient
+
+import (
+	"GeeRPC"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// _assert 断言,如果cond为false，则panic
+func _assert(cond bool, msg string, v ...interface{}) {
+	if !cond {
+		panic(fmt.Sprintf("assert failed! "+msg, v...))
+	}
+}
+
+// Replica 模拟一个服务实例, 按固定延迟返回自己的编号
+type Replica struct {
+	id    int
+	delay time.Duration
+	calls int32
+	// failing 不为0时返回错误
+	failing int32
+}
+
+func (r *Replica) Get(arg int, reply *int) error {
+	atomic.AddInt32(&r.calls, 1)
+	time.Sleep(r.delay)
+	if atomic.LoadInt32(&r.failing) != 0 {
+		return errors.New("replica is failing")
+	}
+	*reply = r.id
+	return nil
+}
+
+// startTestServer 以opts启动注册了r的服务实例, 返回 tcp@addr 格式的地址, 测试结束时关闭监听
+func startTestServer(t *testing.T, r *Replica, opts ...GeeRPC.ServerOption) string {
+	server := GeeRPC.NewServer(opts...)
+	_ = server.Register(r)
+	l, err := net.Listen("tcp", ":0")
+	_assert(err == nil, "listen failed: %v", err)
+	t.Cleanup(func() { _ = l.Close() })
+	go server.Accept(l)
+	return "tcp@" + l.Addr().String()
+}
+
+// TestXClient_Call 测试负载均衡调用
+func TestXClient_Call(t *testing.T) {
+	t.Parallel()
+	a := startTestServer(t, &Replica{id: 1})
+	b := startTestServer(t, &Replica{id: 2})
+	xc := NewXClient(NewMultiServerDiscovery([]string{a, b}), RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+
+	seen := make(map[int]bool)
+	for i := 0; i < 4; i++ {
+		var reply int
+		err := xc.Call(context.Background(), "Replica.Get", 0, &reply)
+		_assert(err == nil, "call failed: %v", err)
+		seen[reply] = true
+	}
+	_assert(len(seen) == 2, "expect round robin over both replicas, got %v", seen)
+}
+
+// TestXClient_Hedge 测试对冲请求: 最先返回的结果胜出, 落后的请求被取消
+func TestXClient_Hedge(t *testing.T) {
+	t.Parallel()
+	slow := &Replica{id: 1, delay: time.Second}
+	fast := &Replica{id: 2}
+	xc := NewXClient(NewMultiServerDiscovery([]string{startTestServer(t, slow), startTestServer(t, fast)}), RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.index = 0 // 首次请求发往慢的实例
+	xc.SetHedgePolicy("Replica.Get", &HedgePolicy{Delay: 50 * time.Millisecond})
+
+	start := time.Now()
+	var reply int
+	err := xc.Call(context.Background(), "Replica.Get", 0, &reply)
+	_assert(err == nil, "hedged call failed: %v", err)
+	_assert(reply == fast.id, "expect the fast replica to win, got %d", reply)
+	_assert(time.Since(start) < 500*time.Millisecond, "hedged call took %s", time.Since(start))
+	stats := xc.HedgeStats("Replica.Get")
+	_assert(stats.Requests == 1 && stats.Hedged == 1 && stats.Canceled == 1, "unexpected stats %+v", stats)
+	_assert(atomic.LoadInt32(&slow.calls) == 1 && atomic.LoadInt32(&fast.calls) == 1, "expect one attempt per replica")
+}
+
+// TestXClient_HedgeBudget 测试对冲请求不超过MaxRatio
+func TestXClient_HedgeBudget(t *testing.T) {
+	t.Parallel()
+	a := startTestServer(t, &Replica{id: 1, delay: 50 * time.Millisecond})
+	b := startTestServer(t, &Replica{id: 2, delay: 50 * time.Millisecond})
+	xc := NewXClient(NewMultiServerDiscovery([]string{a, b}), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetHedgePolicy("Replica.Get", &HedgePolicy{Delay: time.Millisecond, MaxRatio: 0.5})
+
+	for i := 0; i < 4; i++ {
+		var reply int
+		_assert(xc.Call(context.Background(), "Replica.Get", 0, &reply) == nil, "call failed")
+	}
+	stats := xc.HedgeStats("Replica.Get")
+	_assert(stats.Requests == 4 && stats.Hedged == 2, "expect hedges capped at half the calls, got %+v", stats)
+}
+
+// TestXClient_HedgeNoReplica 测试没有其他实例可用时, 未发出的对冲请求不占用MaxRatio
+func TestXClient_HedgeNoReplica(t *testing.T) {
+	t.Parallel()
+	xc := NewXClient(NewMultiServerDiscovery([]string{startTestServer(t, &Replica{id: 1, delay: 20 * time.Millisecond})}), RandomSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetHedgePolicy("Replica.Get", &HedgePolicy{Delay: time.Millisecond, MaxRatio: 0.5})
+
+	for i := 0; i < 2; i++ {
+		var reply int
+		_assert(xc.Call(context.Background(), "Replica.Get", 0, &reply) == nil, "call failed")
+	}
+	stats := xc.HedgeStats("Replica.Get")
+	_assert(stats.Requests == 2 && stats.Hedged == 0, "expect no hedge to be counted, got %+v", stats)
+}
+
+// TestHedger_delay 测试按延迟分位数计算等待时间
+func TestHedger_delay(t *testing.T) {
+	h := newHedger(HedgePolicy{Delay: time.Second, Percentile: 0.9})
+	_assert(h.delay() == time.Second, "expect Delay before enough samples")
+	for i := 1; i <= 100; i++ {
+		h.observe(time.Duration(i) * time.Millisecond)
+	}
+	_assert(h.delay() == 91*time.Millisecond, "expect p90 of samples, got %s", h.delay())
+}